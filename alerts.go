@@ -0,0 +1,566 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// --- Threshold alerts ---
+
+// AlertsConfig holds the alert rules loaded at startup. Clients can add
+// more at runtime with add_alert_rule; those belong to the session that
+// added them and go away with it. Rules are evaluated on every sample of
+// the background sampler, so they need it enabled.
+type AlertsConfig struct {
+	Rules    []AlertRuleConfig `yaml:"rules"`
+	MaxRules int               `yaml:"max_rules"` // limit on config rules plus the client rules of one session
+}
+
+type AlertRuleConfig struct {
+	Name     string `yaml:"name"`     // defaults to the expression
+	Expr     string `yaml:"expr"`     // e.g. "memory.used_percent > 95 for 60s"
+	Severity string `yaml:"severity"` // warning (default) or critical
+}
+
+func DefaultAlertsConfig() AlertsConfig {
+	return AlertsConfig{MaxRules: 100}
+}
+
+func (c AlertsConfig) validate() error {
+	if c.MaxRules < 1 {
+		return fmt.Errorf("alerts.max_rules must be at least 1, got %d", c.MaxRules)
+	}
+	if len(c.Rules) > c.MaxRules {
+		return fmt.Errorf("alerts.rules has %d rules, more than max_rules (%d)", len(c.Rules), c.MaxRules)
+	}
+	seen := make(map[string]bool)
+	for i, rc := range c.Rules {
+		r, err := newAlertRule(rc.Name, rc.Expr, rc.Severity)
+		if err != nil {
+			return fmt.Errorf("alerts.rules[%d]: %w", i, err)
+		}
+		if seen[r.Name] {
+			return fmt.Errorf("alerts.rules[%d]: duplicate rule name %q", i, r.Name)
+		}
+		seen[r.Name] = true
+	}
+	return nil
+}
+
+const (
+	AlertPending  = "pending"  // condition holds, but not yet for the rule's duration
+	AlertFiring   = "firing"   // condition has held for the rule's duration
+	AlertResolved = "resolved" // condition stopped holding after firing
+
+	alertSourceConfig = "config"
+	alertSourceClient = "client"
+
+	// AlertsResourceURI is the resource holding the list_alerts result.
+	// Subscribers are told when an alert fires or resolves.
+	AlertsResourceURI = "system://alerts"
+	alertsLogger      = "alerts"
+
+	// resolvedAlertsKept bounds the recently resolved alerts list_alerts reports.
+	resolvedAlertsKept = 20
+)
+
+// AlertRule fires when a metric compares true against a value for at
+// least For. The metric is a sampler metric name in which * matches any run
+// of characters, so "disk.*.used_percent" covers every mount.
+type AlertRule struct {
+	Name       string  `json:"name"`
+	Expr       string  `json:"expr"`
+	Metric     string  `json:"metric"`
+	Op         string  `json:"op"`
+	Value      float64 `json:"value"`
+	ForSeconds float64 `json:"for_seconds,omitempty"`
+	Severity   string  `json:"severity"`
+	Source     string  `json:"source"` // config or client
+
+	owner   *mcp.ServerSession // session that added a client rule
+	forDur  time.Duration
+	pattern *regexp.Regexp
+}
+
+var alertExprRe = regexp.MustCompile(`^\s*(\S+?)\s*(>=|<=|==|!=|>|<)\s*(\S+)(?:\s+for\s+(\S+))?\s*$`)
+
+// parseAlertExpr parses "<metric> <op> <value> [for <duration>]".
+func parseAlertExpr(expr string) (AlertRule, error) {
+	m := alertExprRe.FindStringSubmatch(expr)
+	if m == nil {
+		return AlertRule{}, fmt.Errorf("invalid alert expression %q (want \"<metric> <op> <value> [for <duration>]\", e.g. \"memory.used_percent > 95 for 60s\")", expr)
+	}
+	value, err := strconv.ParseFloat(m[3], 64)
+	if err != nil {
+		return AlertRule{}, fmt.Errorf("invalid alert threshold %q: not a number", m[3])
+	}
+	var dur time.Duration
+	if m[4] != "" {
+		if dur, err = time.ParseDuration(m[4]); err != nil || dur < 0 {
+			return AlertRule{}, fmt.Errorf("invalid alert duration %q (e.g. 30s, 5m)", m[4])
+		}
+	}
+	parts := strings.Split(m[1], "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return AlertRule{
+		Expr:       strings.TrimSpace(expr),
+		Metric:     m[1],
+		Op:         m[2],
+		Value:      value,
+		ForSeconds: dur.Seconds(),
+		forDur:     dur,
+		pattern:    regexp.MustCompile("^" + strings.Join(parts, ".*") + "$"),
+	}, nil
+}
+
+func newAlertRule(name, expr, severity string) (AlertRule, error) {
+	r, err := parseAlertExpr(expr)
+	if err != nil {
+		return AlertRule{}, err
+	}
+	switch severity {
+	case "":
+		severity = SeverityWarning
+	case SeverityWarning, SeverityCritical:
+	default:
+		return AlertRule{}, fmt.Errorf("invalid alert severity %q (want warning or critical)", severity)
+	}
+	r.Name = strings.TrimSpace(name)
+	if r.Name == "" {
+		r.Name = r.Expr
+	}
+	r.Severity = severity
+	return r, nil
+}
+
+func (r *AlertRule) holds(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Value
+	case ">=":
+		return v >= r.Value
+	case "<":
+		return v < r.Value
+	case "<=":
+		return v <= r.Value
+	case "==":
+		return v == r.Value
+	default: // !=
+		return v != r.Value
+	}
+}
+
+// Alert is one rule applied to one metric. A rule with a wildcard metric
+// has an alert per matching metric.
+type Alert struct {
+	Rule       string     `json:"rule"`
+	Metric     string     `json:"metric"`
+	State      string     `json:"state"` // pending, firing or resolved
+	Severity   string     `json:"severity"`
+	Expr       string     `json:"expr"`
+	Value      float64    `json:"value"` // latest sampled value
+	Since      time.Time  `json:"since"` // when the condition started holding
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+
+	owner *mcp.ServerSession // session of the rule; nil for config rules
+}
+
+// visibleTo reports whether an alert of owner is shown to session ss.
+func visibleTo(owner, ss *mcp.ServerSession) bool { return owner == nil || owner == ss }
+
+// alertKey identifies one rule applied to one metric.
+type alertKey struct {
+	owner        *mcp.ServerSession
+	rule, metric string
+}
+
+// AlertEvent is the data of the notification sent when an alert fires or
+// resolves.
+type AlertEvent struct {
+	Alert
+	Message string `json:"message"`
+}
+
+type AlertsResult struct {
+	Firing        []Alert     `json:"firing"`
+	Pending       []Alert     `json:"pending"`
+	Resolved      []Alert     `json:"recently_resolved,omitempty"` // newest first
+	Rules         []AlertRule `json:"rules"`
+	LastEvaluated *time.Time  `json:"last_evaluated,omitempty"`
+}
+
+type ListAlertsArgs struct{}
+
+type AddAlertRuleArgs struct {
+	Expr     string `json:"expr"`               // "<metric> <op> <value> [for <duration>]", e.g. "memory.used_percent > 95 for 60s"; * in the metric matches any run of characters
+	Name     string `json:"name,omitempty"`     // defaults to the expression; adding a name again replaces that rule
+	Severity string `json:"severity,omitempty"` // warning (default) or critical
+}
+
+type RemoveAlertRuleArgs struct {
+	Name string `json:"name"`
+}
+
+type AddAlertRuleResult struct {
+	Rule    AlertRule `json:"rule"`
+	Matches []string  `json:"matching_metrics"` // metrics the sampler currently records that the rule covers
+}
+
+// Alerter evaluates alert rules against each sample and reports state
+// changes to notify. Config rules are shared by every session; client
+// rules are seen and reported only to the session that added them.
+type Alerter struct {
+	maxRules int
+	notify   func(AlertEvent)
+	sessions func() iter.Seq[*mcp.ServerSession] // connected sessions; nil keeps every rule
+
+	mu        sync.Mutex
+	rules     []*AlertRule
+	alerts    map[alertKey]*Alert
+	resolved  []Alert // oldest first
+	evaluated time.Time
+}
+
+// alerter is the running Alerter, or nil when sampling is disabled.
+var alerter *Alerter
+
+var errAlertsDisabled = errors.New("alerts are unavailable: the background sampler is disabled")
+
+// NewAlerter returns an Alerter with the rules from cfg, which must have
+// passed validation.
+func NewAlerter(cfg AlertsConfig) *Alerter {
+	a := &Alerter{maxRules: cfg.MaxRules, alerts: make(map[alertKey]*Alert)}
+	for _, rc := range cfg.Rules {
+		r, _ := newAlertRule(rc.Name, rc.Expr, rc.Severity)
+		r.Source = alertSourceConfig
+		a.rules = append(a.rules, &r)
+	}
+	return a
+}
+
+// AddRule adds a client rule owned by session ss, replacing an earlier
+// rule of the same name from that session. Alerts of a replaced rule are
+// dropped; firing ones are resolved.
+func (a *Alerter) AddRule(ss *mcp.ServerSession, r AlertRule) error {
+	r.Source = alertSourceClient
+	r.owner = ss
+	a.mu.Lock()
+	i := a.ruleIndex(ss, r.Name)
+	var events []AlertEvent
+	switch {
+	case i >= 0 && a.rules[i].Source == alertSourceConfig:
+		a.mu.Unlock()
+		return fmt.Errorf("alert rule %q is defined in the config file and cannot be replaced", r.Name)
+	case i >= 0:
+		events = a.dropAlerts(ss, r.Name, time.Now())
+		a.rules[i] = &r
+	case a.ruleCount(ss) >= a.maxRules:
+		a.mu.Unlock()
+		return fmt.Errorf("too many alert rules (alerts.max_rules is %d)", a.maxRules)
+	default:
+		a.rules = append(a.rules, &r)
+	}
+	a.mu.Unlock()
+	a.send(events)
+	return nil
+}
+
+// RemoveRule removes a client rule of session ss; its firing alerts are
+// resolved.
+func (a *Alerter) RemoveRule(ss *mcp.ServerSession, name string) error {
+	a.mu.Lock()
+	i := a.ruleIndex(ss, name)
+	if i < 0 {
+		a.mu.Unlock()
+		return fmt.Errorf("no alert rule named %q", name)
+	}
+	if a.rules[i].Source == alertSourceConfig {
+		a.mu.Unlock()
+		return fmt.Errorf("alert rule %q is defined in the config file and cannot be removed", name)
+	}
+	a.rules = append(a.rules[:i], a.rules[i+1:]...)
+	events := a.dropAlerts(ss, name, time.Now())
+	a.mu.Unlock()
+	a.send(events)
+	return nil
+}
+
+// ruleIndex finds the rule called name among the config rules and the
+// client rules of ss.
+func (a *Alerter) ruleIndex(ss *mcp.ServerSession, name string) int {
+	for i, r := range a.rules {
+		if r.Name == name && visibleTo(r.owner, ss) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ruleCount counts the config rules and the client rules of ss.
+func (a *Alerter) ruleCount(ss *mcp.ServerSession) int {
+	n := 0
+	for _, r := range a.rules {
+		if visibleTo(r.owner, ss) {
+			n++
+		}
+	}
+	return n
+}
+
+// pruneSessions drops the client rules, alerts and resolved alerts of
+// sessions that have gone away. No events are sent: nobody is left to
+// receive them. a.mu must be held.
+func (a *Alerter) pruneSessions(live map[*mcp.ServerSession]bool) {
+	gone := func(owner *mcp.ServerSession) bool { return owner != nil && !live[owner] }
+	a.rules = slices.DeleteFunc(a.rules, func(r *AlertRule) bool { return gone(r.owner) })
+	for key := range a.alerts {
+		if gone(key.owner) {
+			delete(a.alerts, key)
+		}
+	}
+	a.resolved = slices.DeleteFunc(a.resolved, func(al Alert) bool { return gone(al.owner) })
+}
+
+// dropAlerts forgets the alerts of a rule of session ss and returns resolve
+// events for the ones that were firing. a.mu must be held.
+func (a *Alerter) dropAlerts(ss *mcp.ServerSession, rule string, now time.Time) []AlertEvent {
+	var events []AlertEvent
+	for key, al := range a.alerts {
+		if key.rule != rule || key.owner != ss {
+			continue
+		}
+		delete(a.alerts, key)
+		if al.State == AlertFiring {
+			events = append(events, a.resolve(al, now))
+		}
+	}
+	return events
+}
+
+// resolve marks a firing alert resolved and remembers it. a.mu must be held.
+func (a *Alerter) resolve(al *Alert, now time.Time) AlertEvent {
+	al.State = AlertResolved
+	al.ResolvedAt = &now
+	a.resolved = append(a.resolved, *al)
+	if len(a.resolved) > resolvedAlertsKept {
+		a.resolved = a.resolved[len(a.resolved)-resolvedAlertsKept:]
+	}
+	return AlertEvent{Alert: *al, Message: alertMessage(*al)}
+}
+
+// Observe evaluates every rule against one sample and sends a notification
+// for each alert that fired or resolved. Alerts on metrics missing from the
+// sample keep their state. Rules of sessions that have gone away without
+// removing them are dropped first.
+func (a *Alerter) Observe(t time.Time, values map[string]float64) {
+	var live map[*mcp.ServerSession]bool
+	if a.sessions != nil {
+		live = make(map[*mcp.ServerSession]bool)
+		for ss := range a.sessions() {
+			live[ss] = true
+		}
+	}
+	a.mu.Lock()
+	if live != nil {
+		a.pruneSessions(live)
+	}
+	events := a.evaluate(t, values)
+	a.mu.Unlock()
+	a.send(events)
+}
+
+func (a *Alerter) evaluate(t time.Time, values map[string]float64) []AlertEvent {
+	a.evaluated = t
+	var events []AlertEvent
+	for _, r := range a.rules {
+		for metric, v := range values {
+			if !r.pattern.MatchString(metric) {
+				continue
+			}
+			key := alertKey{r.owner, r.Name, metric}
+			al := a.alerts[key]
+			if !r.holds(v) {
+				if al != nil {
+					delete(a.alerts, key)
+					if al.State == AlertFiring {
+						al.Value = v
+						events = append(events, a.resolve(al, t))
+					}
+				}
+				continue
+			}
+			if al == nil {
+				al = &Alert{Rule: r.Name, Metric: metric, State: AlertPending, Severity: r.Severity, Expr: r.Expr, Since: t, owner: r.owner}
+				a.alerts[key] = al
+			}
+			al.Value = v
+			if al.State == AlertPending && t.Sub(al.Since) >= r.forDur {
+				fired := t
+				al.State = AlertFiring
+				al.FiredAt = &fired
+				events = append(events, AlertEvent{Alert: *al, Message: alertMessage(*al)})
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Rule != events[j].Rule {
+			return events[i].Rule < events[j].Rule
+		}
+		return events[i].Metric < events[j].Metric
+	})
+	return events
+}
+
+func (a *Alerter) send(events []AlertEvent) {
+	if a.notify == nil {
+		return
+	}
+	for _, ev := range events {
+		a.notify(ev)
+	}
+}
+
+// List returns the alerts and rules session ss can see: those of the
+// config rules and of its own client rules.
+func (a *Alerter) List(ss *mcp.ServerSession) AlertsResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := AlertsResult{Firing: []Alert{}, Pending: []Alert{}, Rules: []AlertRule{}}
+	for _, al := range a.alerts {
+		if !visibleTo(al.owner, ss) {
+			continue
+		}
+		if al.State == AlertFiring {
+			out.Firing = append(out.Firing, *al)
+		} else {
+			out.Pending = append(out.Pending, *al)
+		}
+	}
+	for _, list := range [][]Alert{out.Firing, out.Pending} {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Severity != list[j].Severity {
+				return list[i].Severity == SeverityCritical
+			}
+			return list[i].Since.Before(list[j].Since)
+		})
+	}
+	for i := len(a.resolved) - 1; i >= 0; i-- {
+		if visibleTo(a.resolved[i].owner, ss) {
+			out.Resolved = append(out.Resolved, a.resolved[i])
+		}
+	}
+	for _, r := range a.rules {
+		if visibleTo(r.owner, ss) {
+			out.Rules = append(out.Rules, *r)
+		}
+	}
+	if !a.evaluated.IsZero() {
+		t := a.evaluated
+		out.LastEvaluated = &t
+	}
+	return out
+}
+
+func alertMessage(al Alert) string {
+	if al.State == AlertResolved {
+		return fmt.Sprintf("resolved: %s (%s is now %g)", al.Rule, al.Metric, al.Value)
+	}
+	return fmt.Sprintf("%s: %s (%s is %g)", al.Severity, al.Rule, al.Metric, al.Value)
+}
+
+func alertsSummary(out AlertsResult) string {
+	if len(out.Firing) == 0 {
+		return fmt.Sprintf("No alerts firing (%d pending, %d rules)", len(out.Pending), len(out.Rules))
+	}
+	names := make([]string, len(out.Firing))
+	for i, al := range out.Firing {
+		names[i] = al.Rule
+		if al.Metric != al.Rule {
+			names[i] += " [" + al.Metric + "]"
+		}
+	}
+	return fmt.Sprintf("%d firing: %s (%d pending, %d rules)", len(out.Firing), strings.Join(names, ", "), len(out.Pending), len(out.Rules))
+}
+
+func addAlertRule(a *Alerter, s *Sampler, ss *mcp.ServerSession, args AddAlertRuleArgs) (AddAlertRuleResult, error) {
+	if a == nil {
+		return AddAlertRuleResult{}, errAlertsDisabled
+	}
+	r, err := newAlertRule(args.Name, args.Expr, args.Severity)
+	if err != nil {
+		return AddAlertRuleResult{}, err
+	}
+	if err := a.AddRule(ss, r); err != nil {
+		return AddAlertRuleResult{}, err
+	}
+	r.Source = alertSourceClient
+	out := AddAlertRuleResult{Rule: r, Matches: []string{}}
+	if s != nil {
+		for _, name := range s.Metrics() {
+			if r.pattern.MatchString(name) {
+				out.Matches = append(out.Matches, name)
+			}
+		}
+	}
+	return out, nil
+}
+
+// --- Notifications ---
+
+// alertNotifier returns a notify function that logs each event to the
+// sessions that can see its rule (every session for config rules, the
+// owner for client rules) and tells subscribers of AlertsResourceURI that
+// it changed. Sessions only receive log messages once they have chosen a
+// level with logging/setLevel; firing alerts are logged at their severity,
+// resolved ones at info.
+func alertNotifier(ctx context.Context, server *mcp.Server) func(AlertEvent) {
+	return func(ev AlertEvent) {
+		level := mcp.LoggingLevel(ev.Severity)
+		if ev.State == AlertResolved {
+			level = "info"
+		}
+		for ss := range server.Sessions() {
+			if !visibleTo(ev.owner, ss) {
+				continue
+			}
+			ss.Log(ctx, &mcp.LoggingMessageParams{Level: level, Logger: alertsLogger, Data: ev})
+		}
+		server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: AlertsResourceURI})
+	}
+}
+
+// registerAlertsResource publishes the list_alerts result as a resource.
+func registerAlertsResource(server *mcp.Server) {
+	server.AddResource(&mcp.Resource{
+		URI:         AlertsResourceURI,
+		Name:        "alerts",
+		Description: "Firing and pending threshold alerts and the rules behind them; subscribe to be told when an alert fires or resolves",
+		MIMEType:    "application/json",
+	}, func(_ context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		if alerter == nil {
+			return nil, errAlertsDisabled
+		}
+		data, err := json.Marshal(alerter.List(req.Session))
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{
+			{URI: req.Params.URI, MIMEType: "application/json", Text: string(data)},
+		}}, nil
+	})
+}
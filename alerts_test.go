@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAlertExpr(t *testing.T) {
+	r, err := parseAlertExpr("memory.used_percent > 95 for 60s")
+	require.NoError(t, err)
+	assert.Equal(t, "memory.used_percent", r.Metric)
+	assert.Equal(t, ">", r.Op)
+	assert.Equal(t, float64(95), r.Value)
+	assert.Equal(t, float64(60), r.ForSeconds)
+
+	r, err = parseAlertExpr("disk.*.used_percent>=90")
+	require.NoError(t, err)
+	assert.Equal(t, ">=", r.Op)
+	assert.Zero(t, r.ForSeconds)
+	assert.True(t, r.pattern.MatchString("disk./var/lib.used_percent"))
+	assert.False(t, r.pattern.MatchString("disk./var.inodes_used_percent"))
+	assert.False(t, r.pattern.MatchString("xdisk./.used_percent"))
+
+	for _, expr := range []string{"", "memory.used_percent", "memory.used_percent > high", "load.load1 > 4 for ever", "load.load1 > 4 during 5m", "load.load1 => 4"} {
+		_, err := parseAlertExpr(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestAlerterTransitions(t *testing.T) {
+	a := NewAlerter(AlertsConfig{MaxRules: 10, Rules: []AlertRuleConfig{
+		{Name: "memory-high", Expr: "memory.used_percent > 95 for 60s", Severity: SeverityCritical},
+		{Expr: "disk.*.used_percent >= 90"},
+	}})
+	var events []AlertEvent
+	a.notify = func(ev AlertEvent) { events = append(events, ev) }
+
+	base := time.Unix(1000, 0)
+	a.Observe(base, map[string]float64{"memory.used_percent": 97, "disk./.used_percent": 91, "disk./data.used_percent": 50})
+	require.Len(t, events, 1, "a rule without a duration fires at once")
+	assert.Equal(t, AlertFiring, events[0].State)
+	assert.Equal(t, "disk.*.used_percent >= 90", events[0].Rule, "the name defaults to the expression")
+	assert.Equal(t, "disk./.used_percent", events[0].Metric)
+
+	out := a.List(nil)
+	require.Len(t, out.Pending, 1)
+	assert.Equal(t, "memory-high", out.Pending[0].Rule)
+	assert.Equal(t, base, out.Pending[0].Since)
+
+	a.Observe(base.Add(30*time.Second), map[string]float64{"memory.used_percent": 98})
+	assert.Len(t, events, 1, "not yet held for 60s")
+
+	a.Observe(base.Add(60*time.Second), map[string]float64{"memory.used_percent": 96})
+	require.Len(t, events, 2)
+	assert.Equal(t, AlertFiring, events[1].State)
+	assert.Equal(t, SeverityCritical, events[1].Severity)
+	assert.Equal(t, float64(96), events[1].Value)
+	assert.Equal(t, "critical: memory-high (memory.used_percent is 96)", events[1].Message)
+
+	out = a.List(nil)
+	require.Len(t, out.Firing, 2)
+	assert.Equal(t, "memory-high", out.Firing[0].Rule, "critical alerts first")
+	assert.Equal(t, "2 firing: memory-high [memory.used_percent], disk.*.used_percent >= 90 [disk./.used_percent] (0 pending, 2 rules)", alertsSummary(out))
+
+	a.Observe(base.Add(70*time.Second), map[string]float64{"memory.used_percent": 80, "disk./.used_percent": 91})
+	require.Len(t, events, 3)
+	assert.Equal(t, AlertResolved, events[2].State)
+	assert.Equal(t, "resolved: memory-high (memory.used_percent is now 80)", events[2].Message)
+
+	out = a.List(nil)
+	assert.Len(t, out.Firing, 1)
+	require.Len(t, out.Resolved, 1)
+	assert.Equal(t, base.Add(70*time.Second), *out.Resolved[0].ResolvedAt)
+
+	// A pending alert whose condition stops holding goes away quietly.
+	a.Observe(base.Add(80*time.Second), map[string]float64{"memory.used_percent": 99})
+	a.Observe(base.Add(90*time.Second), map[string]float64{"memory.used_percent": 10})
+	assert.Len(t, events, 3)
+	assert.Empty(t, a.List(nil).Pending)
+}
+
+func TestAlerterClientRules(t *testing.T) {
+	a := NewAlerter(AlertsConfig{MaxRules: 2, Rules: []AlertRuleConfig{{Name: "cfg", Expr: "load.load1 > 8"}}})
+	var events []AlertEvent
+	a.notify = func(ev AlertEvent) { events = append(events, ev) }
+	ss := &mcp.ServerSession{}
+
+	r, err := newAlertRule("cfg", "load.load1 > 1", "")
+	require.NoError(t, err)
+	assert.ErrorContains(t, a.AddRule(ss, r), "config file")
+	assert.ErrorContains(t, a.RemoveRule(ss, "cfg"), "config file")
+
+	r, err = newAlertRule("swap", "memory.swap_used_bytes > 0", SeverityWarning)
+	require.NoError(t, err)
+	require.NoError(t, a.AddRule(ss, r))
+	other, _ := newAlertRule("other", "load.load5 > 1", "")
+	assert.ErrorContains(t, a.AddRule(ss, other), "max_rules")
+
+	a.Observe(time.Unix(1000, 0), map[string]float64{"memory.swap_used_bytes": 4096})
+	require.Len(t, events, 1)
+
+	r, _ = newAlertRule("swap", "memory.swap_used_bytes > 1e9", SeverityWarning)
+	require.NoError(t, a.AddRule(ss, r), "a client rule may be replaced")
+	require.Len(t, events, 2, "replacing a rule resolves its firing alerts")
+	assert.Equal(t, AlertResolved, events[1].State)
+	assert.Equal(t, "memory.swap_used_bytes > 1e9", a.List(ss).Rules[1].Expr)
+
+	require.NoError(t, a.RemoveRule(ss, "swap"))
+	assert.Error(t, a.RemoveRule(ss, "swap"))
+	assert.Len(t, a.List(ss).Rules, 1)
+}
+
+func TestAddAlertRule(t *testing.T) {
+	_, err := addAlertRule(nil, nil, nil, AddAlertRuleArgs{Expr: "load.load1 > 1"})
+	assert.ErrorIs(t, err, errAlertsDisabled)
+
+	s := NewSampler(SamplerConfig{Enabled: true, IntervalMs: 100, HistorySize: 10})
+	s.record(time.Now(), map[string]float64{"disk./.used_percent": 50, "disk./boot.used_percent": 20, "load.load1": 1})
+	a := NewAlerter(DefaultAlertsConfig())
+	out, err := addAlertRule(a, s, &mcp.ServerSession{}, AddAlertRuleArgs{Expr: "disk.*.used_percent > 80 for 5m", Name: "disk"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"disk./.used_percent", "disk./boot.used_percent"}, out.Matches)
+	assert.Equal(t, alertSourceClient, out.Rule.Source)
+	assert.Equal(t, float64(300), out.Rule.ForSeconds)
+
+	_, err = addAlertRule(a, s, &mcp.ServerSession{}, AddAlertRuleArgs{Expr: "load.load1 > 1", Severity: "page"})
+	assert.Error(t, err)
+}
+
+func TestAlertsConfigValidate(t *testing.T) {
+	cfg, err := parseConfig([]byte("alerts:\n  rules:\n    - {name: mem, expr: 'memory.used_percent > 95 for 1m', severity: critical}\n"))
+	require.NoError(t, err)
+	require.Len(t, cfg.Alerts.Rules, 1)
+	assert.Equal(t, 100, cfg.Alerts.MaxRules)
+
+	for _, yaml := range []string{
+		"alerts:\n  rules:\n    - {expr: 'memory.used_percent >'}\n",
+		"alerts:\n  rules:\n    - {expr: 'load.load1 > 1', severity: info}\n",
+		"alerts:\n  rules:\n    - {name: a, expr: 'load.load1 > 1'}\n    - {name: a, expr: 'load.load5 > 1'}\n",
+		"alerts:\n  max_rules: 1\n  rules:\n    - {expr: 'load.load1 > 1'}\n    - {expr: 'load.load5 > 1'}\n",
+		"sampler:\n  enabled: false\nalerts:\n  rules:\n    - {expr: 'load.load1 > 1'}\n",
+	} {
+		_, err := parseConfig([]byte(yaml))
+		assert.Error(t, err, yaml)
+	}
+}
+
+// Integration test: a subscribed client with a log level set receives both
+// the log message and the resource update when an alert fires.
+func TestAlertNotifications(t *testing.T) {
+	saved := alerter
+	alerter = NewAlerter(AlertsConfig{MaxRules: 10, Rules: []AlertRuleConfig{{Name: "load", Expr: "load.load1 > 4", Severity: SeverityCritical}}})
+	t.Cleanup(func() { alerter = saved })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, newResourceWatcher(DefaultResourcesConfig()).serverOptions())
+	require.NoError(t, registerTools(server, nil))
+	registerResources(server)
+	alerter.notify = alertNotifier(ctx, server)
+	alerter.sessions = server.Sessions
+
+	logs := make(chan *mcp.LoggingMessageParams, 1)
+	updates := make(chan string, 1)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.0.1"}, &mcp.ClientOptions{
+		LoggingMessageHandler:  func(_ context.Context, req *mcp.LoggingMessageRequest) { logs <- req.Params },
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) { updates <- req.Params.URI },
+	})
+	st, ct := mcp.NewInMemoryTransports()
+	_, err := server.Connect(ctx, st, nil)
+	require.NoError(t, err)
+	session, err := client.Connect(ctx, ct, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	require.NoError(t, session.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "warning"}))
+	require.NoError(t, session.Subscribe(ctx, &mcp.SubscribeParams{URI: AlertsResourceURI}))
+	assert.Error(t, session.Subscribe(ctx, &mcp.SubscribeParams{URI: "system://nope"}))
+
+	alerter.Observe(time.Now(), map[string]float64{"load.load1": 6})
+	select {
+	case msg := <-logs:
+		assert.Equal(t, mcp.LoggingLevel("critical"), msg.Level)
+		assert.Equal(t, alertsLogger, msg.Logger)
+		raw, _ := json.Marshal(msg.Data)
+		var ev AlertEvent
+		require.NoError(t, json.Unmarshal(raw, &ev))
+		assert.Equal(t, AlertFiring, ev.State)
+		assert.Equal(t, "load.load1", ev.Metric)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no log notification")
+	}
+	select {
+	case uri := <-updates:
+		assert.Equal(t, AlertsResourceURI, uri)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no resource update")
+	}
+
+	res, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: AlertsResourceURI})
+	require.NoError(t, err)
+	var out AlertsResult
+	require.NoError(t, json.Unmarshal([]byte(res.Contents[0].Text), &out))
+	require.Len(t, out.Firing, 1)
+
+	call, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "list_alerts"})
+	require.NoError(t, err)
+	assert.Equal(t, "1 firing: load [load.load1] (0 pending, 1 rules)", call.Content[0].(*mcp.TextContent).Text)
+}
+
+// alertClient connects a client to server with its log level set to
+// warning; its alert log messages arrive on the returned channel.
+func alertClient(t *testing.T, server *mcp.Server) (*mcp.ClientSession, chan AlertEvent) {
+	t.Helper()
+	ctx := context.Background()
+	events := make(chan AlertEvent, 10)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.0.1"}, &mcp.ClientOptions{
+		LoggingMessageHandler: func(_ context.Context, req *mcp.LoggingMessageRequest) {
+			raw, _ := json.Marshal(req.Params.Data)
+			var ev AlertEvent
+			if json.Unmarshal(raw, &ev) == nil {
+				events <- ev
+			}
+		},
+	})
+	st, ct := mcp.NewInMemoryTransports()
+	_, err := server.Connect(ctx, st, nil)
+	require.NoError(t, err)
+	session, err := client.Connect(ctx, ct, nil)
+	require.NoError(t, err)
+	require.NoError(t, session.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "warning"}))
+	return session, events
+}
+
+// Integration test: a client rule is seen by, fires to and dies with the
+// session that added it; config rules reach every session.
+func TestAlertRulesPerSession(t *testing.T) {
+	saved := alerter
+	alerter = NewAlerter(AlertsConfig{MaxRules: 2, Rules: []AlertRuleConfig{{Name: "load", Expr: "load.load1 > 4"}}})
+	t.Cleanup(func() { alerter = saved })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, nil)
+	require.NoError(t, registerTools(server, nil))
+	alerter.notify = alertNotifier(ctx, server)
+	alerter.sessions = server.Sessions
+
+	a, aEvents := alertClient(t, server)
+	b, bEvents := alertClient(t, server)
+	defer b.Close()
+
+	call := func(s *mcp.ClientSession, name string, args map[string]any) *mcp.CallToolResult {
+		res, err := s.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		require.NoError(t, err)
+		return res
+	}
+	rules := func(s *mcp.ClientSession) []string {
+		raw, _ := json.Marshal(call(s, "list_alerts", nil).StructuredContent)
+		var out AlertsResult
+		require.NoError(t, json.Unmarshal(raw, &out))
+		var names []string
+		for _, r := range out.Rules {
+			names = append(names, r.Name)
+		}
+		return names
+	}
+
+	assert.False(t, call(a, "add_alert_rule", map[string]any{"name": "mem", "expr": "memory.used_percent > 90"}).IsError)
+	assert.True(t, call(a, "add_alert_rule", map[string]any{"expr": "load.load5 > 1"}).IsError, "max_rules counts config rules and this session's rules")
+	assert.False(t, call(b, "add_alert_rule", map[string]any{"name": "mem", "expr": "memory.used_percent > 50"}).IsError, "the limit is per session")
+	assert.Equal(t, []string{"load", "mem"}, rules(a))
+	assert.Equal(t, []string{"load", "mem"}, rules(b))
+	assert.True(t, call(b, "remove_alert_rule", map[string]any{"name": "load"}).IsError)
+
+	alerter.Observe(time.Now(), map[string]float64{"memory.used_percent": 70, "load.load1": 6})
+	for _, ch := range []chan AlertEvent{aEvents, bEvents} {
+		select {
+		case ev := <-ch:
+			assert.Equal(t, "load", ev.Rule, "config rules reach every session")
+		case <-time.After(5 * time.Second):
+			t.Fatal("no config alert")
+		}
+	}
+	select {
+	case ev := <-bEvents:
+		assert.Equal(t, "mem", ev.Rule)
+		assert.Equal(t, "memory.used_percent > 50", ev.Expr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert for b's rule")
+	}
+	select {
+	case ev := <-aEvents:
+		t.Fatalf("a received another session's alert: %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, a.Close())
+	require.Eventually(t, func() bool {
+		alerter.Observe(time.Now(), map[string]float64{"memory.used_percent": 95})
+		return len(alerter.List(nil).Rules) == 1
+	}, 5*time.Second, 20*time.Millisecond, "a's rule goes away with a")
+	assert.Equal(t, []string{"load", "mem"}, rules(b))
+	select {
+	case ev := <-aEvents:
+		t.Fatalf("a's rule fired after a closed: %+v", ev)
+	default:
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// --- Authentication for network transports ---
+
+// AuthOptions configures authentication for the http and sse transports.
+// Stdio is never authenticated: whoever can spawn the binary already owns it.
+type AuthOptions struct {
+	TokenFile    string `yaml:"token_file"`    // file with one bearer token per line; # starts a comment
+	TLSCertFile  string `yaml:"tls_cert"`      // server certificate (PEM); enables TLS
+	TLSKeyFile   string `yaml:"tls_key"`       // server private key (PEM)
+	ClientCAFile string `yaml:"tls_client_ca"` // CA bundle (PEM) for client certificates; enables mTLS
+}
+
+func (o AuthOptions) Enabled() bool {
+	return o.TokenFile != "" || o.ClientCAFile != ""
+}
+
+func (o AuthOptions) TLSEnabled() bool {
+	return o.TLSCertFile != "" || o.TLSKeyFile != ""
+}
+
+func (o AuthOptions) validate() error {
+	if (o.TLSCertFile == "") != (o.TLSKeyFile == "") {
+		return errors.New("TLS certificate and key must be configured together")
+	}
+	if o.ClientCAFile != "" && !o.TLSEnabled() {
+		return errors.New("client CA (mutual TLS) requires a TLS certificate and key")
+	}
+	return nil
+}
+
+// Reasons a request can be rejected, used as keys of the rejection counters.
+const (
+	rejectMissingToken = "missing_token"
+	rejectInvalidToken = "invalid_token"
+	rejectMissingCert  = "missing_client_cert"
+	rejectInvalidCert  = "invalid_client_cert"
+)
+
+var rejectReasons = []string{rejectMissingToken, rejectInvalidToken, rejectMissingCert, rejectInvalidCert}
+
+// authenticator is HTTP middleware enforcing bearer tokens and/or client
+// certificates. Every rejection is logged and counted by reason; the
+// counters are exported as auth_rejections_total on the metrics endpoint.
+type authenticator struct {
+	tokens    [][]byte
+	clientCAs *x509.CertPool
+	log       *slog.Logger
+
+	mu       sync.Mutex
+	rejected map[string]uint64
+}
+
+// activeAuth is the authenticator guarding the http or sse transport, or
+// nil when authentication is off. The metrics exporter reads its counters.
+var activeAuth atomic.Pointer[authenticator]
+
+func newAuthenticator(opts AuthOptions) (*authenticator, error) {
+	a := &authenticator{log: slog.Default(), rejected: make(map[string]uint64)}
+	if opts.TokenFile != "" {
+		tokens, err := loadTokens(opts.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tokens {
+			a.tokens = append(a.tokens, []byte(t))
+		}
+	}
+	if opts.ClientCAFile != "" {
+		pool, err := loadCertPool(opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		a.clientCAs = pool
+	}
+	return a, nil
+}
+
+// loadTokens reads bearer tokens from path, one per line. Blank lines and
+// lines starting with # are ignored. An empty token file is an error, since
+// it would silently lock every client out.
+func loadTokens(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token file: %w", err)
+	}
+	defer f.Close()
+
+	var tokens []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("token file %s contains no tokens", path)
+	}
+	return tokens, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", path)
+	}
+	return pool, nil
+}
+
+// newTLSConfig builds the server TLS config. Client certificates are only
+// requested here and verified by the authenticator, so that bad or missing
+// certificates are rejected, logged and counted like any other auth failure
+// instead of disappearing as handshake errors.
+func newTLSConfig(opts AuthOptions) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if opts.ClientCAFile != "" {
+		cfg.ClientAuth = tls.RequestClientCert
+	}
+	return cfg, nil
+}
+
+func (a *authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.clientCAs != nil {
+			if reason := a.checkClientCert(r); reason != "" {
+				a.reject(w, r, reason)
+				return
+			}
+		}
+		if len(a.tokens) > 0 {
+			if reason := a.checkToken(r); reason != "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+ServerName+`"`)
+				a.reject(w, r, reason)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *authenticator) checkToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return rejectMissingToken
+	}
+	// Compare against every token so timing does not reveal which one matched.
+	match := 0
+	for _, t := range a.tokens {
+		match |= subtle.ConstantTimeCompare([]byte(token), t)
+	}
+	if match != 1 {
+		return rejectInvalidToken
+	}
+	return ""
+}
+
+func (a *authenticator) checkClientCert(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return rejectMissingCert
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := r.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         a.clientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return rejectInvalidCert
+	}
+	return ""
+}
+
+func (a *authenticator) reject(w http.ResponseWriter, r *http.Request, reason string) {
+	a.mu.Lock()
+	a.rejected[reason]++
+	total := a.rejected[reason]
+	a.mu.Unlock()
+
+	a.log.Warn("Auth rejected", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr, "reason", reason, "count", total)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// Rejected returns a snapshot of the rejection counters keyed by reason.
+func (a *authenticator) Rejected() map[string]uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make(map[string]uint64, len(a.rejected))
+	for k, v := range a.rejected {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadTokens(t *testing.T) {
+	t.Run("comments and blanks skipped", func(t *testing.T) {
+		path := writeTempFile(t, "tokens", "# agents\nalpha\n\n  beta  \n#gamma\n")
+		tokens, err := loadTokens(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"alpha", "beta"}, tokens)
+	})
+
+	t.Run("empty file rejected", func(t *testing.T) {
+		path := writeTempFile(t, "tokens", "# nothing here\n")
+		_, err := loadTokens(path)
+		assert.Error(t, err)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := loadTokens(filepath.Join(t.TempDir(), "nope"))
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthOptionsValidate(t *testing.T) {
+	assert.NoError(t, AuthOptions{}.validate())
+	assert.NoError(t, AuthOptions{TokenFile: "t"}.validate())
+	assert.Error(t, AuthOptions{TLSCertFile: "c"}.validate())
+	assert.Error(t, AuthOptions{ClientCAFile: "ca"}.validate())
+	assert.NoError(t, AuthOptions{TLSCertFile: "c", TLSKeyFile: "k", ClientCAFile: "ca"}.validate())
+}
+
+func TestBearerTokenMiddleware(t *testing.T) {
+	auth, err := newAuthenticator(AuthOptions{TokenFile: writeTempFile(t, "tokens", "s3cret\nother\n")})
+	require.NoError(t, err)
+	var logBuf bytes.Buffer
+	auth.log = slog.New(slog.NewTextHandler(&logBuf, nil))
+
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tc := range []struct {
+		name   string
+		header string
+		status int
+	}{
+		{"valid token", "Bearer s3cret", http.StatusNoContent},
+		{"second token", "bearer other", http.StatusNoContent},
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic s3cret", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+			if tc.status == http.StatusUnauthorized {
+				assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+
+	assert.Equal(t, map[string]uint64{rejectMissingToken: 2, rejectInvalidToken: 1}, auth.Rejected())
+	assert.Contains(t, logBuf.String(), `level=WARN msg="Auth rejected" method=POST path=/`)
+	assert.NotContains(t, logBuf.String(), "guess")
+}
+
+// testPKI is a throwaway CA with helpers to issue server and client certs.
+type testPKI struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestPKI(t *testing.T, cn string) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testPKI{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (p *testPKI) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.cert, &key.PublicKey, p.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMutualTLSMiddleware(t *testing.T) {
+	ca := newTestPKI(t, "test-ca")
+	rogue := newTestPKI(t, "rogue-ca")
+
+	auth, err := newAuthenticator(AuthOptions{ClientCAFile: writeTempFile(t, "ca.pem", string(ca.pem))})
+	require.NoError(t, err)
+	auth.log = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	srv := httptest.NewUnstartedServer(auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "server", x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequestClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs ...tls.Certificate) int {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: certs,
+			ServerName:   "localhost",
+		}}}
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusNoContent, get(ca.issue(t, "agent", x509.ExtKeyUsageClientAuth)))
+	assert.Equal(t, http.StatusUnauthorized, get())
+	assert.Equal(t, http.StatusUnauthorized, get(rogue.issue(t, "intruder", x509.ExtKeyUsageClientAuth)))
+	assert.Equal(t, http.StatusUnauthorized, get(ca.issue(t, "server-cert", x509.ExtKeyUsageServerAuth)))
+
+	assert.Equal(t, map[string]uint64{rejectMissingCert: 1, rejectInvalidCert: 2}, auth.Rejected())
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"testing"
+
+	"github.com/shirou/gopsutil/v3/process"
 )
 
 // Benchmark tests for performance measurement
@@ -47,10 +51,20 @@ func BenchmarkGetDiskInfo(b *testing.B) {
 	}
 }
 
+func BenchmarkGetDiskIO(b *testing.B) {
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		_, err := getDiskIO(ctx, "", 100)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkGetNetworkInfo(b *testing.B) {
 	ctx := context.Background()
 	for i := 0; i < b.N; i++ {
-		_, err := getNetworkInfo(ctx, "")
+		_, err := getNetworkInfo(ctx, "", 0)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -60,13 +74,63 @@ func BenchmarkGetNetworkInfo(b *testing.B) {
 func BenchmarkGetProcessInfo(b *testing.B) {
 	ctx := context.Background()
 	for i := 0; i < b.N; i++ {
-		_, err := getProcessInfo(ctx, 0, "", 5, "")
+		_, err := getProcessInfo(ctx, 0, "", 5, "", 100, false)
 		if err != nil {
 			b.Fatal(err)
 		}
 	}
 }
 
+func BenchmarkGetProcessInfoByMemory(b *testing.B) {
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		_, err := getProcessInfo(ctx, 0, "", 10, "memory", 100, false)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanProcessKeys(b *testing.B) {
+	ctx := context.Background()
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := scanProcessKeys(ctx, procs, "", "memory", 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkSelectTopProcesses ranks synthetic process tables the size of
+// busy hosts, which a test machine rarely has.
+func BenchmarkSelectTopProcesses(b *testing.B) {
+	for _, n := range []int{1000, 5000, 20000} {
+		rng := rand.New(rand.NewSource(int64(n)))
+		keys := make([]processKey, n)
+		for i := range keys {
+			keys[i] = processKey{
+				proc: &process.Process{Pid: int32(rng.Intn(4 << 20))},
+				name: fmt.Sprintf("proc-%d", rng.Intn(n)),
+				rss:  uint64(rng.Int63n(8 << 30)),
+				cpu:  rng.Float64() * 400,
+			}
+		}
+		for _, sortBy := range []string{"cpu", "memory", "pid", "name"} {
+			b.Run(fmt.Sprintf("%s/%d", sortBy, n), func(b *testing.B) {
+				work := make([]processKey, n)
+				for i := 0; i < b.N; i++ {
+					copy(work, keys)
+					selectTopProcesses(work, sortBy, 10)
+				}
+			})
+		}
+	}
+}
+
 func BenchmarkGetLoadAverage(b *testing.B) {
 	ctx := context.Background()
 	for i := 0; i < b.N; i++ {
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- cgroup v2 resource accounting ---
+
+// cgroupRoot is where the cgroup v2 hierarchy is looked for. On hybrid
+// systems the v2 tree is mounted at cgroupRoot/unified instead.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// PressureStat is one line of a PSI file: the share of wall time some (or
+// all) runnable tasks were stalled on a resource.
+type PressureStat struct {
+	Avg10     float64 `json:"avg10"` // percent over the last 10s
+	Avg60     float64 `json:"avg60"`
+	Avg300    float64 `json:"avg300"`
+	TotalUsec uint64  `json:"total_usec"` // cumulative stall time
+}
+
+type ResourcePressure struct {
+	Some PressureStat  `json:"some"`
+	Full *PressureStat `json:"full,omitempty"` // absent for CPU on older kernels
+}
+
+type CgroupPressure struct {
+	CPU    *ResourcePressure `json:"cpu,omitempty"`
+	Memory *ResourcePressure `json:"memory,omitempty"`
+	IO     *ResourcePressure `json:"io,omitempty"`
+}
+
+type CgroupMemory struct {
+	Current      uint64  `json:"current_bytes"`
+	Max          uint64  `json:"max_bytes,omitempty"`  // omitted when unlimited
+	High         uint64  `json:"high_bytes,omitempty"` // throttling threshold, omitted when unlimited
+	UsagePercent float64 `json:"usage_percent,omitempty"`
+	SwapCurrent  uint64  `json:"swap_current_bytes"`
+	SwapMax      uint64  `json:"swap_max_bytes,omitempty"`
+	OOMKills     uint64  `json:"oom_kills"` // from memory.events
+}
+
+type CgroupCPU struct {
+	UsageUsec        uint64  `json:"usage_usec"`
+	UserUsec         uint64  `json:"user_usec"`
+	SystemUsec       uint64  `json:"system_usec"`
+	NrPeriods        uint64  `json:"nr_periods"`
+	NrThrottled      uint64  `json:"nr_throttled"`
+	ThrottledUsec    uint64  `json:"throttled_usec"`
+	ThrottledPercent float64 `json:"throttled_percent"`     // share of enforcement periods that were throttled
+	QuotaUsec        uint64  `json:"quota_usec,omitempty"`  // cpu.max quota, omitted when unlimited
+	PeriodUsec       uint64  `json:"period_usec,omitempty"` // cpu.max period
+	LimitCores       float64 `json:"limit_cores,omitempty"` // quota / period
+	Weight           uint64  `json:"weight,omitempty"`      // cpu.weight
+	Cpuset           string  `json:"cpuset_cpus,omitempty"` // cpuset.cpus.effective
+}
+
+type CgroupIODevice struct {
+	Device     string `json:"device"` // major:minor
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadOps    uint64 `json:"read_ops"`
+	WriteOps   uint64 `json:"write_ops"`
+}
+
+type CgroupPIDs struct {
+	Current uint64 `json:"current"`
+	Max     uint64 `json:"max,omitempty"` // omitted when unlimited
+}
+
+type CgroupStats struct {
+	Path     string           `json:"path"` // relative to the hierarchy root, e.g. /system.slice/nginx.service
+	NumProcs int              `json:"num_procs"`
+	Memory   *CgroupMemory    `json:"memory,omitempty"`
+	CPU      *CgroupCPU       `json:"cpu,omitempty"`
+	IO       []CgroupIODevice `json:"io,omitempty"`
+	PIDs     *CgroupPIDs      `json:"pids,omitempty"`
+	Pressure *CgroupPressure  `json:"pressure,omitempty"`
+}
+
+type CgroupStatsResult struct {
+	Mount     string        `json:"mount"`                // where the v2 hierarchy was found
+	PIDCgroup string        `json:"pid_cgroup,omitempty"` // cgroup of the requested PID
+	Cgroups   []CgroupStats `json:"cgroups"`
+	Total     int           `json:"total"` // cgroups walked, before limit
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+type CgroupStatsArgs struct {
+	Path     string `json:"path,omitempty"`      // cgroup to start from, e.g. /system.slice; default the root
+	PID      int32  `json:"pid,omitempty"`       // start from the cgroup of this process instead
+	MaxDepth int    `json:"max_depth,omitempty"` // levels below the start to walk (default 2, max 10)
+	SortBy   string `json:"sort_by,omitempty"`   // memory|cpu|pids|path (default memory)
+	Limit    int    `json:"limit,omitempty"`     // max cgroups listed (default 50, max 1000)
+}
+
+// cgroupMount returns the directory holding the cgroup v2 hierarchy.
+func cgroupMount() (string, error) {
+	for _, dir := range []string{cgroupRoot, filepath.Join(cgroupRoot, "unified")} {
+		if _, err := os.Stat(filepath.Join(dir, "cgroup.controllers")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup v2 hierarchy found under %s", cgroupRoot)
+}
+
+// pidCgroup returns the cgroup v2 path of pid from /proc/<pid>/cgroup.
+func pidCgroup(pid int32) (string, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", fmt.Errorf("failed to read cgroup of process %d: %w", pid, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if p, ok := strings.CutPrefix(line, "0::"); ok {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("process %d is not in a cgroup v2 hierarchy", pid)
+}
+
+func getCgroupStats(start string, pid int32, maxDepth int, sortBy string, limit int) (CgroupStatsResult, error) {
+	if maxDepth <= 0 {
+		maxDepth = 2
+	}
+	if maxDepth > 10 {
+		maxDepth = 10
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+
+	mount, err := cgroupMount()
+	if err != nil {
+		return CgroupStatsResult{}, err
+	}
+	out := CgroupStatsResult{Mount: mount}
+	if pid > 0 {
+		if start, err = pidCgroup(pid); err != nil {
+			return CgroupStatsResult{}, err
+		}
+		out.PIDCgroup = start
+	}
+	start = path.Clean("/" + start)
+	startDir := filepath.Join(mount, filepath.FromSlash(start))
+	if fi, err := os.Stat(startDir); err != nil || !fi.IsDir() {
+		return CgroupStatsResult{}, fmt.Errorf("cgroup %s not found", start)
+	}
+
+	baseDepth := strings.Count(startDir, string(filepath.Separator))
+	err = filepath.WalkDir(startDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == startDir {
+				return err
+			}
+			return nil // cgroups come and go while we walk
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if strings.Count(p, string(filepath.Separator))-baseDepth > maxDepth {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(mount, p)
+		out.Cgroups = append(out.Cgroups, readCgroup(p, path.Clean("/"+filepath.ToSlash(rel))))
+		return nil
+	})
+	if err != nil {
+		return CgroupStatsResult{}, fmt.Errorf("failed to walk cgroups: %w", err)
+	}
+
+	sortCgroups(out.Cgroups, sortBy)
+	out.Total = len(out.Cgroups)
+	if len(out.Cgroups) > limit {
+		out.Cgroups = out.Cgroups[:limit]
+		out.Truncated = true
+	}
+	return out, nil
+}
+
+func sortCgroups(cgs []CgroupStats, sortBy string) {
+	var key func(c CgroupStats) uint64
+	switch strings.ToLower(sortBy) {
+	case "path":
+		sort.Slice(cgs, func(i, j int) bool { return cgs[i].Path < cgs[j].Path })
+		return
+	case "cpu":
+		key = func(c CgroupStats) uint64 {
+			if c.CPU == nil {
+				return 0
+			}
+			return c.CPU.UsageUsec
+		}
+	case "pids":
+		key = func(c CgroupStats) uint64 {
+			if c.PIDs == nil {
+				return 0
+			}
+			return c.PIDs.Current
+		}
+	default: // "memory"
+		key = func(c CgroupStats) uint64 {
+			if c.Memory == nil {
+				return 0
+			}
+			return c.Memory.Current
+		}
+	}
+	sort.SliceStable(cgs, func(i, j int) bool {
+		if ki, kj := key(cgs[i]), key(cgs[j]); ki != kj {
+			return ki > kj
+		}
+		return cgs[i].Path < cgs[j].Path
+	})
+}
+
+// readCgroup collects whatever the enabled controllers expose for dir.
+// Files a controller does not provide are skipped.
+func readCgroup(dir, rel string) CgroupStats {
+	cg := CgroupStats{Path: rel}
+	if data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs")); err == nil {
+		cg.NumProcs = len(strings.Fields(string(data)))
+	}
+
+	if cur, ok := readCgroupValue(dir, "memory.current"); ok {
+		m := &CgroupMemory{Current: cur}
+		m.Max, _ = readCgroupValue(dir, "memory.max")
+		m.High, _ = readCgroupValue(dir, "memory.high")
+		m.SwapCurrent, _ = readCgroupValue(dir, "memory.swap.current")
+		m.SwapMax, _ = readCgroupValue(dir, "memory.swap.max")
+		if ev, err := readCgroupKeyed(dir, "memory.events"); err == nil {
+			m.OOMKills = ev["oom_kill"]
+		}
+		if m.Max > 0 {
+			m.UsagePercent = float64(m.Current) / float64(m.Max) * 100
+		}
+		cg.Memory = m
+	}
+
+	if st, err := readCgroupKeyed(dir, "cpu.stat"); err == nil {
+		c := &CgroupCPU{
+			UsageUsec:     st["usage_usec"],
+			UserUsec:      st["user_usec"],
+			SystemUsec:    st["system_usec"],
+			NrPeriods:     st["nr_periods"],
+			NrThrottled:   st["nr_throttled"],
+			ThrottledUsec: st["throttled_usec"],
+		}
+		if c.NrPeriods > 0 {
+			c.ThrottledPercent = float64(c.NrThrottled) / float64(c.NrPeriods) * 100
+		}
+		c.QuotaUsec, c.PeriodUsec = readCPUMax(dir)
+		if c.QuotaUsec > 0 && c.PeriodUsec > 0 {
+			c.LimitCores = float64(c.QuotaUsec) / float64(c.PeriodUsec)
+		}
+		c.Weight, _ = readCgroupValue(dir, "cpu.weight")
+		if data, err := os.ReadFile(filepath.Join(dir, "cpuset.cpus.effective")); err == nil {
+			c.Cpuset = strings.TrimSpace(string(data))
+		}
+		cg.CPU = c
+	}
+
+	if f, err := os.Open(filepath.Join(dir, "io.stat")); err == nil {
+		cg.IO = parseIOStat(f)
+		f.Close()
+	}
+
+	if cur, ok := readCgroupValue(dir, "pids.current"); ok {
+		cg.PIDs = &CgroupPIDs{Current: cur}
+		cg.PIDs.Max, _ = readCgroupValue(dir, "pids.max")
+	}
+
+	p := &CgroupPressure{
+		CPU:    readPressureFile(filepath.Join(dir, "cpu.pressure")),
+		Memory: readPressureFile(filepath.Join(dir, "memory.pressure")),
+		IO:     readPressureFile(filepath.Join(dir, "io.pressure")),
+	}
+	if p.CPU != nil || p.Memory != nil || p.IO != nil {
+		cg.Pressure = p
+	}
+	return cg
+}
+
+// readCgroupValue reads a single-number file. "max" reads as 0, meaning
+// unlimited; ok is false if the file is missing or malformed.
+func readCgroupValue(dir, name string) (uint64, bool) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return 0, false
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, true
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// readCgroupKeyed reads a flat keyed file such as cpu.stat or memory.events.
+func readCgroupKeyed(dir, name string) (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			out[fields[0]] = v
+		}
+	}
+	return out, sc.Err()
+}
+
+// readCPUMax parses cpu.max ("$QUOTA $PERIOD", quota may be "max").
+func readCPUMax(dir string) (quota, period uint64) {
+	data, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+	if err != nil {
+		return 0, 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return 0, 0
+	}
+	period, _ = strconv.ParseUint(fields[1], 10, 64)
+	if fields[0] == "max" {
+		return 0, period
+	}
+	quota, _ = strconv.ParseUint(fields[0], 10, 64)
+	return quota, period
+}
+
+// parseIOStat parses lines such as
+// "8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0".
+func parseIOStat(r io.Reader) []CgroupIODevice {
+	var out []CgroupIODevice
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		d := CgroupIODevice{Device: fields[0]}
+		for _, kv := range fields[1:] {
+			k, v, _ := strings.Cut(kv, "=")
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch k {
+			case "rbytes":
+				d.ReadBytes = n
+			case "wbytes":
+				d.WriteBytes = n
+			case "rios":
+				d.ReadOps = n
+			case "wios":
+				d.WriteOps = n
+			}
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func readPressureFile(name string) *ResourcePressure {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	p, err := parsePressure(f)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// parsePressure parses PSI output such as
+//
+//	some avg10=0.00 avg60=0.12 avg300=0.05 total=123456
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressure(r io.Reader) (*ResourcePressure, error) {
+	var out ResourcePressure
+	var sawSome bool
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var st PressureStat
+		for _, kv := range fields[1:] {
+			k, v, _ := strings.Cut(kv, "=")
+			switch k {
+			case "avg10":
+				st.Avg10, _ = strconv.ParseFloat(v, 64)
+			case "avg60":
+				st.Avg60, _ = strconv.ParseFloat(v, 64)
+			case "avg300":
+				st.Avg300, _ = strconv.ParseFloat(v, 64)
+			case "total":
+				st.TotalUsec, _ = strconv.ParseUint(v, 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			out.Some = st
+			sawSome = true
+		case "full":
+			out.Full = &st
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if !sawSome {
+		return nil, errors.New("no \"some\" line in pressure data")
+	}
+	return &out, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCgroupTree builds a small cgroup v2 hierarchy and points cgroupRoot at it.
+func fakeCgroupTree(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	saved := cgroupRoot
+	cgroupRoot = root
+	t.Cleanup(func() { cgroupRoot = saved })
+
+	files := map[string]string{
+		"cgroup.controllers": "cpuset cpu io memory pids\n",
+		"cgroup.procs":       "1\n",
+		"cpu.pressure":       "some avg10=1.50 avg60=0.75 avg300=0.10 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+
+		"system.slice/cgroup.procs":   "",
+		"system.slice/memory.current": "3000\n",
+		"system.slice/memory.max":     "max\n",
+
+		"system.slice/web.service/cgroup.procs":          "100\n101\n102\n",
+		"system.slice/web.service/memory.current":        "2000\n",
+		"system.slice/web.service/memory.max":            "4000\n",
+		"system.slice/web.service/memory.high":           "max\n",
+		"system.slice/web.service/memory.swap.current":   "10\n",
+		"system.slice/web.service/memory.events":         "low 0\nhigh 0\nmax 4\noom 1\noom_kill 1\n",
+		"system.slice/web.service/cpu.stat":              "usage_usec 5000\nuser_usec 3000\nsystem_usec 2000\nnr_periods 100\nnr_throttled 25\nthrottled_usec 900\n",
+		"system.slice/web.service/cpu.max":               "50000 100000\n",
+		"system.slice/web.service/cpu.weight":            "100\n",
+		"system.slice/web.service/cpuset.cpus.effective": "0-3\n",
+		"system.slice/web.service/io.stat":               "8:0 rbytes=1024 wbytes=2048 rios=3 wios=4 dbytes=0 dios=0\n",
+		"system.slice/web.service/pids.current":          "3\n",
+		"system.slice/web.service/pids.max":              "max\n",
+		"system.slice/web.service/memory.pressure":       "some avg10=12.00 avg60=5.00 avg300=1.00 total=999\nfull avg10=2.00 avg60=1.00 avg300=0.50 total=111\n",
+
+		"system.slice/web.service/worker/cgroup.procs":   "103\n",
+		"system.slice/web.service/worker/memory.current": "500\n",
+
+		"user.slice/cgroup.procs":   "200\n",
+		"user.slice/memory.current": "1000\n",
+		"user.slice/cpu.stat":       "usage_usec 90000\nuser_usec 1\nsystem_usec 1\n",
+		"user.slice/cpu.max":        "max 100000\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	return root
+}
+
+func TestGetCgroupStats(t *testing.T) {
+	root := fakeCgroupTree(t)
+
+	t.Run("walk from root", func(t *testing.T) {
+		out, err := getCgroupStats("", 0, 0, "", 0)
+		require.NoError(t, err)
+		assert.Equal(t, root, out.Mount)
+		assert.Equal(t, 4, out.Total) // worker is three levels down
+		var paths []string
+		for _, c := range out.Cgroups {
+			paths = append(paths, c.Path)
+		}
+		assert.Equal(t, []string{"/system.slice", "/system.slice/web.service", "/user.slice", "/"}, paths)
+
+		rootCg := out.Cgroups[3]
+		require.NotNil(t, rootCg.Pressure)
+		require.NotNil(t, rootCg.Pressure.CPU)
+		assert.Equal(t, 1.5, rootCg.Pressure.CPU.Some.Avg10)
+		assert.Equal(t, uint64(123456), rootCg.Pressure.CPU.Some.TotalUsec)
+		assert.Nil(t, rootCg.Memory)
+	})
+
+	t.Run("service details", func(t *testing.T) {
+		out, err := getCgroupStats("/system.slice/web.service", 0, 1, "path", 0)
+		require.NoError(t, err)
+		require.Len(t, out.Cgroups, 2)
+		web := out.Cgroups[0]
+		assert.Equal(t, "/system.slice/web.service", web.Path)
+		assert.Equal(t, 3, web.NumProcs)
+
+		require.NotNil(t, web.Memory)
+		assert.Equal(t, CgroupMemory{Current: 2000, Max: 4000, UsagePercent: 50, SwapCurrent: 10, OOMKills: 1}, *web.Memory)
+
+		require.NotNil(t, web.CPU)
+		assert.Equal(t, uint64(5000), web.CPU.UsageUsec)
+		assert.Equal(t, float64(25), web.CPU.ThrottledPercent)
+		assert.Equal(t, 0.5, web.CPU.LimitCores)
+		assert.Equal(t, "0-3", web.CPU.Cpuset)
+
+		assert.Equal(t, []CgroupIODevice{{Device: "8:0", ReadBytes: 1024, WriteBytes: 2048, ReadOps: 3, WriteOps: 4}}, web.IO)
+		assert.Equal(t, &CgroupPIDs{Current: 3}, web.PIDs)
+
+		require.NotNil(t, web.Pressure.Memory.Full)
+		assert.Equal(t, float64(2), web.Pressure.Memory.Full.Avg10)
+	})
+
+	t.Run("sort and limit", func(t *testing.T) {
+		out, err := getCgroupStats("/", 0, 5, "cpu", 1)
+		require.NoError(t, err)
+		require.Len(t, out.Cgroups, 1)
+		assert.Equal(t, "/user.slice", out.Cgroups[0].Path)
+		assert.Equal(t, 5, out.Total)
+		assert.True(t, out.Truncated)
+		assert.Zero(t, out.Cgroups[0].CPU.QuotaUsec, "max quota is unlimited")
+	})
+
+	t.Run("pid mapping", func(t *testing.T) {
+		own, err := pidCgroup(int32(os.Getpid()))
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Join(root, filepath.FromSlash(own)), 0o755))
+
+		out, err := getCgroupStats("", int32(os.Getpid()), 0, "", 0)
+		require.NoError(t, err)
+		assert.Equal(t, own, out.PIDCgroup)
+	})
+
+	t.Run("hybrid hierarchy", func(t *testing.T) {
+		hybrid := t.TempDir()
+		unified := filepath.Join(hybrid, "unified")
+		require.NoError(t, os.MkdirAll(unified, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(unified, "cgroup.controllers"), nil, 0o644))
+		cgroupRoot = hybrid
+		defer func() { cgroupRoot = root }()
+
+		out, err := getCgroupStats("", 0, 0, "", 0)
+		require.NoError(t, err)
+		assert.Equal(t, unified, out.Mount)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := getCgroupStats("/nope", 0, 0, "", 0)
+		assert.Error(t, err)
+		_, err = getCgroupStats("", 1<<30, 0, "", 0)
+		assert.Error(t, err)
+
+		cgroupRoot = t.TempDir()
+		_, err = getCgroupStats("", 0, 0, "", 0)
+		assert.ErrorContains(t, err, "no cgroup v2 hierarchy")
+	})
+}
+
+func TestParsePressure(t *testing.T) {
+	p, err := parsePressure(strings.NewReader("some avg10=0.31 avg60=0.12 avg300=0.05 total=7\n"))
+	require.NoError(t, err)
+	assert.Equal(t, PressureStat{Avg10: 0.31, Avg60: 0.12, Avg300: 0.05, TotalUsec: 7}, p.Some)
+	assert.Nil(t, p.Full)
+
+	_, err = parsePressure(strings.NewReader(""))
+	assert.Error(t, err)
+}
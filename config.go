@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Configuration file ---
+
+// ConfigEnvVar names the environment variable consulted for the config file
+// path when --config is not given.
+const ConfigEnvVar = "POSIX_SYSTEM_MCP_CONFIG"
+
+// Config is the YAML configuration file. Every field is optional; anything
+// left out keeps the value from DefaultConfig. Command line flags that are
+// given explicitly take precedence over the file.
+//
+//	transport:
+//	  type: http
+//	  addr: 0.0.0.0:8080
+//	  auth:
+//	    token_file: /etc/posix-system-mcp/tokens
+//	tools:
+//	  get_process_info: false
+//	limits:
+//	  process_limit_max: 50
+//	  cpu_interval_default_ms: 500
+//	redaction:
+//	  patterns: ['corp-[0-9a-f]{32}']
+//	  hide_usernames: true
+//	sampler:
+//	  interval_ms: 5000
+//	  history_size: 720
+//	control:
+//	  enabled: true
+//	  allowed_users: [app]
+//	  allowed_names: ['node', 'worker-.*']
+//	logs:
+//	  allowed_dirs: [/var/log, /srv/app/logs]
+//	diagnose:
+//	  disk_used_percent: {warning: 80, critical: 90}
+//	alerts:
+//	  rules:
+//	    - expr: memory.used_percent > 95 for 60s
+//	      severity: critical
+//	resources:
+//	  poll_interval_ms: 2000
+//	metrics:
+//	  enabled: true
+//	  addr: 0.0.0.0:9464
+//	telemetry:
+//	  exporter: otlp
+//	  endpoint: http://otel-collector:4318
+//	logging:
+//	  level: debug
+//	  format: json
+type Config struct {
+	Transport TransportConfig `yaml:"transport"`
+	Tools     map[string]bool `yaml:"tools"` // tool name -> enabled; unlisted tools keep their default
+	Limits    Limits          `yaml:"limits"`
+	Redaction RedactionConfig `yaml:"redaction"`
+	Sampler   SamplerConfig   `yaml:"sampler"`
+	Control   ControlConfig   `yaml:"control"`
+	Logs      LogsConfig      `yaml:"logs"`
+	Diagnose  DiagnoseConfig  `yaml:"diagnose"`
+	Alerts    AlertsConfig    `yaml:"alerts"`
+	Resources ResourcesConfig `yaml:"resources"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Telemetry TelemetryConfig `yaml:"telemetry"`
+	Logging   LoggingConfig   `yaml:"logging"`
+}
+
+type TransportConfig struct {
+	Type string      `yaml:"type"` // stdio|http|sse
+	Addr string      `yaml:"addr"` // listen address for http and sse
+	Auth AuthOptions `yaml:"auth"`
+}
+
+// Limits bounds the arguments tool callers may pass.
+type Limits struct {
+	ProcessLimitDefault  int `yaml:"process_limit_default"`   // get_process_info limit when none is given
+	ProcessLimitMax      int `yaml:"process_limit_max"`       // largest accepted get_process_info limit
+	CPUIntervalDefaultMs int `yaml:"cpu_interval_default_ms"` // get_cpu_info window when none is given
+	CPUIntervalMinMs     int `yaml:"cpu_interval_min_ms"`     // shortest accepted get_cpu_info window
+	CPUIntervalMaxMs     int `yaml:"cpu_interval_max_ms"`     // longest accepted get_cpu_info window
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Transport: TransportConfig{Type: TransportStdio, Addr: DefaultListenAddr},
+		Limits:    DefaultLimits(),
+		Sampler:   DefaultSamplerConfig(),
+		Control:   DefaultControlConfig(),
+		Logs:      DefaultLogsConfig(),
+		Diagnose:  DefaultDiagnoseConfig(),
+		Alerts:    DefaultAlertsConfig(),
+		Resources: DefaultResourcesConfig(),
+		Metrics:   DefaultMetricsConfig(),
+		Telemetry: DefaultTelemetryConfig(),
+		Logging:   DefaultLoggingConfig(),
+	}
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		ProcessLimitDefault:  10,
+		ProcessLimitMax:      200,
+		CPUIntervalDefaultMs: 1000,
+		CPUIntervalMinMs:     100,
+		CPUIntervalMaxMs:     10000,
+	}
+}
+
+// limits holds the active Limits; main replaces it with the loaded config.
+var limits = DefaultLimits()
+
+// LoadConfig reads and validates the config file at path. Unknown keys are
+// errors so that typos fail at startup rather than being silently ignored.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parseConfig(data []byte) (Config, error) {
+	cfg := DefaultConfig()
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, err
+	}
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	switch c.Transport.Type {
+	case TransportStdio, TransportHTTP, TransportSSE:
+	default:
+		return fmt.Errorf("transport.type %q is invalid (want stdio, http or sse)", c.Transport.Type)
+	}
+	if err := c.Transport.Auth.validate(); err != nil {
+		return err
+	}
+	if _, err := NewRedactor(c.Redaction); err != nil {
+		return fmt.Errorf("redaction: %w", err)
+	}
+	if err := c.Sampler.validate(); err != nil {
+		return err
+	}
+	if err := c.Control.validate(); err != nil {
+		return err
+	}
+	if err := c.Logs.validate(); err != nil {
+		return err
+	}
+	if err := c.Diagnose.validate(); err != nil {
+		return err
+	}
+	if err := c.Alerts.validate(); err != nil {
+		return err
+	}
+	if len(c.Alerts.Rules) > 0 && !c.Sampler.Enabled {
+		return fmt.Errorf("alerts.rules need the background sampler; set sampler.enabled")
+	}
+	if err := c.Resources.validate(); err != nil {
+		return err
+	}
+	if err := c.Metrics.validate(c.Limits.ProcessLimitMax); err != nil {
+		return err
+	}
+	if err := c.Telemetry.validate(); err != nil {
+		return err
+	}
+	if err := c.Logging.validate(); err != nil {
+		return err
+	}
+	if c.Metrics.Enabled && c.Transport.Type != TransportStdio && c.Metrics.Addr == c.Transport.Addr {
+		return fmt.Errorf("metrics.addr %s is also the %s transport's address", c.Metrics.Addr, c.Transport.Type)
+	}
+	return c.Limits.validate()
+}
+
+func (l Limits) validate() error {
+	if l.ProcessLimitMax < 1 {
+		return fmt.Errorf("limits.process_limit_max must be at least 1, got %d", l.ProcessLimitMax)
+	}
+	if l.ProcessLimitDefault < 1 || l.ProcessLimitDefault > l.ProcessLimitMax {
+		return fmt.Errorf("limits.process_limit_default must be within 1..%d, got %d", l.ProcessLimitMax, l.ProcessLimitDefault)
+	}
+	if l.CPUIntervalMinMs < 1 || l.CPUIntervalMinMs > l.CPUIntervalMaxMs {
+		return fmt.Errorf("limits.cpu_interval_min_ms must be within 1..cpu_interval_max_ms, got %d", l.CPUIntervalMinMs)
+	}
+	if l.CPUIntervalDefaultMs < l.CPUIntervalMinMs || l.CPUIntervalDefaultMs > l.CPUIntervalMaxMs {
+		return fmt.Errorf("limits.cpu_interval_default_ms must be within %d..%d, got %d", l.CPUIntervalMinMs, l.CPUIntervalMaxMs, l.CPUIntervalDefaultMs)
+	}
+	return nil
+}
+
+// ToolEnabled reports whether the named tool should be registered.
+func (c *Config) ToolEnabled(name string) bool {
+	if c == nil {
+		return true
+	}
+	enabled, ok := c.Tools[name]
+	return !ok || enabled
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Run("empty file keeps defaults", func(t *testing.T) {
+		cfg, err := parseConfig(nil)
+		require.NoError(t, err)
+		assert.Equal(t, DefaultConfig(), cfg)
+	})
+
+	t.Run("partial overrides", func(t *testing.T) {
+		cfg, err := parseConfig([]byte(`
+transport:
+  type: http
+  addr: 0.0.0.0:9090
+  auth:
+    token_file: /etc/tokens
+tools:
+  get_process_info: false
+limits:
+  process_limit_max: 50
+  cpu_interval_default_ms: 500
+`))
+		require.NoError(t, err)
+		assert.Equal(t, TransportHTTP, cfg.Transport.Type)
+		assert.Equal(t, "0.0.0.0:9090", cfg.Transport.Addr)
+		assert.Equal(t, "/etc/tokens", cfg.Transport.Auth.TokenFile)
+		assert.False(t, cfg.ToolEnabled("get_process_info"))
+		assert.True(t, cfg.ToolEnabled("get_cpu_info"))
+		assert.Equal(t, 50, cfg.Limits.ProcessLimitMax)
+		assert.Equal(t, 10, cfg.Limits.ProcessLimitDefault)
+		assert.Equal(t, 500, cfg.Limits.CPUIntervalDefaultMs)
+	})
+
+	for name, doc := range map[string]string{
+		"unknown key":          "limits:\n  process_limit: 5\n",
+		"bad transport":        "transport:\n  type: grpc\n",
+		"key without cert":     "transport:\n  auth:\n    tls_key: k.pem\n",
+		"default above max":    "limits:\n  process_limit_default: 300\n",
+		"min above max":        "limits:\n  cpu_interval_min_ms: 20000\n",
+		"default below min":    "limits:\n  cpu_interval_default_ms: 50\n",
+		"wrong type":           "tools:\n  get_cpu_info: sometimes\n",
+		"malformed yaml":       "transport: [\n",
+		"non-positive maximum": "limits:\n  process_limit_max: 0\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseConfig([]byte(doc))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadConfigAndFlags(t *testing.T) {
+	path := writeTempFile(t, "config.yaml", "transport:\n  type: sse\n  addr: 127.0.0.1:7000\n")
+
+	t.Run("from --config", func(t *testing.T) {
+		opts, err := parseFlags([]string{"--config", path})
+		require.NoError(t, err)
+		assert.Equal(t, path, opts.ConfigPath)
+		assert.Equal(t, TransportSSE, opts.Config.Transport.Type)
+		assert.Equal(t, "127.0.0.1:7000", opts.Config.Transport.Addr)
+	})
+
+	t.Run("from environment", func(t *testing.T) {
+		t.Setenv(ConfigEnvVar, path)
+		opts, err := parseFlags(nil)
+		require.NoError(t, err)
+		assert.Equal(t, TransportSSE, opts.Config.Transport.Type)
+	})
+
+	t.Run("explicit flags win", func(t *testing.T) {
+		opts, err := parseFlags([]string{"--config", path, "--transport=http"})
+		require.NoError(t, err)
+		assert.Equal(t, TransportHTTP, opts.Config.Transport.Type)
+		assert.Equal(t, "127.0.0.1:7000", opts.Config.Transport.Addr)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := parseFlags([]string{"--config", path + ".missing"})
+		assert.Error(t, err)
+	})
+}
+
+func TestRegisterToolsConfig(t *testing.T) {
+	newServer := func() *mcp.Server {
+		return mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, nil)
+	}
+
+	t.Run("disabled tool is not served", func(t *testing.T) {
+		server := newServer()
+		cfg := DefaultConfig()
+		cfg.Tools = map[string]bool{"get_process_info": false}
+		require.NoError(t, registerTools(server, &cfg))
+
+		names := listToolNames(t, server)
+		assert.NotContains(t, names, "get_process_info")
+		assert.Contains(t, names, "get_cpu_info")
+	})
+
+	t.Run("unknown tool name fails", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Tools = map[string]bool{"get_gpu_info": true}
+		assert.Error(t, registerTools(newServer(), &cfg))
+	})
+}
+
+// listToolNames connects an in-memory client to server and lists its tools.
+func listToolNames(t *testing.T, server *mcp.Server) []string {
+	t.Helper()
+	ctx := context.Background()
+	serverT, clientT := mcp.NewInMemoryTransports()
+	_, err := server.Connect(ctx, serverT, nil)
+	require.NoError(t, err)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.0.1"}, nil)
+	session, err := client.Connect(ctx, clientT, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	tools, err := session.ListTools(ctx, nil)
+	require.NoError(t, err)
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestConfiguredLimits(t *testing.T) {
+	saved := limits
+	defer func() { limits = saved }()
+
+	limits.ProcessLimitDefault = 2
+	limits.ProcessLimitMax = 3
+
+	result, err := getProcessInfo(context.Background(), 0, "", 0, "pid", 100, false)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, result.Count, 2)
+
+	result, err = getProcessInfo(context.Background(), 0, "", 100, "pid", 100, false)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, result.Count, 3)
+}
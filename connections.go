@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// --- System-wide socket inventory ---
+
+type ConnectionsResult struct {
+	Total       int              `json:"total"`    // sockets matching the filters
+	ByState     map[string]int   `json:"by_state"` // matching sockets per state; connectionless sockets count as NONE
+	ByType      map[string]int   `json:"by_type"`  // matching sockets per tcp|udp|unix
+	Connections []ConnectionInfo `json:"connections"`
+	Truncated   bool             `json:"truncated,omitempty"` // more sockets matched than limit
+}
+
+type ConnectionsArgs struct {
+	Protocol string `json:"protocol,omitempty"` // tcp|tcp4|tcp6|udp|udp4|udp6|unix|inet|inet4|inet6|all (default all)
+	Port     int    `json:"port,omitempty"`     // local or remote port
+	State    string `json:"state,omitempty"`    // TCP state such as LISTEN, ESTABLISHED or TIME_WAIT
+	PID      int32  `json:"pid,omitempty"`      // owning process
+	Limit    int    `json:"limit,omitempty"`    // max sockets listed (default 200, max 5000); counts cover all matches
+}
+
+var connectionKinds = map[string]bool{
+	"all": true, "inet": true, "inet4": true, "inet6": true,
+	"tcp": true, "tcp4": true, "tcp6": true,
+	"udp": true, "udp4": true, "udp6": true,
+	"unix": true,
+}
+
+func getConnections(ctx context.Context, protocol string, port int, state string, pid int32, limit int) (ConnectionsResult, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	if limit > 5000 {
+		limit = 5000
+	}
+	kind := strings.ToLower(protocol)
+	if kind == "" {
+		kind = "all"
+	}
+	if !connectionKinds[kind] {
+		return ConnectionsResult{}, fmt.Errorf("invalid protocol %q (want tcp, tcp4, tcp6, udp, udp4, udp6, unix, inet, inet4, inet6 or all)", protocol)
+	}
+	if port < 0 || port > 65535 {
+		return ConnectionsResult{}, fmt.Errorf("invalid port %d", port)
+	}
+	state = strings.ToUpper(state)
+
+	var conns []psnet.ConnectionStat
+	var err error
+	if pid > 0 {
+		conns, err = psnet.ConnectionsPidWithContext(ctx, kind, pid)
+	} else {
+		conns, err = psnet.ConnectionsWithContext(ctx, kind)
+	}
+	if err != nil {
+		return ConnectionsResult{}, fmt.Errorf("failed to list connections: %w", err)
+	}
+
+	out := ConnectionsResult{ByState: make(map[string]int), ByType: make(map[string]int)}
+	var matched []ConnectionInfo
+	for _, c := range conns {
+		info := connectionInfo(c)
+		info.PID = c.Pid
+		if port != 0 && (info.Type == "unix" || (c.Laddr.Port != uint32(port) && c.Raddr.Port != uint32(port))) {
+			continue
+		}
+		s := info.Status
+		if s == "" {
+			s = "NONE"
+		}
+		if state != "" && s != state {
+			continue
+		}
+		out.Total++
+		out.ByState[s]++
+		out.ByType[info.Type]++
+		matched = append(matched, info)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.LocalAddr != b.LocalAddr {
+			return a.LocalAddr < b.LocalAddr
+		}
+		return a.RemoteAddr < b.RemoteAddr
+	})
+	if len(matched) > limit {
+		matched = matched[:limit]
+		out.Truncated = true
+	}
+
+	// Name the owning processes of the listed sockets only.
+	names := make(map[int32]string)
+	for i := range matched {
+		p := matched[i].PID
+		if p <= 0 {
+			continue // e.g. TIME_WAIT sockets, or owned by another user's process
+		}
+		name, ok := names[p]
+		if !ok {
+			if proc, err := process.NewProcessWithContext(ctx, p); err == nil {
+				name, _ = proc.NameWithContext(ctx)
+			}
+			names[p] = name
+		}
+		matched[i].Process = name
+	}
+	out.Connections = matched
+	if out.Connections == nil {
+		out.Connections = []ConnectionInfo{}
+	}
+	return out, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConnections(t *testing.T) {
+	ctx := context.Background()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := ln.Accept()
+	require.NoError(t, err)
+	defer server.Close()
+
+	t.Run("listening port", func(t *testing.T) {
+		out, err := getConnections(ctx, "tcp", port, "listen", 0, 0)
+		require.NoError(t, err)
+		require.Len(t, out.Connections, 1)
+		c := out.Connections[0]
+		assert.Equal(t, ln.Addr().String(), c.LocalAddr)
+		assert.Equal(t, "LISTEN", c.Status)
+		assert.Equal(t, int32(os.Getpid()), c.PID)
+		assert.NotEmpty(t, c.Process)
+		assert.Equal(t, map[string]int{"LISTEN": 1}, out.ByState)
+	})
+
+	t.Run("port matches both ends", func(t *testing.T) {
+		out, err := getConnections(ctx, "tcp4", port, "", 0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 3, out.Total) // listener, accepted side, client side
+		assert.Equal(t, 2, out.ByState["ESTABLISHED"])
+		assert.Equal(t, 3, out.ByType["tcp"])
+	})
+
+	t.Run("by pid", func(t *testing.T) {
+		out, err := getConnections(ctx, "", 0, "", int32(os.Getpid()), 0)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, out.Total, 3)
+		for _, c := range out.Connections {
+			assert.Equal(t, int32(os.Getpid()), c.PID)
+		}
+	})
+
+	t.Run("limit keeps counts", func(t *testing.T) {
+		out, err := getConnections(ctx, "tcp", port, "", 0, 1)
+		require.NoError(t, err)
+		assert.Len(t, out.Connections, 1)
+		assert.True(t, out.Truncated)
+		assert.Equal(t, 3, out.Total)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		out, err := getConnections(ctx, "udp", port, "", 0, 0)
+		require.NoError(t, err)
+		assert.Zero(t, out.Total)
+		assert.NotNil(t, out.Connections)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := getConnections(ctx, "sctp", 0, "", 0, 0)
+		assert.Error(t, err)
+		_, err = getConnections(ctx, "", 70000, "", 0, 0)
+		assert.ErrorContains(t, err, strconv.Itoa(70000))
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Limits of the cgroup the server runs in ---
+
+// MemoryLimit is the memory limit of the server's own cgroup, set when it
+// is tighter than the host's RAM, as in a container or a limited systemd
+// slice.
+type MemoryLimit struct {
+	Cgroup         string  `json:"cgroup"`
+	LimitBytes     uint64  `json:"limit_bytes"` // tightest memory.max of the cgroup and its ancestors
+	UsageBytes     uint64  `json:"usage_bytes"` // memory.current
+	UsagePercent   float64 `json:"usage_percent"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	SwapLimitBytes uint64  `json:"swap_limit_bytes,omitempty"` // memory.swap.max, omitted when unlimited
+}
+
+// CPULimit is the CPU allowance of the server's own cgroup, set when a
+// cpu.max quota or cpuset leaves it fewer CPUs than the host has.
+type CPULimit struct {
+	Cgroup         string  `json:"cgroup"`
+	QuotaUsec      uint64  `json:"quota_usec,omitempty"` // tightest cpu.max of the cgroup and its ancestors
+	PeriodUsec     uint64  `json:"period_usec,omitempty"`
+	QuotaCores     float64 `json:"quota_cores,omitempty"` // quota / period
+	Cpuset         string  `json:"cpuset_cpus,omitempty"`
+	CpusetCount    int     `json:"cpuset_count,omitempty"`
+	EffectiveCores float64 `json:"effective_cores"`             // the smaller of quota_cores, cpuset_count and the host count
+	UsagePercent   float64 `json:"usage_percent,omitempty"`     // cgroup CPU time over the sampling window against effective_cores
+	ThrottledCount uint64  `json:"throttled_periods,omitempty"` // cumulative nr_throttled
+}
+
+// ownCgroup returns the cgroup v2 mount and the server process's path
+// within it. ok is false when there is no v2 hierarchy or the cgroup is not
+// visible from here.
+func ownCgroup() (mount, rel string, ok bool) {
+	mount, err := cgroupMount()
+	if err != nil {
+		return "", "", false
+	}
+	rel, err = pidCgroup(int32(os.Getpid()))
+	if err != nil {
+		return "", "", false
+	}
+	rel = path.Clean("/" + rel)
+	if fi, err := os.Stat(filepath.Join(mount, filepath.FromSlash(rel))); err != nil || !fi.IsDir() {
+		return "", "", false
+	}
+	return mount, rel, true
+}
+
+// cgroupAncestors returns dir and each parent up to and including mount.
+func cgroupAncestors(mount, dir string) []string {
+	dirs := []string{dir}
+	for dir != mount && strings.HasPrefix(dir, mount) {
+		dir = filepath.Dir(dir)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// readMemoryLimit reports the effective memory limit of the cgroup at rel
+// under mount, or nil if neither it nor an ancestor sets one below hostTotal.
+func readMemoryLimit(mount, rel string, hostTotal uint64) *MemoryLimit {
+	dir := filepath.Join(mount, filepath.FromSlash(rel))
+	var limit uint64
+	for _, d := range cgroupAncestors(mount, dir) {
+		if v, ok := readCgroupValue(d, "memory.max"); ok && v > 0 && (limit == 0 || v < limit) {
+			limit = v
+		}
+	}
+	if limit == 0 || (hostTotal > 0 && limit >= hostTotal) {
+		return nil
+	}
+	m := &MemoryLimit{Cgroup: rel, LimitBytes: limit}
+	m.UsageBytes, _ = readCgroupValue(dir, "memory.current")
+	m.SwapLimitBytes, _ = readCgroupValue(dir, "memory.swap.max")
+	m.UsagePercent = float64(m.UsageBytes) / float64(limit) * 100
+	if m.UsageBytes < limit {
+		m.AvailableBytes = limit - m.UsageBytes
+	}
+	return m
+}
+
+// readCPULimit reports the effective CPU allowance of the cgroup at rel
+// under mount, or nil if it can use all hostCount CPUs.
+func readCPULimit(mount, rel string, hostCount int) *CPULimit {
+	dir := filepath.Join(mount, filepath.FromSlash(rel))
+	c := &CPULimit{Cgroup: rel, EffectiveCores: float64(hostCount)}
+	for _, d := range cgroupAncestors(mount, dir) {
+		quota, period := readCPUMax(d)
+		if quota == 0 || period == 0 {
+			continue
+		}
+		if cores := float64(quota) / float64(period); c.QuotaCores == 0 || cores < c.QuotaCores {
+			c.QuotaUsec, c.PeriodUsec, c.QuotaCores = quota, period, cores
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "cpuset.cpus.effective")); err == nil {
+		c.Cpuset = strings.TrimSpace(string(data))
+		c.CpusetCount = cpusetCount(c.Cpuset)
+	}
+
+	if c.QuotaCores > 0 && c.QuotaCores < c.EffectiveCores {
+		c.EffectiveCores = c.QuotaCores
+	}
+	if c.CpusetCount > 0 && float64(c.CpusetCount) < c.EffectiveCores {
+		c.EffectiveCores = float64(c.CpusetCount)
+	}
+	if c.EffectiveCores >= float64(hostCount) {
+		return nil
+	}
+	if st, err := readCgroupKeyed(dir, "cpu.stat"); err == nil {
+		c.ThrottledCount = st["nr_throttled"]
+	}
+	return c
+}
+
+// cpusetCount counts the CPUs in a list such as "0-3,8,10-11".
+func cpusetCount(list string) int {
+	n := 0
+	for _, part := range strings.Split(list, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		if !isRange {
+			if _, err := strconv.Atoi(lo); err == nil {
+				n++
+			}
+			continue
+		}
+		a, err1 := strconv.Atoi(lo)
+		b, err2 := strconv.Atoi(hi)
+		if err1 == nil && err2 == nil && b >= a {
+			n += b - a + 1
+		}
+	}
+	return n
+}
+
+// cgroupCPUUsage returns the cumulative CPU time of the cgroup at dir.
+func cgroupCPUUsage(dir string) (time.Duration, bool) {
+	st, err := readCgroupKeyed(dir, "cpu.stat")
+	if err != nil {
+		return 0, false
+	}
+	usec, ok := st["usage_usec"]
+	return time.Duration(usec) * time.Microsecond, ok
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+}
+
+func TestReadMemoryLimit(t *testing.T) {
+	mount := t.TempDir()
+	writeCgroupFiles(t, filepath.Join(mount, "kubepods"), map[string]string{"memory.max": "1000\n"})
+	writeCgroupFiles(t, filepath.Join(mount, "kubepods", "pod1"), map[string]string{
+		"memory.max":      "max\n",
+		"memory.current":  "250\n",
+		"memory.swap.max": "max\n",
+	})
+
+	m := readMemoryLimit(mount, "/kubepods/pod1", 8000)
+	require.NotNil(t, m, "limit is inherited from the parent")
+	assert.Equal(t, MemoryLimit{Cgroup: "/kubepods/pod1", LimitBytes: 1000, UsageBytes: 250, UsagePercent: 25, AvailableBytes: 750}, *m)
+
+	assert.Nil(t, readMemoryLimit(mount, "/kubepods/pod1", 500), "limit above host RAM is no limit")
+	assert.Nil(t, readMemoryLimit(mount, "/", 8000))
+}
+
+func TestReadCPULimit(t *testing.T) {
+	mount := t.TempDir()
+	writeCgroupFiles(t, filepath.Join(mount, "slice"), map[string]string{"cpu.max": "200000 100000\n"})
+	writeCgroupFiles(t, filepath.Join(mount, "slice", "app"), map[string]string{
+		"cpu.max":               "max 100000\n",
+		"cpuset.cpus.effective": "0-3\n",
+		"cpu.stat":              "usage_usec 10\nnr_periods 10\nnr_throttled 3\n",
+	})
+
+	c := readCPULimit(mount, "/slice/app", 8)
+	require.NotNil(t, c)
+	assert.Equal(t, float64(2), c.QuotaCores)
+	assert.Equal(t, uint64(200000), c.QuotaUsec)
+	assert.Equal(t, 4, c.CpusetCount)
+	assert.Equal(t, float64(2), c.EffectiveCores)
+	assert.Equal(t, uint64(3), c.ThrottledCount)
+
+	c = readCPULimit(mount, "/slice/app", 3)
+	require.NotNil(t, c)
+	assert.Equal(t, float64(2), c.EffectiveCores)
+
+	assert.Nil(t, readCPULimit(mount, "/slice/app", 2), "quota equal to the host count is no limit")
+	assert.Nil(t, readCPULimit(mount, "/", 8))
+}
+
+func TestCpusetCount(t *testing.T) {
+	assert.Equal(t, 0, cpusetCount(""))
+	assert.Equal(t, 1, cpusetCount("3"))
+	assert.Equal(t, 4, cpusetCount("0-3"))
+	assert.Equal(t, 7, cpusetCount("0-3,8,10-11"))
+	assert.Equal(t, 0, cpusetCount("x-y"))
+}
+
+func TestContainerAwareInfo(t *testing.T) {
+	own, err := pidCgroup(int32(os.Getpid()))
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	saved := cgroupRoot
+	cgroupRoot = root
+	defer func() { cgroupRoot = saved }()
+
+	// Limits on the root apply to whatever cgroup the test runs in.
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory\n",
+		"memory.max":         "1048576\n",
+		"cpu.max":            "50000 100000\n",
+	})
+	writeCgroupFiles(t, filepath.Join(root, filepath.FromSlash(own)), map[string]string{
+		"memory.current": "524288\n",
+		"cpu.stat":       "usage_usec 0\n",
+	})
+
+	ctx := context.Background()
+	m, err := getMemoryInfo(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, m.Container)
+	assert.Equal(t, uint64(1048576), m.Container.LimitBytes)
+	assert.Equal(t, float64(50), m.Container.UsagePercent)
+
+	c, err := getCPUInfo(ctx, false, 100)
+	require.NoError(t, err)
+	require.NotNil(t, c.Container)
+	assert.Equal(t, 0.5, c.Container.EffectiveCores)
+
+	cgroupRoot = t.TempDir()
+	m, err = getMemoryInfo(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, m.Container, "no cgroup v2 hierarchy means no container section")
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// --- Process control (send_signal, renice, kill_process_tree) ---
+
+// ControlConfig enables the tools that act on processes. They are off by
+// default; when enabled, a target must be owned by one of AllowedUsers and
+// have a name matching one of AllowedNames. PID 1 and the server itself
+// can never be targeted.
+type ControlConfig struct {
+	Enabled        bool     `yaml:"enabled"`         // register send_signal, renice and kill_process_tree
+	DryRun         bool     `yaml:"dry_run"`         // only report what would happen, whatever the caller asks
+	AllowedUsers   []string `yaml:"allowed_users"`   // process owners that may be targeted; "*" for any
+	AllowedNames   []string `yaml:"allowed_names"`   // regexes matched against the full process name
+	AllowedSignals []string `yaml:"allowed_signals"` // signal names, default TERM, INT and HUP
+	MinNice        int      `yaml:"min_nice"`        // lowest nice value renice may set
+	AuditLog       string   `yaml:"audit_log"`       // file every action is appended to; the server log if empty
+}
+
+func DefaultControlConfig() ControlConfig {
+	return ControlConfig{AllowedSignals: []string{"TERM", "INT", "HUP"}}
+}
+
+func (c ControlConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.AllowedUsers) == 0 {
+		return fmt.Errorf("control.allowed_users must not be empty when control is enabled")
+	}
+	if len(c.AllowedNames) == 0 {
+		return fmt.Errorf("control.allowed_names must not be empty when control is enabled")
+	}
+	if _, err := compileNamePatterns(c.AllowedNames); err != nil {
+		return err
+	}
+	for _, s := range c.AllowedSignals {
+		if _, _, err := parseSignal(s); err != nil {
+			return fmt.Errorf("control.allowed_signals: %w", err)
+		}
+	}
+	if c.MinNice < -20 || c.MinNice > 19 {
+		return fmt.Errorf("control.min_nice must be within -20..19, got %d", c.MinNice)
+	}
+	return nil
+}
+
+func compileNamePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var out []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile("^(?:" + p + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid control.allowed_names pattern %q: %w", p, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+}
+
+// parseSignal accepts names such as "TERM", "sigterm" or "SIGTERM" and
+// returns the signal with its canonical name, e.g. "SIGTERM".
+func parseSignal(name string) (syscall.Signal, string, error) {
+	n := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "SIG")
+	sig, ok := signalNames[n]
+	if !ok {
+		return 0, "", fmt.Errorf("unsupported signal %q", name)
+	}
+	return sig, "SIG" + n, nil
+}
+
+// Controller applies a ControlConfig and writes the audit log.
+type Controller struct {
+	dryRun   bool
+	users    map[string]bool
+	anyUser  bool
+	names    []*regexp.Regexp
+	signals  map[syscall.Signal]bool
+	minNice  int
+	protect  map[int32]bool
+	auditMu  sync.Mutex
+	audit    io.Writer // audit_log, or nil to log through slog
+	closeLog func() error
+}
+
+// NewController builds a Controller from cfg, opening the audit log file
+// if one is configured.
+func NewController(cfg ControlConfig) (*Controller, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	names, _ := compileNamePatterns(cfg.AllowedNames)
+	c := &Controller{
+		dryRun:   cfg.DryRun,
+		users:    make(map[string]bool),
+		names:    names,
+		signals:  make(map[syscall.Signal]bool),
+		minNice:  cfg.MinNice,
+		protect:  map[int32]bool{1: true, int32(os.Getpid()): true},
+		closeLog: func() error { return nil },
+	}
+	for _, u := range cfg.AllowedUsers {
+		if u == "*" {
+			c.anyUser = true
+		}
+		c.users[u] = true
+	}
+	for _, s := range cfg.AllowedSignals {
+		sig, _, _ := parseSignal(s)
+		c.signals[sig] = true
+	}
+	if cfg.AuditLog != "" {
+		f, err := os.OpenFile(cfg.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		c.audit = f
+		c.closeLog = f.Close
+	}
+	return c, nil
+}
+
+// controller is the active Controller, or nil when process control is disabled.
+var controller *Controller
+
+// Close closes the audit log.
+func (c *Controller) Close() error {
+	return c.closeLog()
+}
+
+// ControlTarget is one process an action applies to.
+type ControlTarget struct {
+	PID      int32  `json:"pid"`
+	PPID     int32  `json:"ppid"`
+	Name     string `json:"name"`
+	Username string `json:"username,omitempty"`
+	Allowed  bool   `json:"allowed"`
+	Reason   string `json:"reason,omitempty"` // why the policy refused it
+	Done     bool   `json:"done"`             // the action was carried out
+	Error    string `json:"error,omitempty"`
+
+	createTime int64 // guards against the PID being reused before we act
+}
+
+type ControlResult struct {
+	Action  string          `json:"action"` // send_signal|renice|kill_process_tree
+	Signal  string          `json:"signal,omitempty"`
+	Nice    *int            `json:"nice,omitempty"`
+	DryRun  bool            `json:"dry_run"`
+	Targets []ControlTarget `json:"targets"`
+}
+
+type SendSignalArgs struct {
+	PID    int32  `json:"pid"`               // process to signal
+	Signal string `json:"signal,omitempty"`  // signal name such as TERM, INT, HUP or KILL, default TERM
+	DryRun bool   `json:"dry_run,omitempty"` // only report what would happen
+}
+
+type ReniceArgs struct {
+	PID    int32 `json:"pid"`               // process to renice
+	Nice   int   `json:"nice"`              // new nice value, -20 (highest priority) to 19
+	DryRun bool  `json:"dry_run,omitempty"` // only report what would happen
+}
+
+type KillProcessTreeArgs struct {
+	PID    int32  `json:"pid"`               // root of the tree; it and all its descendants are signalled
+	Signal string `json:"signal,omitempty"`  // default TERM
+	DryRun bool   `json:"dry_run,omitempty"` // only report what would happen
+}
+
+// errControlDisabled is returned by the control tools when no Controller is configured.
+var errControlDisabled = errors.New("process control is disabled; set control.enabled in the config file")
+
+// inspect reads pid and checks it against the policy.
+func (c *Controller) inspect(ctx context.Context, pid int32) (ControlTarget, error) {
+	p, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return ControlTarget{}, fmt.Errorf("failed to get process %d: %w", pid, err)
+	}
+	t := ControlTarget{PID: pid}
+	t.PPID, _ = p.PpidWithContext(ctx)
+	t.Name, _ = p.NameWithContext(ctx)
+	t.Username, _ = p.UsernameWithContext(ctx)
+	t.createTime, _ = p.CreateTimeWithContext(ctx)
+
+	switch {
+	case c.protect[pid]:
+		t.Reason = "protected process"
+	case !c.anyUser && !c.users[t.Username]:
+		t.Reason = fmt.Sprintf("user %q is not in control.allowed_users", t.Username)
+	case !c.nameAllowed(t.Name):
+		t.Reason = fmt.Sprintf("name %q does not match control.allowed_names", t.Name)
+	default:
+		t.Allowed = true
+	}
+	return t, nil
+}
+
+func (c *Controller) nameAllowed(name string) bool {
+	for _, re := range c.names {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// act runs fn on every target if all of them are allowed and dryRun is
+// false, then audits each one. A refusal of any target refuses them all.
+func (c *Controller) act(res *ControlResult, detail string, fn func(pid int32) error) error {
+	res.DryRun = res.DryRun || c.dryRun
+	var refused []string
+	for _, t := range res.Targets {
+		if !t.Allowed {
+			refused = append(refused, fmt.Sprintf("%d (%s)", t.PID, t.Reason))
+		}
+	}
+
+	var firstErr error
+	for i := range res.Targets {
+		t := &res.Targets[i]
+		outcome := "dry_run"
+		switch {
+		case len(refused) > 0:
+			outcome = "refused"
+			if t.Reason != "" {
+				outcome += ": " + t.Reason
+			}
+		case res.DryRun:
+		default:
+			err := c.verify(t)
+			if err == nil {
+				err = fn(t.PID)
+			}
+			if err != nil {
+				t.Error = err.Error()
+				outcome = "failed: " + t.Error
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to %s process %d: %w", res.Action, t.PID, err)
+				}
+			} else {
+				t.Done = true
+				outcome = "done"
+			}
+		}
+		c.auditf(res.Action, *t, detail, outcome)
+		if redactor.hideUsernames && t.Username != "" {
+			t.Username = RedactedText
+		}
+	}
+
+	if len(refused) > 0 && !res.DryRun {
+		return fmt.Errorf("%s refused by policy for %s", res.Action, strings.Join(refused, ", "))
+	}
+	return firstErr
+}
+
+// verify checks that t still refers to the process that was inspected.
+func (c *Controller) verify(t *ControlTarget) error {
+	p, err := process.NewProcess(t.PID)
+	if err != nil {
+		return fmt.Errorf("process exited")
+	}
+	if ct, _ := p.CreateTime(); ct != t.createTime {
+		return fmt.Errorf("PID was reused by another process")
+	}
+	return nil
+}
+
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	PID      int32     `json:"pid"`
+	Name     string    `json:"name"`
+	Username string    `json:"username"`
+	Detail   string    `json:"detail,omitempty"`
+	Outcome  string    `json:"outcome"`
+}
+
+func (c *Controller) auditf(action string, t ControlTarget, detail, outcome string) {
+	if c.audit == nil {
+		slog.Info("audit", "action", action, "pid", t.PID, "name", t.Name, "username", t.Username, "detail", detail, "outcome", outcome)
+		return
+	}
+	line, err := json.Marshal(auditRecord{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		PID:      t.PID,
+		Name:     t.Name,
+		Username: t.Username,
+		Detail:   detail,
+		Outcome:  outcome,
+	})
+	if err != nil {
+		slog.Error("Failed to encode audit record", "action", action, "pid", t.PID, "error", err)
+		return
+	}
+	c.auditMu.Lock()
+	defer c.auditMu.Unlock()
+	c.audit.Write(append(line, '\n'))
+}
+
+// signalAllowed parses name, defaulting to TERM, and checks it against
+// control.allowed_signals.
+func (c *Controller) signalAllowed(name string) (syscall.Signal, string, error) {
+	if name == "" {
+		name = "TERM"
+	}
+	sig, canonical, err := parseSignal(name)
+	if err != nil {
+		return 0, "", err
+	}
+	if !c.signals[sig] {
+		return 0, "", fmt.Errorf("signal %s is not in control.allowed_signals", canonical)
+	}
+	return sig, canonical, nil
+}
+
+func sendSignal(ctx context.Context, c *Controller, pid int32, signal string, dryRun bool) (ControlResult, error) {
+	if c == nil {
+		return ControlResult{}, errControlDisabled
+	}
+	sig, sigName, err := c.signalAllowed(signal)
+	if err != nil {
+		return ControlResult{}, err
+	}
+	t, err := c.inspect(ctx, pid)
+	if err != nil {
+		return ControlResult{}, err
+	}
+	res := ControlResult{Action: "send_signal", Signal: sigName, DryRun: dryRun, Targets: []ControlTarget{t}}
+	err = c.act(&res, res.Signal, func(pid int32) error { return syscall.Kill(int(pid), sig) })
+	return res, err
+}
+
+func renice(ctx context.Context, c *Controller, pid int32, nice int, dryRun bool) (ControlResult, error) {
+	if c == nil {
+		return ControlResult{}, errControlDisabled
+	}
+	if nice < -20 || nice > 19 {
+		return ControlResult{}, fmt.Errorf("nice must be within -20..19, got %d", nice)
+	}
+	if nice < c.minNice {
+		return ControlResult{}, fmt.Errorf("nice %d is below control.min_nice %d", nice, c.minNice)
+	}
+	t, err := c.inspect(ctx, pid)
+	if err != nil {
+		return ControlResult{}, err
+	}
+	res := ControlResult{Action: "renice", Nice: &nice, DryRun: dryRun, Targets: []ControlTarget{t}}
+	err = c.act(&res, fmt.Sprintf("nice=%d", nice), func(pid int32) error {
+		return syscall.Setpriority(syscall.PRIO_PROCESS, int(pid), nice)
+	})
+	return res, err
+}
+
+// killProcessTree signals pid and every descendant, parents before
+// children so that a supervisor cannot respawn workers in between. The
+// whole tree is refused if any member falls outside the policy.
+func killProcessTree(ctx context.Context, c *Controller, pid int32, signal string, dryRun bool) (ControlResult, error) {
+	if c == nil {
+		return ControlResult{}, errControlDisabled
+	}
+	sig, sigName, err := c.signalAllowed(signal)
+	if err != nil {
+		return ControlResult{}, err
+	}
+	pids, err := descendants(ctx, pid)
+	if err != nil {
+		return ControlResult{}, err
+	}
+	res := ControlResult{Action: "kill_process_tree", Signal: sigName, DryRun: dryRun}
+	for _, p := range pids {
+		t, err := c.inspect(ctx, p)
+		if err != nil {
+			if p == pid {
+				return ControlResult{}, err
+			}
+			continue // exited while we were looking
+		}
+		res.Targets = append(res.Targets, t)
+	}
+	err = c.act(&res, res.Signal, func(pid int32) error {
+		if err := syscall.Kill(int(pid), sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return err
+		}
+		return nil
+	})
+	return res, err
+}
+
+// descendants returns root followed by all its descendants, breadth first.
+func descendants(ctx context.Context, root int32) ([]int32, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	children := make(map[int32][]int32)
+	for _, p := range procs {
+		if ppid, err := p.PpidWithContext(ctx); err == nil && ppid != p.Pid {
+			children[ppid] = append(children[ppid], p.Pid)
+		}
+	}
+	out := []int32{root}
+	seen := map[int32]bool{root: true}
+	for i := 0; i < len(out); i++ {
+		kids := children[out[i]]
+		sort.Slice(kids, func(a, b int) bool { return kids[a] < kids[b] })
+		for _, k := range kids {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	return out, nil
+}
+
+// controlSummary describes the outcome of an action for the text content.
+func controlSummary(r ControlResult) string {
+	if r.DryRun {
+		for _, t := range r.Targets {
+			if !t.Allowed {
+				return fmt.Sprintf("Dry run: %s would be refused by policy", r.Action)
+			}
+		}
+		return fmt.Sprintf("Dry run: %s would apply to %d process(es)", r.Action, len(r.Targets))
+	}
+	done := 0
+	for _, t := range r.Targets {
+		if t.Done {
+			done++
+		}
+	}
+	return fmt.Sprintf("%s applied to %d of %d process(es)", r.Action, done, len(r.Targets))
+}
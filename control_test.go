@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testController allows the current user to act on processes matching names.
+func testController(t *testing.T, names ...string) (*Controller, *bytes.Buffer) {
+	t.Helper()
+	u, err := user.Current()
+	require.NoError(t, err)
+	cfg := DefaultControlConfig()
+	cfg.Enabled = true
+	cfg.AllowedUsers = []string{u.Username}
+	cfg.AllowedNames = names
+	c, err := NewController(cfg)
+	require.NoError(t, err)
+	var audit bytes.Buffer
+	c.audit = &audit
+	return c, &audit
+}
+
+// auditRecords parses the audit log, which must hold one JSON record per line.
+func auditRecords(t *testing.T, audit *bytes.Buffer) []auditRecord {
+	t.Helper()
+	var out []auditRecord
+	for _, line := range bytes.Split(bytes.TrimSuffix(audit.Bytes(), []byte("\n")), []byte("\n")) {
+		var rec auditRecord
+		require.NoError(t, json.Unmarshal(line, &rec), "audit line %q", line)
+		out = append(out, rec)
+	}
+	return out
+}
+
+// lastAudit returns the newest audit record.
+func lastAudit(t *testing.T, audit *bytes.Buffer) auditRecord {
+	t.Helper()
+	recs := auditRecords(t, audit)
+	require.NotEmpty(t, recs)
+	return recs[len(recs)-1]
+}
+
+// startProcess runs a shell command in the background and reaps it when the test ends.
+func startProcess(t *testing.T, script string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", script)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	return cmd
+}
+
+// waitExit reports whether cmd exits within a few seconds.
+func waitExit(cmd *exec.Cmd) bool {
+	done := make(chan struct{})
+	go func() {
+		_, _ = cmd.Process.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(5 * time.Second):
+		return false
+	}
+}
+
+func TestControlConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultControlConfig().validate())
+
+	cfg := DefaultControlConfig()
+	cfg.Enabled = true
+	assert.Error(t, cfg.validate(), "no allowed users")
+	cfg.AllowedUsers = []string{"app"}
+	assert.Error(t, cfg.validate(), "no allowed names")
+	cfg.AllowedNames = []string{"node"}
+	assert.NoError(t, cfg.validate())
+
+	bad := cfg
+	bad.AllowedNames = []string{"("}
+	assert.Error(t, bad.validate())
+	bad = cfg
+	bad.AllowedSignals = []string{"SIGBOGUS"}
+	assert.Error(t, bad.validate())
+	bad = cfg
+	bad.MinNice = 40
+	assert.Error(t, bad.validate())
+
+	_, err := parseConfig([]byte("control:\n  enabled: true\n  allowed_users: [app]\n"))
+	assert.Error(t, err)
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"TERM", "term", "SIGTERM", " sigterm "} {
+		sig, canonical, err := parseSignal(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, syscall.SIGTERM, sig)
+		assert.Equal(t, "SIGTERM", canonical)
+	}
+	_, _, err := parseSignal("SIGWHATEVER")
+	assert.Error(t, err)
+}
+
+func TestControlDisabled(t *testing.T) {
+	ctx := context.Background()
+	_, err := sendSignal(ctx, nil, 1, "", false)
+	assert.ErrorIs(t, err, errControlDisabled)
+	_, err = renice(ctx, nil, 1, 5, false)
+	assert.ErrorIs(t, err, errControlDisabled)
+	_, err = killProcessTree(ctx, nil, 1, "", false)
+	assert.ErrorIs(t, err, errControlDisabled)
+}
+
+func TestAuditWithoutFile(t *testing.T) {
+	cfg := DefaultControlConfig()
+	cfg.Enabled = true
+	cfg.AllowedUsers = []string{"*"}
+	cfg.AllowedNames = []string{"worker"}
+	c, err := NewController(cfg)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(newLogger(LoggingConfig{Level: "info", Format: LogFormatJSON}, &buf, nil))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	c.auditf("send_signal", ControlTarget{PID: 42, Name: "worker", Username: "app"}, "SIGTERM", "dry_run")
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec), "one JSON log record, not a raw line: %s", buf.String())
+	assert.Equal(t, "audit", rec["msg"])
+	assert.Equal(t, "send_signal", rec["action"])
+	assert.Equal(t, float64(42), rec["pid"])
+	assert.Equal(t, "dry_run", rec["outcome"])
+}
+
+func TestSendSignal(t *testing.T) {
+	ctx := context.Background()
+	c, audit := testController(t, "sleep")
+
+	t.Run("dry run", func(t *testing.T) {
+		cmd := startProcess(t, "exec sleep 60")
+		pid := int32(cmd.Process.Pid)
+		require.Eventually(t, func() bool {
+			p, err := process.NewProcess(pid)
+			name, _ := p.Name()
+			return err == nil && name == "sleep"
+		}, 5*time.Second, 20*time.Millisecond)
+
+		out, err := sendSignal(ctx, c, pid, "TERM", true)
+		require.NoError(t, err)
+		assert.True(t, out.DryRun)
+		require.Len(t, out.Targets, 1)
+		assert.True(t, out.Targets[0].Allowed)
+		assert.False(t, out.Targets[0].Done)
+		assert.NoError(t, cmd.Process.Signal(syscall.Signal(0)), "process should still be running")
+		rec := lastAudit(t, audit)
+		assert.Equal(t, "send_signal", rec.Action)
+		assert.Equal(t, pid, rec.PID)
+		assert.Equal(t, "dry_run", rec.Outcome)
+	})
+
+	t.Run("signals allowed process", func(t *testing.T) {
+		cmd := startProcess(t, "exec sleep 60")
+		pid := int32(cmd.Process.Pid)
+		require.Eventually(t, func() bool {
+			p, _ := process.NewProcess(pid)
+			name, _ := p.Name()
+			return name == "sleep"
+		}, 5*time.Second, 20*time.Millisecond)
+
+		out, err := sendSignal(ctx, c, pid, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, "SIGTERM", out.Signal)
+		assert.True(t, out.Targets[0].Done)
+		assert.True(t, waitExit(cmd))
+		rec := lastAudit(t, audit)
+		assert.Equal(t, "send_signal", rec.Action)
+		assert.Equal(t, pid, rec.PID)
+		assert.Equal(t, "done", rec.Outcome)
+	})
+
+	t.Run("refusals", func(t *testing.T) {
+		cmd := startProcess(t, "sleep 60; true") // the shell stays the direct child
+		pid := int32(cmd.Process.Pid)
+
+		_, err := sendSignal(ctx, c, pid, "TERM", false)
+		assert.ErrorContains(t, err, "allowed_names")
+		assert.NoError(t, cmd.Process.Signal(syscall.Signal(0)))
+		rec := lastAudit(t, audit)
+		assert.Equal(t, "send_signal", rec.Action)
+		assert.Equal(t, pid, rec.PID)
+		assert.True(t, strings.HasPrefix(rec.Outcome, "refused"), rec.Outcome)
+
+		out, err := sendSignal(ctx, c, pid, "TERM", true)
+		require.NoError(t, err, "dry run reports refusals without failing")
+		assert.False(t, out.Targets[0].Allowed)
+		assert.Equal(t, "Dry run: send_signal would be refused by policy", controlSummary(out))
+
+		_, err = sendSignal(ctx, c, int32(os.Getpid()), "TERM", false)
+		assert.ErrorContains(t, err, "protected")
+
+		_, err = sendSignal(ctx, c, pid, "KILL", false)
+		assert.ErrorContains(t, err, "allowed_signals")
+	})
+
+	t.Run("policy dry run wins", func(t *testing.T) {
+		cmd := startProcess(t, "exec sleep 60")
+		dry, _ := testController(t, ".*")
+		dry.dryRun = true
+		out, err := sendSignal(ctx, dry, int32(cmd.Process.Pid), "TERM", false)
+		require.NoError(t, err)
+		assert.True(t, out.DryRun)
+		assert.NoError(t, cmd.Process.Signal(syscall.Signal(0)))
+	})
+}
+
+func TestRenice(t *testing.T) {
+	ctx := context.Background()
+	c, _ := testController(t, "sleep")
+	cmd := startProcess(t, "exec sleep 60")
+	pid := int32(cmd.Process.Pid)
+	require.Eventually(t, func() bool {
+		p, _ := process.NewProcess(pid)
+		name, _ := p.Name()
+		return name == "sleep"
+	}, 5*time.Second, 20*time.Millisecond)
+
+	out, err := renice(ctx, c, pid, 10, false)
+	require.NoError(t, err)
+	require.NotNil(t, out.Nice)
+	assert.Equal(t, 10, *out.Nice)
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, int(pid))
+	require.NoError(t, err)
+	assert.Equal(t, 20-10, prio) // the raw syscall returns 20 - nice
+
+	_, err = renice(ctx, c, pid, -5, false)
+	assert.ErrorContains(t, err, "min_nice")
+	_, err = renice(ctx, c, pid, 25, false)
+	assert.Error(t, err)
+}
+
+func TestKillProcessTree(t *testing.T) {
+	ctx := context.Background()
+
+	startTree := func(t *testing.T) (*exec.Cmd, []int32) {
+		cmd := startProcess(t, "sleep 60 & sleep 61 & wait")
+		var pids []int32
+		require.Eventually(t, func() bool {
+			var err error
+			pids, err = descendants(ctx, int32(cmd.Process.Pid))
+			return err == nil && len(pids) == 3
+		}, 5*time.Second, 20*time.Millisecond)
+		return cmd, pids
+	}
+
+	t.Run("refused if any member is outside the policy", func(t *testing.T) {
+		c, _ := testController(t, "sleep")
+		cmd, _ := startTree(t)
+		out, err := killProcessTree(ctx, c, int32(cmd.Process.Pid), "TERM", false)
+		assert.ErrorContains(t, err, "refused by policy")
+		for _, target := range out.Targets {
+			assert.False(t, target.Done)
+		}
+		assert.NoError(t, cmd.Process.Signal(syscall.Signal(0)))
+	})
+
+	t.Run("signals the whole tree", func(t *testing.T) {
+		c, audit := testController(t, "sh", "sleep")
+		cmd, pids := startTree(t)
+		out, err := killProcessTree(ctx, c, int32(cmd.Process.Pid), "TERM", false)
+		require.NoError(t, err)
+		require.Len(t, out.Targets, 3)
+		assert.Equal(t, int32(cmd.Process.Pid), out.Targets[0].PID, "parent first")
+		assert.True(t, waitExit(cmd))
+		for _, pid := range pids[1:] {
+			assert.Eventually(t, func() bool {
+				p, err := process.NewProcess(pid)
+				if err != nil {
+					return true
+				}
+				status, _ := p.Status()
+				return len(status) > 0 && status[0] == process.Zombie
+			}, 5*time.Second, 20*time.Millisecond)
+		}
+		recs := auditRecords(t, audit)
+		require.Len(t, recs, 3)
+		for i, rec := range recs {
+			assert.Equal(t, "kill_process_tree", rec.Action)
+			assert.Equal(t, out.Targets[i].PID, rec.PID)
+			assert.Equal(t, "done", rec.Outcome)
+		}
+	})
+}
+
+func TestRegisterControlTools(t *testing.T) {
+	newServer := func() *mcp.Server {
+		return mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, nil)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Tools = map[string]bool{"renice": false} // naming an opt-in tool is not an error
+	server := newServer()
+	require.NoError(t, registerTools(server, &cfg))
+	names := listToolNames(t, server)
+	assert.NotContains(t, names, "send_signal")
+
+	cfg.Control.Enabled = true
+	cfg.Control.AllowedUsers = []string{"app"}
+	cfg.Control.AllowedNames = []string{"node"}
+	server = newServer()
+	require.NoError(t, registerTools(server, &cfg))
+	names = listToolNames(t, server)
+	assert.Contains(t, names, "send_signal")
+	assert.Contains(t, names, "kill_process_tree")
+	assert.NotContains(t, names, "renice")
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// --- Health check (diagnose_system) ---
+
+// Threshold is a pair of levels a value is compared against; a level of 0
+// is never reported.
+type Threshold struct {
+	Warning  float64 `yaml:"warning"`
+	Critical float64 `yaml:"critical"`
+}
+
+// DiagnoseConfig holds the rules diagnose_system applies. A value at or
+// above a level produces a finding of that severity.
+type DiagnoseConfig struct {
+	DiskUsedPercent    Threshold `yaml:"disk_used_percent"`    // per mount
+	InodeUsedPercent   Threshold `yaml:"inode_used_percent"`   // per mount
+	MemoryUsedPercent  Threshold `yaml:"memory_used_percent"`  // host RAM, and the server's cgroup limit when confined
+	SwapUsedPercent    Threshold `yaml:"swap_used_percent"`    // share of swap in use
+	CPUUsedPercent     Threshold `yaml:"cpu_used_percent"`     // over the sampling window
+	LoadPerCore        Threshold `yaml:"load_per_core"`        // 1-minute load average divided by logical CPUs
+	ZombieProcesses    Threshold `yaml:"zombie_processes"`     // count
+	ProcessMemoryShare Threshold `yaml:"process_memory_share"` // one process's share of RAM, in percent
+}
+
+func DefaultDiagnoseConfig() DiagnoseConfig {
+	return DiagnoseConfig{
+		DiskUsedPercent:    Threshold{Warning: 90, Critical: 95},
+		InodeUsedPercent:   Threshold{Warning: 90, Critical: 95},
+		MemoryUsedPercent:  Threshold{Warning: 90, Critical: 95},
+		SwapUsedPercent:    Threshold{Warning: 1, Critical: 50},
+		CPUUsedPercent:     Threshold{Warning: 90, Critical: 98},
+		LoadPerCore:        Threshold{Warning: 1, Critical: 2},
+		ZombieProcesses:    Threshold{Warning: 1, Critical: 50},
+		ProcessMemoryShare: Threshold{Warning: 50, Critical: 80},
+	}
+}
+
+func (c DiagnoseConfig) validate() error {
+	for name, t := range map[string]Threshold{
+		"disk_used_percent":    c.DiskUsedPercent,
+		"inode_used_percent":   c.InodeUsedPercent,
+		"memory_used_percent":  c.MemoryUsedPercent,
+		"swap_used_percent":    c.SwapUsedPercent,
+		"cpu_used_percent":     c.CPUUsedPercent,
+		"load_per_core":        c.LoadPerCore,
+		"zombie_processes":     c.ZombieProcesses,
+		"process_memory_share": c.ProcessMemoryShare,
+	} {
+		if t.Warning < 0 || t.Critical < 0 {
+			return fmt.Errorf("diagnose.%s levels must not be negative", name)
+		}
+		if t.Warning > 0 && t.Critical > 0 && t.Critical < t.Warning {
+			return fmt.Errorf("diagnose.%s.critical must not be below warning (%g), got %g", name, t.Warning, t.Critical)
+		}
+	}
+	return nil
+}
+
+// diagnoseConfig holds the active rules; main replaces it with the loaded config.
+var diagnoseConfig = DefaultDiagnoseConfig()
+
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	StatusOK         = "ok"
+)
+
+type Finding struct {
+	Severity  string         `json:"severity"` // critical|warning
+	Rule      string         `json:"rule"`     // config key of the rule, e.g. disk_used_percent
+	Resource  string         `json:"resource,omitempty"`
+	Message   string         `json:"message"`
+	Value     float64        `json:"value"`
+	Threshold float64        `json:"threshold"` // level that was crossed
+	Evidence  map[string]any `json:"evidence,omitempty"`
+}
+
+type DiagnoseResult struct {
+	Status       string        `json:"status"`   // ok, or the highest severity found
+	Findings     []Finding     `json:"findings"` // most severe first
+	Hostname     string        `json:"hostname,omitempty"`
+	Uptime       uint64        `json:"uptime_seconds,omitempty"`
+	Zombies      []ZombieInfo  `json:"zombies,omitempty"`
+	TopCPU       []ProcessInfo `json:"top_cpu,omitempty"`
+	TopMemory    []ProcessInfo `json:"top_memory,omitempty"`
+	CPUWindowMs  int64         `json:"cpu_window_ms,omitempty"`
+	Errors       []string      `json:"errors,omitempty"` // collectors that failed; their rules were skipped
+	RulesApplied []string      `json:"rules_applied"`
+}
+
+// immutableFstypes are filesystems that are full by construction: snap
+// packages, container image layers and optical media images.
+var immutableFstypes = map[string]bool{
+	"squashfs": true, "iso9660": true, "udf": true, "erofs": true, "cramfs": true, "romfs": true,
+}
+
+// fillableMount reports whether d can fill up, so that its usage is worth
+// checking. Read-only mounts, including overlay lower layers bound in
+// read-only, and image filesystems always look 100% used.
+func fillableMount(d DiskInfo) bool {
+	return !d.ReadOnly && !immutableFstypes[d.Fstype]
+}
+
+// ZombieInfo is a process that exited but was not reaped by its parent.
+type ZombieInfo struct {
+	PID        int32  `json:"pid"`
+	Name       string `json:"name"`
+	PPID       int32  `json:"ppid"`
+	ParentName string `json:"parent_name,omitempty"`
+}
+
+type DiagnoseArgs struct {
+	IntervalMs int `json:"interval_ms,omitempty"` // CPU sampling window in ms (same bounds as get_cpu_info), default 1000
+}
+
+// systemSnapshot is what the collectors gathered for one diagnosis.
+type systemSnapshot struct {
+	system    *SystemInfo
+	cpu       *CPUInfo
+	memory    *MemoryInfo
+	disks     *DiskInfoResult
+	load      *LoadAvgResult
+	topCPU    *ProcessInfoResult
+	topMemory *ProcessInfoResult
+	zombies   []ZombieInfo
+	zombieErr bool
+	errors    []string
+}
+
+func diagnoseSystem(ctx context.Context, intervalMs int) (DiagnoseResult, error) {
+	snap := collectSnapshot(ctx, intervalMs)
+	if err := ctx.Err(); err != nil {
+		return DiagnoseResult{}, err
+	}
+	return diagnose(snap, diagnoseConfig), nil
+}
+
+// collectSnapshot runs the collectors concurrently, so the call takes about
+// one CPU sampling window. Failed collectors are recorded, not fatal.
+func collectSnapshot(ctx context.Context, intervalMs int) systemSnapshot {
+	var s systemSnapshot
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	run := func(name string, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				mu.Lock()
+				s.errors = append(s.errors, fmt.Sprintf("%s: %v", name, err))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	run("system", func() error {
+		out, err := getSystemInfo(ctx)
+		if err == nil {
+			s.system = &out
+		}
+		return err
+	})
+	run("cpu", func() error {
+		out, err := getCPUInfo(ctx, false, intervalMs)
+		if err == nil {
+			s.cpu = &out
+		}
+		return err
+	})
+	run("memory", func() error {
+		out, err := getMemoryInfo(ctx)
+		if err == nil {
+			s.memory = &out
+		}
+		return err
+	})
+	run("disk", func() error {
+		out, err := getDiskInfo(ctx, "")
+		if err == nil {
+			s.disks = &out
+		}
+		return err
+	})
+	run("load", func() error {
+		out, err := getLoadAverage(ctx)
+		if err == nil {
+			s.load = &out
+		}
+		return err
+	})
+	run("processes by cpu", func() error {
+		out, err := getProcessInfo(ctx, 0, "", 5, "cpu", intervalMs, false)
+		if err == nil {
+			s.topCPU = &out
+		}
+		return err
+	})
+	run("processes by memory", func() error {
+		out, err := getProcessInfo(ctx, 0, "", 5, "memory", intervalMs, false)
+		if err == nil {
+			s.topMemory = &out
+		}
+		return err
+	})
+	run("zombies", func() error {
+		out, err := findZombies(ctx)
+		s.zombies, s.zombieErr = out, err != nil
+		return err
+	})
+	wg.Wait()
+	sort.Strings(s.errors)
+	return s
+}
+
+func findZombies(ctx context.Context) ([]ZombieInfo, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+	var out []ZombieInfo
+	for _, p := range procs {
+		st, err := p.StatusWithContext(ctx)
+		if err != nil || len(st) == 0 || st[0] != process.Zombie {
+			continue
+		}
+		z := ZombieInfo{PID: p.Pid}
+		z.Name, _ = p.NameWithContext(ctx)
+		z.PPID, _ = p.PpidWithContext(ctx)
+		if parent, err := process.NewProcessWithContext(ctx, z.PPID); err == nil {
+			z.ParentName, _ = parent.NameWithContext(ctx)
+		}
+		out = append(out, z)
+	}
+	return out, nil
+}
+
+// diagnose applies the rules in cfg to a snapshot.
+func diagnose(s systemSnapshot, cfg DiagnoseConfig) DiagnoseResult {
+	out := DiagnoseResult{Status: StatusOK, Findings: []Finding{}, Errors: s.errors, Zombies: s.zombies}
+	check := func(rule string, t Threshold, value float64, resource, message string, evidence map[string]any) {
+		f := Finding{Rule: rule, Resource: resource, Value: value, Evidence: evidence}
+		switch {
+		case t.Critical > 0 && value >= t.Critical:
+			f.Severity, f.Threshold = SeverityCritical, t.Critical
+		case t.Warning > 0 && value >= t.Warning:
+			f.Severity, f.Threshold = SeverityWarning, t.Warning
+		default:
+			return
+		}
+		f.Message = message
+		out.Findings = append(out.Findings, f)
+	}
+	applied := func(rule string) { out.RulesApplied = append(out.RulesApplied, rule) }
+
+	if s.system != nil {
+		out.Hostname, out.Uptime = s.system.Hostname, s.system.Uptime
+	}
+
+	if s.disks != nil {
+		applied("disk_used_percent")
+		applied("inode_used_percent")
+		for _, d := range s.disks.Disks {
+			if !fillableMount(d) {
+				continue
+			}
+			ev := map[string]any{"device": d.Device, "fstype": d.Fstype, "total_bytes": d.Total, "free_bytes": d.Free}
+			check("disk_used_percent", cfg.DiskUsedPercent, d.UsedPercent, d.Mountpoint,
+				fmt.Sprintf("%s is %.1f%% full (%s free)", d.Mountpoint, d.UsedPercent, formatBytes(d.Free)), ev)
+			if d.InodesTotal > 0 {
+				pct := float64(d.InodesUsed) / float64(d.InodesTotal) * 100
+				check("inode_used_percent", cfg.InodeUsedPercent, pct, d.Mountpoint,
+					fmt.Sprintf("%s has used %.1f%% of its inodes (%d free)", d.Mountpoint, pct, d.InodesFree),
+					map[string]any{"device": d.Device, "inodes_total": d.InodesTotal, "inodes_free": d.InodesFree})
+			}
+		}
+	}
+
+	if m := s.memory; m != nil {
+		applied("memory_used_percent")
+		applied("swap_used_percent")
+		check("memory_used_percent", cfg.MemoryUsedPercent, m.UsedPercent, "host",
+			fmt.Sprintf("memory is %.1f%% used (%s available)", m.UsedPercent, formatBytes(m.Available)),
+			map[string]any{"total_bytes": m.Total, "available_bytes": m.Available})
+		if c := m.Container; c != nil {
+			check("memory_used_percent", cfg.MemoryUsedPercent, c.UsagePercent, c.Cgroup,
+				fmt.Sprintf("the server's cgroup is at %.1f%% of its %s memory limit", c.UsagePercent, formatBytes(c.LimitBytes)),
+				map[string]any{"limit_bytes": c.LimitBytes, "usage_bytes": c.UsageBytes})
+		}
+		if m.SwapTotal > 0 {
+			pct := float64(m.SwapUsed) / float64(m.SwapTotal) * 100
+			check("swap_used_percent", cfg.SwapUsedPercent, pct, "swap",
+				fmt.Sprintf("%s of swap in use (%.1f%%)", formatBytes(m.SwapUsed), pct),
+				map[string]any{"swap_total_bytes": m.SwapTotal, "swap_used_bytes": m.SwapUsed, "memory_used_percent": m.UsedPercent})
+		}
+	}
+
+	var topCPU []ProcessInfo
+	if s.topCPU != nil {
+		topCPU = s.topCPU.Processes
+		out.TopCPU, out.CPUWindowMs = topCPU, s.topCPU.CPUWindowMs
+	}
+	if s.topMemory != nil {
+		out.TopMemory = s.topMemory.Processes
+	}
+
+	if c := s.cpu; c != nil && len(c.Usage) > 0 {
+		applied("cpu_used_percent")
+		check("cpu_used_percent", cfg.CPUUsedPercent, c.Usage[0], "cpu",
+			fmt.Sprintf("CPU is %.1f%% busy", c.Usage[0]),
+			map[string]any{"logical_count": c.Count, "top_processes": processEvidence(topCPU, 3)})
+	}
+
+	if l := s.load; l != nil && s.cpu != nil && s.cpu.Count > 0 {
+		applied("load_per_core")
+		cores := float64(s.cpu.Count)
+		if c := s.cpu.Container; c != nil && c.EffectiveCores > 0 {
+			cores = c.EffectiveCores
+		}
+		perCore := l.Load1 / cores
+		check("load_per_core", cfg.LoadPerCore, perCore, "load",
+			fmt.Sprintf("load average %.2f on %g cores (%.2f per core)", l.Load1, cores, perCore),
+			map[string]any{"load1": l.Load1, "load5": l.Load5, "load15": l.Load15, "cores": cores})
+	}
+
+	if !s.zombieErr {
+		applied("zombie_processes")
+		if n := len(s.zombies); n > 0 {
+			parents := map[string]int{}
+			for _, z := range s.zombies {
+				parents[fmt.Sprintf("%s (%d)", z.ParentName, z.PPID)]++
+			}
+			check("zombie_processes", cfg.ZombieProcesses, float64(n), "processes",
+				fmt.Sprintf("%d zombie processes not reaped by their parents", n),
+				map[string]any{"zombies_per_parent": parents})
+		}
+	}
+
+	if s.topMemory != nil {
+		applied("process_memory_share")
+		for _, p := range s.topMemory.Processes {
+			check("process_memory_share", cfg.ProcessMemoryShare, float64(p.MemoryPercent), fmt.Sprintf("pid %d", p.PID),
+				fmt.Sprintf("%s (pid %d) uses %.1f%% of memory (%s RSS)", p.Name, p.PID, p.MemoryPercent, formatBytes(p.MemoryRSS)),
+				map[string]any{"pid": p.PID, "name": p.Name, "rss_bytes": p.MemoryRSS})
+		}
+	}
+
+	sortFindings(out.Findings)
+	if len(out.Findings) > 0 {
+		out.Status = out.Findings[0].Severity
+	}
+	return out
+}
+
+// sortFindings puts critical findings first, then those furthest past
+// their threshold.
+func sortFindings(fs []Finding) {
+	sort.SliceStable(fs, func(i, j int) bool {
+		if fs[i].Severity != fs[j].Severity {
+			return fs[i].Severity == SeverityCritical
+		}
+		return fs[i].Value/fs[i].Threshold > fs[j].Value/fs[j].Threshold
+	})
+}
+
+func processEvidence(ps []ProcessInfo, n int) []string {
+	var out []string
+	for i, p := range ps {
+		if i == n {
+			break
+		}
+		out = append(out, fmt.Sprintf("%s (pid %d) %.1f%%", p.Name, p.PID, p.CPUPercent))
+	}
+	return out
+}
+
+// formatBytes renders n with a binary unit, e.g. 1.5 GiB.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// diagnoseSummary describes a DiagnoseResult for the text content.
+func diagnoseSummary(r DiagnoseResult) string {
+	if len(r.Findings) == 0 {
+		return fmt.Sprintf("No problems found (%d rules applied)", len(r.RulesApplied))
+	}
+	counts := map[string]int{}
+	for _, f := range r.Findings {
+		counts[f.Severity]++
+	}
+	return fmt.Sprintf("%s: %d critical, %d warning; top finding: %s", r.Status, counts[SeverityCritical], counts[SeverityWarning], r.Findings[0].Message)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnoseRules(t *testing.T) {
+	snap := systemSnapshot{
+		system: &SystemInfo{Hostname: "web1", Uptime: 3600},
+		cpu:    &CPUInfo{Usage: []float64{45}, Count: 4},
+		memory: &MemoryInfo{Total: 1000, Available: 80, UsedPercent: 92, SwapTotal: 100, SwapUsed: 60},
+		disks: &DiskInfoResult{Disks: []DiskInfo{
+			{Mountpoint: "/", UsedPercent: 97, Free: 3 << 30, InodesTotal: 100, InodesUsed: 10, InodesFree: 90},
+			{Mountpoint: "/data", UsedPercent: 50, InodesTotal: 100, InodesUsed: 91, InodesFree: 9},
+		}},
+		load:    &LoadAvgResult{Load1: 6, Load5: 5, Load15: 4},
+		zombies: []ZombieInfo{{PID: 10, Name: "worker", PPID: 5, ParentName: "supervisor"}},
+		topMemory: &ProcessInfoResult{Processes: []ProcessInfo{
+			{PID: 7, Name: "java", MemoryPercent: 60, MemoryRSS: 600},
+		}},
+	}
+
+	out := diagnose(snap, DefaultDiagnoseConfig())
+	assert.Equal(t, SeverityCritical, out.Status)
+	assert.Equal(t, "web1", out.Hostname)
+
+	type key struct{ rule, resource, severity string }
+	var got []key
+	for _, f := range out.Findings {
+		got = append(got, key{f.Rule, f.Resource, f.Severity})
+	}
+	assert.Equal(t, []key{
+		{"swap_used_percent", "swap", SeverityCritical}, // 60% against 50
+		{"disk_used_percent", "/", SeverityCritical},    // 97% against 95
+		{"load_per_core", "load", SeverityWarning},      // 1.5 against 1
+		{"process_memory_share", "pid 7", SeverityWarning},
+		{"memory_used_percent", "host", SeverityWarning},
+		{"inode_used_percent", "/data", SeverityWarning},
+		{"zombie_processes", "processes", SeverityWarning},
+	}, got, "critical first, then furthest past the threshold")
+
+	zombie := out.Findings[6]
+	assert.Equal(t, map[string]int{"supervisor (5)": 1}, zombie.Evidence["zombies_per_parent"])
+	assert.Contains(t, out.Findings[1].Message, "3.0 GiB free")
+	assert.ElementsMatch(t, []string{
+		"disk_used_percent", "inode_used_percent", "memory_used_percent", "swap_used_percent",
+		"cpu_used_percent", "load_per_core", "zombie_processes", "process_memory_share",
+	}, out.RulesApplied)
+}
+
+func TestDiagnoseConfigurable(t *testing.T) {
+	snap := systemSnapshot{
+		cpu:  &CPUInfo{Usage: []float64{10}, Count: 2, Container: &CPULimit{EffectiveCores: 0.5}},
+		load: &LoadAvgResult{Load1: 0.9},
+		memory: &MemoryInfo{Total: 1000, UsedPercent: 20,
+			Container: &MemoryLimit{Cgroup: "/docker/abc", LimitBytes: 100, UsageBytes: 96, UsagePercent: 96}},
+		zombieErr: true,
+		errors:    []string{"disk: boom"},
+	}
+
+	out := diagnose(snap, DefaultDiagnoseConfig())
+	require.Len(t, out.Findings, 2)
+	assert.Equal(t, "/docker/abc", out.Findings[0].Resource, "the container limit is checked as well as host RAM")
+	assert.Equal(t, "load_per_core", out.Findings[1].Rule, "load is compared with the CPU quota")
+	assert.Equal(t, 1.8, out.Findings[1].Value)
+	assert.NotContains(t, out.RulesApplied, "disk_used_percent")
+	assert.NotContains(t, out.RulesApplied, "zombie_processes")
+	assert.Equal(t, []string{"disk: boom"}, out.Errors)
+
+	cfg := DefaultDiagnoseConfig()
+	cfg.MemoryUsedPercent = Threshold{}
+	cfg.LoadPerCore = Threshold{Critical: 1.5}
+	out = diagnose(snap, cfg)
+	require.Len(t, out.Findings, 1)
+	assert.Equal(t, SeverityCritical, out.Findings[0].Severity)
+
+	out = diagnose(systemSnapshot{}, cfg)
+	assert.Equal(t, StatusOK, out.Status)
+	assert.Empty(t, out.Findings)
+	assert.Equal(t, "No problems found (1 rules applied)", diagnoseSummary(out), "only the zombie scan had data")
+}
+
+func TestDiagnoseSkipsImmutableMounts(t *testing.T) {
+	snap := systemSnapshot{disks: &DiskInfoResult{Disks: []DiskInfo{
+		{Mountpoint: "/snap/core22/1380", Device: "/dev/loop3", Fstype: "squashfs", UsedPercent: 100, InodesTotal: 100, InodesUsed: 100},
+		{Mountpoint: "/media/cdrom", Device: "/dev/sr0", Fstype: "iso9660", UsedPercent: 100},
+		{Mountpoint: "/mnt/ro", Device: "/dev/sdb1", Fstype: "ext4", ReadOnly: true, UsedPercent: 100, InodesTotal: 10, InodesUsed: 10},
+	}}}
+	out := diagnose(snap, DefaultDiagnoseConfig())
+	assert.Empty(t, out.Findings, "read-only and image filesystems are always full")
+	assert.Equal(t, StatusOK, out.Status)
+	assert.Contains(t, out.RulesApplied, "disk_used_percent")
+}
+
+func TestDiagnoseConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultDiagnoseConfig().validate())
+	_, err := parseConfig([]byte("diagnose:\n  disk_used_percent: {warning: 95, critical: 90}\n"))
+	assert.Error(t, err)
+	_, err = parseConfig([]byte("diagnose:\n  load_per_core: {warning: -1}\n"))
+	assert.Error(t, err)
+	cfg, err := parseConfig([]byte("diagnose:\n  disk_used_percent: {warning: 80, critical: 0}\n"))
+	require.NoError(t, err)
+	assert.Equal(t, Threshold{Warning: 80}, cfg.Diagnose.DiskUsedPercent)
+	assert.Equal(t, DefaultDiagnoseConfig().LoadPerCore, cfg.Diagnose.LoadPerCore)
+}
+
+func TestDiagnoseSystem(t *testing.T) {
+	out, err := diagnoseSystem(context.Background(), 100)
+	require.NoError(t, err)
+	assert.NotEmpty(t, out.Status)
+	assert.Contains(t, out.RulesApplied, "memory_used_percent")
+	assert.Contains(t, out.RulesApplied, "load_per_core")
+	assert.NotEmpty(t, out.TopCPU)
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 GiB", formatBytes(2<<30))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// --- Disk I/O statistics ---
+
+type DiskIOInfo struct {
+	Device               string  `json:"device"`
+	ReadIOPS             float64 `json:"read_iops"`
+	WriteIOPS            float64 `json:"write_iops"`
+	ReadBytesPerSec      float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec     float64 `json:"write_bytes_per_sec"`
+	ReadAwaitMs          float64 `json:"read_await_ms"`  // mean time per completed read, including queueing
+	WriteAwaitMs         float64 `json:"write_await_ms"` // mean time per completed write, including queueing
+	AwaitMs              float64 `json:"await_ms"`
+	UtilizationPercent   float64 `json:"utilization_percent"` // share of the window the device was busy
+	AvgQueueDepth        float64 `json:"avg_queue_depth"`
+	InProgress           uint64  `json:"in_progress"`
+	TotalReadBytes       uint64  `json:"total_read_bytes"`
+	TotalWriteBytes      uint64  `json:"total_write_bytes"`
+	TotalReadOps         uint64  `json:"total_read_ops"`
+	TotalWriteOps        uint64  `json:"total_write_ops"`
+	MergedReadOpsPerSec  float64 `json:"merged_read_ops_per_sec"`
+	MergedWriteOpsPerSec float64 `json:"merged_write_ops_per_sec"`
+}
+
+type DiskIOResult struct {
+	WindowSeconds float64      `json:"window_seconds"`
+	Devices       []DiskIOInfo `json:"devices"`
+}
+
+type DiskIOArgs struct {
+	Device     string `json:"device,omitempty"`      // specific device name, e.g. sda or nvme0n1
+	IntervalMs int    `json:"interval_ms,omitempty"` // sampling window in ms (same bounds as get_cpu_info), default 1000
+}
+
+// getDiskIO samples the kernel's per-device I/O counters twice, intervalMs
+// apart, and derives iostat-style rates from the difference. Devices that
+// have never done any I/O (unused loop devices and the like) are left out
+// unless asked for by name. Results are ordered busiest first.
+func getDiskIO(ctx context.Context, device string, intervalMs int) (DiskIOResult, error) {
+	interval := sampleWindow(intervalMs)
+
+	var names []string
+	if device != "" {
+		names = []string{device}
+	}
+	before, err := disk.IOCountersWithContext(ctx, names...)
+	if err != nil {
+		return DiskIOResult{}, fmt.Errorf("failed to get disk I/O counters: %w", err)
+	}
+	if device != "" && len(before) == 0 {
+		return DiskIOResult{}, fmt.Errorf("no I/O counters for device %s", device)
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return DiskIOResult{}, ctx.Err()
+	case <-time.After(interval):
+	}
+	after, err := disk.IOCountersWithContext(ctx, names...)
+	if err != nil {
+		return DiskIOResult{}, fmt.Errorf("failed to get disk I/O counters: %w", err)
+	}
+	window := time.Since(start).Seconds()
+
+	var out []DiskIOInfo
+	for name, cur := range after {
+		prev, ok := before[name]
+		if !ok {
+			continue
+		}
+		if device == "" && cur.ReadCount == 0 && cur.WriteCount == 0 {
+			continue
+		}
+		out = append(out, diskIORates(prev, cur, window))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].UtilizationPercent != out[j].UtilizationPercent {
+			return out[i].UtilizationPercent > out[j].UtilizationPercent
+		}
+		return out[i].Device < out[j].Device
+	})
+	return DiskIOResult{WindowSeconds: window, Devices: out}, nil
+}
+
+func diskIORates(prev, cur disk.IOCountersStat, window float64) DiskIOInfo {
+	delta := func(a, b uint64) float64 {
+		if b < a { // counter reset or wrap
+			return 0
+		}
+		return float64(b - a)
+	}
+	reads := delta(prev.ReadCount, cur.ReadCount)
+	writes := delta(prev.WriteCount, cur.WriteCount)
+	readTime := delta(prev.ReadTime, cur.ReadTime)
+	writeTime := delta(prev.WriteTime, cur.WriteTime)
+	windowMs := window * 1000
+
+	info := DiskIOInfo{
+		Device:               cur.Name,
+		ReadIOPS:             reads / window,
+		WriteIOPS:            writes / window,
+		ReadBytesPerSec:      delta(prev.ReadBytes, cur.ReadBytes) / window,
+		WriteBytesPerSec:     delta(prev.WriteBytes, cur.WriteBytes) / window,
+		UtilizationPercent:   delta(prev.IoTime, cur.IoTime) / windowMs * 100,
+		AvgQueueDepth:        delta(prev.WeightedIO, cur.WeightedIO) / windowMs,
+		InProgress:           cur.IopsInProgress,
+		TotalReadBytes:       cur.ReadBytes,
+		TotalWriteBytes:      cur.WriteBytes,
+		TotalReadOps:         cur.ReadCount,
+		TotalWriteOps:        cur.WriteCount,
+		MergedReadOpsPerSec:  delta(prev.MergedReadCount, cur.MergedReadCount) / window,
+		MergedWriteOpsPerSec: delta(prev.MergedWriteCount, cur.MergedWriteCount) / window,
+	}
+	if info.UtilizationPercent > 100 {
+		info.UtilizationPercent = 100
+	}
+	if reads > 0 {
+		info.ReadAwaitMs = readTime / reads
+	}
+	if writes > 0 {
+		info.WriteAwaitMs = writeTime / writes
+	}
+	if reads+writes > 0 {
+		info.AwaitMs = (readTime + writeTime) / (reads + writes)
+	}
+	return info
+}
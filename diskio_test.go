@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskIORates(t *testing.T) {
+	prev := disk.IOCountersStat{
+		Name: "sda", ReadCount: 100, WriteCount: 50, ReadBytes: 1 << 20, WriteBytes: 1 << 20,
+		ReadTime: 1000, WriteTime: 2000, IoTime: 5000, WeightedIO: 3000,
+	}
+	cur := disk.IOCountersStat{
+		Name: "sda", ReadCount: 300, WriteCount: 150, ReadBytes: 3 << 20, WriteBytes: 2 << 20,
+		ReadTime: 1400, WriteTime: 3000, IoTime: 6000, WeightedIO: 7000, IopsInProgress: 2,
+	}
+
+	info := diskIORates(prev, cur, 2)
+	assert.Equal(t, "sda", info.Device)
+	assert.Equal(t, float64(100), info.ReadIOPS)
+	assert.Equal(t, float64(50), info.WriteIOPS)
+	assert.Equal(t, float64(1<<20), info.ReadBytesPerSec)
+	assert.Equal(t, float64(1<<19), info.WriteBytesPerSec)
+	assert.Equal(t, float64(2), info.ReadAwaitMs)
+	assert.Equal(t, float64(10), info.WriteAwaitMs)
+	assert.InDelta(t, 1400.0/300.0, info.AwaitMs, 1e-9)
+	assert.Equal(t, float64(50), info.UtilizationPercent)
+	assert.Equal(t, float64(2), info.AvgQueueDepth)
+	assert.Equal(t, uint64(2), info.InProgress)
+
+	t.Run("idle device", func(t *testing.T) {
+		info := diskIORates(prev, prev, 1)
+		assert.Zero(t, info.ReadIOPS)
+		assert.Zero(t, info.AwaitMs)
+		assert.Zero(t, info.UtilizationPercent)
+	})
+
+	t.Run("counter reset and utilization cap", func(t *testing.T) {
+		reset := cur
+		reset.ReadCount = 0
+		reset.IoTime = prev.IoTime + 5000
+		info := diskIORates(prev, reset, 1)
+		assert.Zero(t, info.ReadIOPS)
+		assert.Equal(t, float64(100), info.UtilizationPercent)
+	})
+}
+
+func TestGetDiskIO(t *testing.T) {
+	ctx := context.Background()
+
+	result, err := getDiskIO(ctx, "", 100)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, result.WindowSeconds, 0.1)
+	for i, d := range result.Devices {
+		assert.NotEmpty(t, d.Device)
+		assert.GreaterOrEqual(t, d.UtilizationPercent, float64(0))
+		assert.LessOrEqual(t, d.UtilizationPercent, float64(100))
+		if i > 0 {
+			assert.GreaterOrEqual(t, result.Devices[i-1].UtilizationPercent, d.UtilizationPercent)
+		}
+	}
+
+	_, err = getDiskIO(ctx, "no-such-device", 100)
+	assert.Error(t, err)
+}
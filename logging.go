@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// --- Server logging ---
+
+// LoggingConfig controls the server's own log. Records go to stderr and,
+// when Forward is set, to every client that asked for them with
+// logging/setLevel. (The logs section is about reading the host's logs.)
+type LoggingConfig struct {
+	Level   string `yaml:"level"`   // debug|info|warn|error; the stderr threshold
+	Format  string `yaml:"format"`  // text|json
+	Forward bool   `yaml:"forward"` // send records to clients as MCP log notifications
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+func DefaultLoggingConfig() LoggingConfig {
+	return LoggingConfig{Level: "info", Format: LogFormatText, Forward: true}
+}
+
+func (c LoggingConfig) level() (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(c.Level)); err != nil {
+		return 0, fmt.Errorf("logging.level must be debug, info, warn or error, got %q", c.Level)
+	}
+	return l, nil
+}
+
+func (c LoggingConfig) validate() error {
+	if _, err := c.level(); err != nil {
+		return err
+	}
+	switch c.Format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("logging.format must be %s or %s, got %q", LogFormatText, LogFormatJSON, c.Format)
+	}
+	return nil
+}
+
+// newLogger builds the server's logger writing to w. With a server and
+// cfg.Forward, records are also forwarded to its client sessions, each of
+// which applies the level it set rather than cfg.Level.
+func newLogger(cfg LoggingConfig, w io.Writer, server *mcp.Server) *slog.Logger {
+	level, _ := cfg.level() // checked by validate
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if cfg.Format == LogFormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	if cfg.Forward && server != nil {
+		h = teeHandler{h, &clientLogHandler{server: server}}
+	}
+	return slog.New(h)
+}
+
+// teeHandler sends each record to every handler that is enabled for it.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	out := make(teeHandler, len(t))
+	for i, h := range t {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// clientLogHandler forwards records as MCP log notifications (logger
+// ServerName). A record logged with a context from withSession goes to
+// that session only; any other record goes to every session.
+type clientLogHandler struct {
+	server *mcp.Server
+	wrap   []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls, replayed per session
+}
+
+func (h *clientLogHandler) sessionHandlers(ctx context.Context) []slog.Handler {
+	var sessions []*mcp.ServerSession
+	if ss, ok := ctx.Value(sessionKey{}).(*mcp.ServerSession); ok {
+		sessions = append(sessions, ss)
+	} else {
+		for ss := range h.server.Sessions() {
+			sessions = append(sessions, ss)
+		}
+	}
+	out := make([]slog.Handler, 0, len(sessions))
+	for _, ss := range sessions {
+		var sh slog.Handler = mcp.NewLoggingHandler(ss, &mcp.LoggingHandlerOptions{LoggerName: ServerName})
+		for _, w := range h.wrap {
+			sh = w(sh)
+		}
+		out = append(out, sh)
+	}
+	return out
+}
+
+func (h *clientLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, sh := range h.sessionHandlers(ctx) {
+		if sh.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *clientLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	// A call that failed because its request was cancelled is still worth
+	// reporting, so do not let the cancellation stop the notification.
+	notifyCtx := context.WithoutCancel(ctx)
+	var errs []error
+	for _, sh := range h.sessionHandlers(ctx) {
+		if sh.Enabled(ctx, r.Level) {
+			errs = append(errs, sh.Handle(notifyCtx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *clientLogHandler) with(w func(slog.Handler) slog.Handler) slog.Handler {
+	h2 := *h
+	h2.wrap = append(h.wrap[:len(h.wrap):len(h.wrap)], w)
+	return &h2
+}
+
+func (h *clientLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(sh slog.Handler) slog.Handler { return sh.WithAttrs(attrs) })
+}
+
+func (h *clientLogHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(sh slog.Handler) slog.Handler { return sh.WithGroup(name) })
+}
+
+type sessionKey struct{}
+
+// withSession scopes the records logged with the returned context to ss.
+func withSession(ctx context.Context, ss *mcp.ServerSession) context.Context {
+	return context.WithValue(ctx, sessionKey{}, ss)
+}
+
+// logTool wraps a tool handler so that every call is logged with the tool,
+// session id and duration: failures at error level, the rest at debug.
+func logTool[In any](name string, h mcp.ToolHandlerFor[In, any]) mcp.ToolHandlerFor[In, any] {
+	return func(ctx context.Context, req *mcp.CallToolRequest, in In) (*mcp.CallToolResult, any, error) {
+		attrs := []slog.Attr{slog.String("tool", name)}
+		if req != nil && req.Session != nil {
+			ctx = withSession(ctx, req.Session)
+			if id := req.Session.ID(); id != "" {
+				attrs = append(attrs, slog.String("session_id", id))
+			}
+		}
+		start := time.Now()
+		res, out, err := h(ctx, req, in)
+		attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+		if err != nil {
+			slog.LogAttrs(ctx, slog.LevelError, "Tool call failed", append(attrs, slog.Any("error", err))...)
+		} else {
+			slog.LogAttrs(ctx, slog.LevelDebug, "Tool call", attrs...)
+		}
+		return res, out, err
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggingConfig(t *testing.T) {
+	opts, err := parseFlags([]string{"--log-level", "debug", "--log-format", "json"})
+	require.NoError(t, err)
+	assert.Equal(t, LoggingConfig{Level: "debug", Format: LogFormatJSON, Forward: true}, opts.Config.Logging)
+
+	_, err = parseFlags([]string{"--log-level", "loud"})
+	assert.Error(t, err)
+	_, err = parseConfig([]byte("logging:\n  format: xml\n"))
+	assert.Error(t, err)
+	cfg, err := parseConfig([]byte("logging:\n  level: WARN\n  forward: false\n"))
+	require.NoError(t, err)
+	assert.False(t, cfg.Logging.Forward)
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(LoggingConfig{Level: "warn", Format: LogFormatJSON}, &buf, nil)
+	logger.Info("hidden")
+	logger.Warn("shown", "count", 3)
+
+	var rec map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &rec), buf.String())
+	assert.Equal(t, "WARN", rec["level"])
+	assert.Equal(t, "shown", rec["msg"])
+	assert.Equal(t, float64(3), rec["count"])
+
+	buf.Reset()
+	newLogger(DefaultLoggingConfig(), &buf, nil).Info("hello", "path", "/tmp")
+	assert.Contains(t, buf.String(), "level=INFO msg=hello path=/tmp")
+}
+
+// logClient connects a client to server whose log notifications arrive on
+// the returned channel.
+func logClient(t *testing.T, server *mcp.Server) (*mcp.ClientSession, chan *mcp.LoggingMessageParams) {
+	t.Helper()
+	ctx := context.Background()
+	msgs := make(chan *mcp.LoggingMessageParams, 10)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.0.1"}, &mcp.ClientOptions{
+		LoggingMessageHandler: func(_ context.Context, req *mcp.LoggingMessageRequest) { msgs <- req.Params },
+	})
+	st, ct := mcp.NewInMemoryTransports()
+	_, err := server.Connect(ctx, st, nil)
+	require.NoError(t, err)
+	session, err := client.Connect(ctx, ct, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { session.Close() })
+	return session, msgs
+}
+
+func nextLog(t *testing.T, msgs chan *mcp.LoggingMessageParams) map[string]any {
+	t.Helper()
+	select {
+	case m := <-msgs:
+		assert.Equal(t, ServerName, m.Logger)
+		data, ok := m.Data.(map[string]any)
+		require.True(t, ok, "data is a JSON object: %v", m.Data)
+		data["level"] = string(m.Level)
+		return data
+	case <-time.After(5 * time.Second):
+		t.Fatal("no log notification")
+		return nil
+	}
+}
+
+func TestLogForwarding(t *testing.T) {
+	ctx := context.Background()
+	server := mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, nil)
+	reg := &toolRegistry{server: server, known: make(map[string]bool)}
+	addTool(reg, &mcp.Tool{Name: "echo"}, func(_ context.Context, _ *mcp.CallToolRequest, a echoArgs) (*mcp.CallToolResult, any, error) {
+		if a.Fail {
+			err := errors.New("echo failed")
+			return textErr(err), nil, err
+		}
+		return textOK(a.Message), nil, nil
+	})
+
+	var stderr bytes.Buffer
+	saved := slog.Default()
+	slog.SetDefault(newLogger(DefaultLoggingConfig(), &stderr, server))
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	caller, callerMsgs := logClient(t, server)
+	other, otherMsgs := logClient(t, server)
+
+	slog.Warn("before setLevel")
+	require.NoError(t, caller.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "warning"}))
+	require.NoError(t, other.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "debug"}))
+
+	slog.Debug("below the caller's level", "n", 1)
+	slog.Warn("disk almost full", "mount", "/")
+	rec := nextLog(t, callerMsgs)
+	assert.Equal(t, "disk almost full", rec["msg"])
+	assert.Equal(t, "/", rec["mount"])
+	assert.Equal(t, "warning", rec["level"])
+	assert.Equal(t, "below the caller's level", nextLog(t, otherMsgs)["msg"], "sessions apply their own level")
+	assert.Equal(t, "disk almost full", nextLog(t, otherMsgs)["msg"])
+	assert.NotContains(t, stderr.String(), "below the caller's level", "stderr keeps the configured level")
+
+	// Tool calls are logged to the calling session only.
+	_, err := caller.CallTool(ctx, &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"message": "x", "fail": true}})
+	require.NoError(t, err)
+	rec = nextLog(t, callerMsgs)
+	assert.Equal(t, "Tool call failed", rec["msg"])
+	assert.Equal(t, "echo", rec["tool"])
+	assert.Equal(t, "echo failed", rec["error"])
+	assert.Contains(t, rec, "duration")
+	assert.Contains(t, stderr.String(), `level=ERROR msg="Tool call failed" tool=echo`)
+
+	_, err = other.CallTool(ctx, &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"message": "x"}})
+	require.NoError(t, err)
+	rec = nextLog(t, otherMsgs)
+	assert.Equal(t, "Tool call", rec["msg"])
+	assert.Equal(t, "debug", rec["level"])
+
+	assert.Empty(t, callerMsgs)
+	assert.Empty(t, otherMsgs)
+	assert.Equal(t, 1, strings.Count(stderr.String(), "before setLevel"), "still written to stderr")
+}
+
+func TestClientLogHandlerWithAttrs(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, nil)
+	session, msgs := logClient(t, server)
+	require.NoError(t, session.SetLoggingLevel(context.Background(), &mcp.SetLoggingLevelParams{Level: "info"}))
+
+	var stderr bytes.Buffer
+	logger := newLogger(DefaultLoggingConfig(), &stderr, server).With("component", "sampler").WithGroup("cpu")
+	logger.Info("sample", "percent", 12.5)
+
+	rec := nextLog(t, msgs)
+	assert.Equal(t, "sampler", rec["component"])
+	assert.Equal(t, map[string]any{"percent": 12.5}, rec["cpu"])
+	assert.Contains(t, stderr.String(), "component=sampler cpu.percent=12.5")
+}
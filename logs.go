@@ -0,0 +1,666 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Log reading and search (read_logs, search_logs) ---
+
+// LogsConfig controls which logs read_logs and search_logs may open.
+type LogsConfig struct {
+	AllowedDirs []string `yaml:"allowed_dirs"` // plain log files must live under one of these
+	Journal     bool     `yaml:"journal"`      // allow reading the systemd journal through journalctl
+	MaxLines    int      `yaml:"max_lines"`    // largest number of entries one call may return
+}
+
+func DefaultLogsConfig() LogsConfig {
+	return LogsConfig{AllowedDirs: []string{"/var/log"}, Journal: true, MaxLines: 1000}
+}
+
+func (c LogsConfig) validate() error {
+	for _, d := range c.AllowedDirs {
+		if !filepath.IsAbs(d) {
+			return fmt.Errorf("logs.allowed_dirs entries must be absolute paths, got %q", d)
+		}
+	}
+	if c.MaxLines < 1 || c.MaxLines > 100000 {
+		return fmt.Errorf("logs.max_lines must be within 1..100000, got %d", c.MaxLines)
+	}
+	return nil
+}
+
+// logsConfig holds the active LogsConfig; main replaces it with the loaded config.
+var logsConfig = DefaultLogsConfig()
+
+// journalctl is the command used to read the journal.
+var journalctl = "journalctl"
+
+// JournalSource names the systemd journal in LogEntry.Source and the
+// source arguments.
+const JournalSource = "journal"
+
+const (
+	maxLogMessageBytes  = 8192 // longer messages are cut; file lines beyond this are not read into memory
+	maxLogFilesSearched = 500
+	// maxJournalScanned bounds the newest journal entries filtered in Go
+	// when journalctl cannot apply the pattern itself.
+	maxJournalScanned = 100000
+)
+
+type LogEntry struct {
+	Time     string `json:"time,omitempty"` // RFC 3339; omitted for file lines without a recognisable timestamp
+	Source   string `json:"source"`         // "journal" or the file path
+	Line     int    `json:"line,omitempty"` // line number within a file
+	Unit     string `json:"unit,omitempty"`
+	Ident    string `json:"identifier,omitempty"` // syslog identifier
+	PID      int32  `json:"pid,omitempty"`
+	Priority string `json:"priority,omitempty"` // emerg..debug
+	Message  string `json:"message"`
+	Redacted bool   `json:"redacted,omitempty"`
+
+	t time.Time
+}
+
+type LogsResult struct {
+	Entries       []LogEntry `json:"entries"`
+	Matched       int        `json:"matched"`             // entries read that passed the filters, before max_lines
+	Truncated     bool       `json:"truncated,omitempty"` // only the newest max_lines matches are listed
+	Redacted      int        `json:"redacted,omitempty"`  // entries with secrets removed
+	FilesSearched int        `json:"files_searched,omitempty"`
+	Errors        []string   `json:"errors,omitempty"` // sources that could not be read
+}
+
+type ReadLogsArgs struct {
+	Source   string `json:"source,omitempty"`    // "journal" (default) or a log file under an allowed directory
+	Unit     string `json:"unit,omitempty"`      // systemd unit, journal only
+	Priority string `json:"priority,omitempty"`  // this priority and more severe: emerg|alert|crit|err|warning|notice|info|debug or 0-7; journal only
+	Since    string `json:"since,omitempty"`     // RFC 3339 time or duration ago such as 30m or 2h
+	Until    string `json:"until,omitempty"`     // RFC 3339 time or duration ago
+	Pattern  string `json:"pattern,omitempty"`   // regex the message must match
+	MaxLines int    `json:"max_lines,omitempty"` // newest entries returned (default 100, max logs.max_lines)
+}
+
+type SearchLogsArgs struct {
+	Pattern  string   `json:"pattern"`            // regex the message must match
+	Paths    []string `json:"paths,omitempty"`    // files or directories to search, plus "journal"; default the journal and every allowed directory
+	Unit     string   `json:"unit,omitempty"`     // systemd unit; restricts the search to the journal
+	Priority string   `json:"priority,omitempty"` // as in read_logs; restricts the search to the journal
+	Since    string   `json:"since,omitempty"`
+	Until    string   `json:"until,omitempty"`
+	MaxLines int      `json:"max_lines,omitempty"` // newest matches returned (default 100, max logs.max_lines)
+}
+
+// logFilter is the parsed form of the filter arguments.
+type logFilter struct {
+	unit     string
+	priority int // -1 for any
+	since    time.Time
+	until    time.Time
+	re       *regexp.Regexp
+}
+
+func (f logFilter) timed() bool { return !f.since.IsZero() || !f.until.IsZero() }
+
+func (f logFilter) journalOnly() bool { return f.unit != "" || f.priority >= 0 }
+
+func (f logFilter) match(e *LogEntry) bool {
+	if f.timed() {
+		if e.t.IsZero() || (!f.since.IsZero() && e.t.Before(f.since)) || (!f.until.IsZero() && e.t.After(f.until)) {
+			return false
+		}
+	}
+	return f.re == nil || f.re.MatchString(e.Message)
+}
+
+func newLogFilter(unit, priority, since, until, pattern string, now time.Time) (logFilter, error) {
+	f := logFilter{unit: unit, priority: -1}
+	var err error
+	if priority != "" {
+		if f.priority, err = parsePriority(priority); err != nil {
+			return logFilter{}, err
+		}
+	}
+	if f.since, err = parseLogTimeArg(since, now); err != nil {
+		return logFilter{}, fmt.Errorf("invalid since: %w", err)
+	}
+	if f.until, err = parseLogTimeArg(until, now); err != nil {
+		return logFilter{}, fmt.Errorf("invalid until: %w", err)
+	}
+	if pattern != "" {
+		if f.re, err = regexp.Compile(pattern); err != nil {
+			return logFilter{}, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	return f, nil
+}
+
+var priorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+func parsePriority(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "error":
+		s = "err"
+	case "warn":
+		s = "warning"
+	case "emergency", "panic":
+		s = "emerg"
+	case "critical":
+		s = "crit"
+	}
+	for i, n := range priorityNames {
+		if s == n || s == strconv.Itoa(i) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown priority %q (want emerg, alert, crit, err, warning, notice, info, debug or 0-7)", s)
+}
+
+// parseLogTimeArg accepts an RFC 3339 time or a duration before now.
+func parseLogTimeArg(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration such as 30m", s)
+	}
+	return now.Add(-d), nil
+}
+
+func logMaxLines(n int) int {
+	if n <= 0 {
+		n = 100
+	}
+	if n > logsConfig.MaxLines {
+		n = logsConfig.MaxLines
+	}
+	return n
+}
+
+// logCollector keeps the newest max matching entries in a ring.
+type logCollector struct {
+	max     int
+	entries []LogEntry
+	start   int // index of the oldest entry once the ring is full
+	matched int
+}
+
+func (c *logCollector) add(e LogEntry) {
+	c.matched++
+	if len(c.entries) < c.max {
+		c.entries = append(c.entries, e)
+		return
+	}
+	c.entries[c.start] = e
+	c.start = (c.start + 1) % c.max
+}
+
+// list returns the kept entries oldest first.
+func (c *logCollector) list() []LogEntry {
+	return append(c.entries[c.start:len(c.entries):len(c.entries)], c.entries[:c.start]...)
+}
+
+func readLogs(ctx context.Context, a ReadLogsArgs) (LogsResult, error) {
+	f, err := newLogFilter(a.Unit, a.Priority, a.Since, a.Until, a.Pattern, time.Now())
+	if err != nil {
+		return LogsResult{}, err
+	}
+	c := &logCollector{max: logMaxLines(a.MaxLines)}
+	source := a.Source
+	if source == "" {
+		source = JournalSource
+	}
+	if source == JournalSource {
+		err = readJournal(ctx, f, c)
+	} else {
+		if f.journalOnly() {
+			return LogsResult{}, errors.New("unit and priority filters only apply to the journal")
+		}
+		var path string
+		if path, err = allowedLogPath(source); err == nil {
+			err = readLogFile(ctx, path, f, c)
+		}
+	}
+	if err != nil {
+		return LogsResult{}, err
+	}
+	return finishLogs(c, nil), nil
+}
+
+func searchLogs(ctx context.Context, a SearchLogsArgs) (LogsResult, error) {
+	if a.Pattern == "" {
+		return LogsResult{}, errors.New("pattern is required")
+	}
+	f, err := newLogFilter(a.Unit, a.Priority, a.Since, a.Until, a.Pattern, time.Now())
+	if err != nil {
+		return LogsResult{}, err
+	}
+	maxLines := logMaxLines(a.MaxLines)
+
+	paths := a.Paths
+	if len(paths) == 0 {
+		if logsConfig.Journal {
+			paths = append(paths, JournalSource)
+		}
+		paths = append(paths, logsConfig.AllowedDirs...)
+	}
+	var files []string
+	searchJournal := false
+	var errs []string
+	for _, p := range paths {
+		if p == JournalSource {
+			searchJournal = true
+			continue
+		}
+		if f.journalOnly() {
+			continue
+		}
+		found, err := logFilesUnder(p)
+		if err != nil {
+			if len(a.Paths) > 0 {
+				return LogsResult{}, err
+			}
+			errs = append(errs, err.Error()) // a default directory that does not exist here
+			continue
+		}
+		files = append(files, found...)
+	}
+	if len(files) > maxLogFilesSearched {
+		files = files[:maxLogFilesSearched]
+		errs = append(errs, fmt.Sprintf("only the first %d log files were searched", maxLogFilesSearched))
+	}
+
+	// Keep the newest matches of each source, then the newest overall.
+	var all []LogEntry
+	matched := 0
+	if searchJournal {
+		c := &logCollector{max: maxLines}
+		if err := readJournal(ctx, f, c); err != nil {
+			errs = append(errs, err.Error())
+		}
+		all = append(all, c.list()...)
+		matched += c.matched
+	}
+	for _, path := range files {
+		if err := ctx.Err(); err != nil {
+			return LogsResult{}, err
+		}
+		c := &logCollector{max: maxLines}
+		if err := readLogFile(ctx, path, f, c); err != nil {
+			errs = append(errs, err.Error())
+		}
+		all = append(all, c.list()...)
+		matched += c.matched
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].t.Before(all[j].t) })
+	c := &logCollector{max: maxLines, matched: matched - len(all)}
+	for _, e := range all {
+		c.add(e)
+	}
+	out := finishLogs(c, errs)
+	out.FilesSearched = len(files)
+	return out, nil
+}
+
+// finishLogs redacts the collected entries and builds the result.
+func finishLogs(c *logCollector, errs []string) LogsResult {
+	out := LogsResult{Entries: c.list(), Matched: c.matched, Truncated: c.matched > len(c.entries), Errors: errs}
+	if out.Entries == nil {
+		out.Entries = []LogEntry{}
+	}
+	for i := range out.Entries {
+		e := &out.Entries[i]
+		e.Message, e.Redacted = redactor.String(e.Message)
+		if e.Redacted {
+			out.Redacted++
+		}
+		if !e.t.IsZero() {
+			e.Time = e.t.Format(time.RFC3339Nano)
+		}
+	}
+	return out
+}
+
+// allowedLogPath resolves p, following symlinks, and checks that it lies
+// under one of logs.allowed_dirs.
+func allowedLogPath(p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("log path %q must be absolute", p)
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", fmt.Errorf("failed to open log %s: %w", p, err)
+	}
+	for _, dir := range logsConfig.AllowedDirs {
+		d, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(d, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("log path %s is not under logs.allowed_dirs", p)
+}
+
+// logFilesUnder returns p if it is an allowed log file, or the text log
+// files below it if it is a directory.
+func logFilesUnder(p string) ([]string, error) {
+	path, err := allowedLogPath(p)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log %s: %w", p, err)
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	filepath.WalkDir(path, func(f string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable directories are skipped
+		}
+		if d.Type().IsRegular() && isTextLog(f) {
+			files = append(files, f)
+		}
+		return nil
+	})
+	return files, nil
+}
+
+// isTextLog skips journal files, login accounting databases and other
+// binary files so that directory searches only read text.
+func isTextLog(path string) bool {
+	switch filepath.Base(path) {
+	case "wtmp", "btmp", "lastlog", "faillog":
+		return false
+	}
+	if strings.HasSuffix(path, ".journal") || strings.HasSuffix(path, ".journal~") {
+		return false
+	}
+	if strings.HasSuffix(path, ".gz") {
+		return true
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	return !bytes.Contains(head[:n], []byte{0})
+}
+
+// readLogFile scans a plain or gzip-compressed log file. Lines without a
+// timestamp of their own (continuations, stack traces) take the time of
+// the line before.
+func readLogFile(ctx context.Context, path string, f logFilter, c *logCollector) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log %s: %w", path, err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to read log %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	now := time.Now()
+	br := bufio.NewReaderSize(r, maxLogMessageBytes+1)
+	var last time.Time
+	for n := 1; ; n++ {
+		if n%10000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line, err := readLogLine(br)
+		if line == "" && err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read log %s: %w", path, err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if t, ok := parseLogLineTime(line, now); ok {
+			last = t
+		}
+		e := LogEntry{Source: path, Line: n, Message: truncateLogMessage(line), t: last}
+		if f.match(&e) {
+			c.add(e)
+		}
+	}
+}
+
+// readLogLine reads one line of at most the reader's buffer size; the rest
+// of a longer line is skipped.
+func readLogLine(br *bufio.Reader) (string, error) {
+	b, err := br.ReadSlice('\n')
+	line := string(b)
+	for errors.Is(err, bufio.ErrBufferFull) {
+		_, err = br.ReadSlice('\n')
+	}
+	return line, err
+}
+
+// parseLogLineTime recognises the leading timestamp of common log formats:
+// RFC 3339 (rsyslog high precision and many application logs), "2006-01-02
+// 15:04:05" with or without fractional seconds, and the classic syslog
+// "Jan _2 15:04:05", which has no year.
+func parseLogLineTime(line string, now time.Time) (time.Time, bool) {
+	line = strings.TrimPrefix(line, "[")
+	if len(line) >= 19 && line[4] == '-' && line[7] == '-' {
+		if line[10] == 'T' {
+			stamp, _, _ := strings.Cut(line, " ")
+			if t, err := time.Parse(time.RFC3339Nano, strings.TrimSuffix(stamp, "]")); err == nil {
+				return t, true
+			}
+		}
+		t, err := time.ParseInLocation(time.DateTime, line[:10]+" "+line[11:19], time.Local)
+		return t, err == nil
+	}
+	if len(line) >= 15 {
+		t, err := time.ParseInLocation(time.Stamp, line[:15], time.Local)
+		if err != nil {
+			return time.Time{}, false
+		}
+		t = t.AddDate(now.Year(), 0, 0)
+		if t.After(now.Add(24 * time.Hour)) { // last year's entry read in January
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func truncateLogMessage(s string) string {
+	if len(s) <= maxLogMessageBytes {
+		return s
+	}
+	return s[:maxLogMessageBytes] + "..."
+}
+
+// journalArgs builds the journalctl command line for f. With grep the
+// pattern is handed to --grep so that journalctl, not this process, scans
+// the journal, and only the newest matches are read; one more than maxLines
+// is asked for so that truncation shows. Matches are checked again with the
+// Go regexp, whose syntax is close to but not the same as PCRE2's. Without
+// grep a pattern is only applied here, to the newest maxJournalScanned
+// entries.
+func journalArgs(f logFilter, maxLines int, grep bool) []string {
+	args := []string{"--output=json", "--no-pager", "--quiet"}
+	if f.unit != "" {
+		args = append(args, "--unit="+f.unit)
+	}
+	if f.priority >= 0 {
+		args = append(args, "--priority="+strconv.Itoa(f.priority))
+	}
+	if !f.since.IsZero() {
+		args = append(args, "--since=@"+strconv.FormatInt(f.since.Unix(), 10))
+	}
+	if !f.until.IsZero() {
+		args = append(args, "--until=@"+strconv.FormatInt(f.until.Unix(), 10))
+	}
+	switch {
+	case f.re == nil:
+	case grep:
+		// --grep is case-insensitive for lowercase patterns unless told otherwise.
+		args = append(args, "--grep="+f.re.String(), "--case-sensitive=true")
+	default:
+		maxLines = maxJournalScanned
+	}
+	return append(args, "--lines="+strconv.Itoa(maxLines+1))
+}
+
+// errJournalGrep is returned when journalctl refuses --grep: it was built
+// without PCRE2, predates --grep or --case-sensitive, or PCRE2 rejects the
+// pattern.
+var errJournalGrep = errors.New("journalctl cannot apply the pattern")
+
+// grepUnsupported recognises journalctl's complaints about --grep.
+func grepUnsupported(stderr string) bool {
+	s := strings.ToLower(stderr)
+	for _, m := range []string{"pattern", "pcre", "--grep", "--case-sensitive"} {
+		if strings.Contains(s, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// readJournal reads the journal entries matching f. If journalctl cannot
+// grep for the pattern, the journal is read again without --grep and the
+// pattern is applied here alone.
+func readJournal(ctx context.Context, f logFilter, c *logCollector) error {
+	if !logsConfig.Journal {
+		return errors.New("reading the journal is disabled; set logs.journal in the config file")
+	}
+	grep := f.re != nil
+	err := runJournalctl(ctx, f, c, grep)
+	if grep && errors.Is(err, errJournalGrep) {
+		*c = logCollector{max: c.max}
+		err = runJournalctl(ctx, f, c, false)
+	}
+	return err
+}
+
+func runJournalctl(ctx context.Context, f logFilter, c *logCollector, grep bool) error {
+	cmd := exec.CommandContext(ctx, journalctl, journalArgs(f, c.max, grep)...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to run journalctl: %w", err)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run journalctl: %w", err)
+	}
+	br := bufio.NewReader(stdout)
+	for {
+		line, rerr := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if e, ok := parseJournalEntry(line); ok && f.match(&e) {
+				c.add(e)
+			}
+		}
+		if rerr != nil {
+			break
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		if grep && c.matched == 0 && grepUnsupported(msg) {
+			return fmt.Errorf("%w: %s", errJournalGrep, msg)
+		}
+		return fmt.Errorf("journalctl failed: %s", msg)
+	}
+	return nil
+}
+
+// parseJournalEntry decodes one line of journalctl --output=json.
+func parseJournalEntry(line []byte) (LogEntry, bool) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return LogEntry{}, false
+	}
+	field := func(k string) string {
+		v, ok := raw[k]
+		if !ok {
+			return ""
+		}
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			return s
+		}
+		// Non-UTF-8 values are given as arrays of bytes.
+		var b []byte
+		var ints []int
+		if json.Unmarshal(v, &ints) == nil {
+			for _, i := range ints {
+				b = append(b, byte(i))
+			}
+			return string(b)
+		}
+		return ""
+	}
+
+	e := LogEntry{
+		Source:  JournalSource,
+		Unit:    field("_SYSTEMD_UNIT"),
+		Ident:   field("SYSLOG_IDENTIFIER"),
+		Message: truncateLogMessage(field("MESSAGE")),
+	}
+	if usec, err := strconv.ParseInt(field("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		e.t = time.UnixMicro(usec)
+	}
+	if pid, err := strconv.ParseInt(field("_PID"), 10, 32); err == nil {
+		e.PID = int32(pid)
+	}
+	if p, err := strconv.Atoi(field("PRIORITY")); err == nil && p >= 0 && p < len(priorityNames) {
+		e.Priority = priorityNames[p]
+	}
+	return e, true
+}
+
+// logsSummary describes a LogsResult for the text content.
+func logsSummary(r LogsResult) string {
+	msg := fmt.Sprintf("%d log entries retrieved", len(r.Entries))
+	if r.Truncated {
+		msg = fmt.Sprintf("Newest %d of %d matching log entries retrieved", len(r.Entries), r.Matched)
+	}
+	if r.Redacted > 0 {
+		msg += fmt.Sprintf(" (redacted sensitive data in %d)", r.Redacted)
+	}
+	return msg
+}
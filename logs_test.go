@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withLogsConfig points logsConfig at a temporary log directory and
+// journalctl at a script that records its arguments and prints journal.
+func withLogsConfig(t *testing.T, journal string) (dir, argsFile string) {
+	t.Helper()
+	dir = t.TempDir()
+	bin := t.TempDir()
+	argsFile = filepath.Join(bin, "args")
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "journal.json"), []byte(journal), 0o644))
+	script := "#!/bin/sh\necho \"$@\" > " + argsFile + "\ncat " + filepath.Join(bin, "journal.json") + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "journalctl"), []byte(script), 0o755))
+
+	savedCfg, savedCmd := logsConfig, journalctl
+	logsConfig = LogsConfig{AllowedDirs: []string{dir}, Journal: true, MaxLines: 1000}
+	journalctl = filepath.Join(bin, "journalctl")
+	t.Cleanup(func() { logsConfig, journalctl = savedCfg, savedCmd })
+	return dir, argsFile
+}
+
+const fakeJournal = `{"__REALTIME_TIMESTAMP":"1700000000000000","_SYSTEMD_UNIT":"web.service","SYSLOG_IDENTIFIER":"web","_PID":"42","PRIORITY":"6","MESSAGE":"started"}
+{"__REALTIME_TIMESTAMP":"1700000001000000","_SYSTEMD_UNIT":"web.service","SYSLOG_IDENTIFIER":"web","_PID":"42","PRIORITY":"3","MESSAGE":"connect failed: postgres://app:hunter2@db/app"}
+{"__REALTIME_TIMESTAMP":"1700000002000000","_SYSTEMD_UNIT":"web.service","PRIORITY":"3","MESSAGE":[98,105,110]}
+not json
+`
+
+func TestReadLogsJournal(t *testing.T) {
+	_, argsFile := withLogsConfig(t, fakeJournal)
+	ctx := context.Background()
+
+	out, err := readLogs(ctx, ReadLogsArgs{Unit: "web.service", Priority: "error", MaxLines: 2})
+	require.NoError(t, err)
+	args, _ := os.ReadFile(argsFile)
+	assert.Contains(t, string(args), "--unit=web.service")
+	assert.Contains(t, string(args), "--priority=3")
+	assert.Contains(t, string(args), "--lines=3", "one extra line to detect truncation")
+
+	require.Len(t, out.Entries, 2)
+	assert.Equal(t, 3, out.Matched)
+	assert.True(t, out.Truncated)
+	e := out.Entries[0]
+	assert.Equal(t, JournalSource, e.Source)
+	assert.Equal(t, "web.service", e.Unit)
+	assert.Equal(t, "web", e.Ident)
+	assert.Equal(t, int32(42), e.PID)
+	assert.Equal(t, "err", e.Priority)
+	assert.Equal(t, time.Unix(1700000001, 0).Format(time.RFC3339Nano), e.Time)
+	assert.Equal(t, "connect failed: postgres://app:"+RedactedText+"@db/app", e.Message)
+	assert.True(t, e.Redacted)
+	assert.Equal(t, 1, out.Redacted)
+	assert.Equal(t, "bin", out.Entries[1].Message, "byte-array messages are decoded")
+
+	out, err = readLogs(ctx, ReadLogsArgs{Pattern: "^start"})
+	require.NoError(t, err)
+	args, _ = os.ReadFile(argsFile)
+	assert.Contains(t, string(args), "--grep=^start --case-sensitive=true", "journalctl does the scanning")
+	assert.Contains(t, string(args), "--lines=101")
+	require.Len(t, out.Entries, 1)
+	assert.Equal(t, "started", out.Entries[0].Message)
+
+	logsConfig.Journal = false
+	_, err = readLogs(ctx, ReadLogsArgs{})
+	assert.ErrorContains(t, err, "disabled")
+}
+
+func TestReadLogsJournalWithoutGrep(t *testing.T) {
+	_, argsFile := withLogsConfig(t, fakeJournal)
+	// A journalctl built without PCRE2 refuses --grep but reads the journal.
+	script := "#!/bin/sh\necho \"$@\" >> " + argsFile + "\n" +
+		"case \"$*\" in *--grep*) echo 'Compiled without pattern matching support' >&2; exit 1;; esac\n" +
+		"cat " + filepath.Join(filepath.Dir(journalctl), "journal.json") + "\n"
+	require.NoError(t, os.WriteFile(journalctl, []byte(script), 0o755))
+	ctx := context.Background()
+
+	out, err := readLogs(ctx, ReadLogsArgs{Pattern: "failed", MaxLines: 5})
+	require.NoError(t, err)
+	require.Len(t, out.Entries, 1, "the pattern is applied in Go instead")
+	assert.Contains(t, out.Entries[0].Message, "connect failed")
+	assert.Equal(t, 1, out.Matched)
+
+	args, _ := os.ReadFile(argsFile)
+	calls := strings.Split(strings.TrimSpace(string(args)), "\n")
+	require.Len(t, calls, 2)
+	assert.Contains(t, calls[0], "--grep=failed")
+	assert.NotContains(t, calls[1], "--grep")
+	assert.Contains(t, calls[1], "--lines=100001", "the fallback scans a bounded number of entries")
+
+	out, err = searchLogs(ctx, SearchLogsArgs{Pattern: "^start", Paths: []string{JournalSource}})
+	require.NoError(t, err)
+	require.Len(t, out.Entries, 1)
+	assert.Empty(t, out.Errors)
+
+	// Other failures are reported, not retried.
+	require.NoError(t, os.WriteFile(argsFile, nil, 0o644))
+	require.NoError(t, os.WriteFile(journalctl, []byte("#!/bin/sh\necho \"$@\" >> "+argsFile+"\necho 'No journal files were found.' >&2\nexit 1\n"), 0o755))
+	_, err = readLogs(ctx, ReadLogsArgs{Pattern: "x"})
+	assert.ErrorContains(t, err, "No journal files")
+	args, _ = os.ReadFile(argsFile)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(args)), "\n"), 1)
+}
+
+func TestReadLogsFile(t *testing.T) {
+	dir, _ := withLogsConfig(t, "")
+	ctx := context.Background()
+	content := "2024-03-01T10:00:00Z app starting\n" +
+		"2024-03-01T10:05:00Z ERROR request failed token=abc123\n" +
+		"  at handler.go:10\n" +
+		"2024-03-01T10:10:00Z app healthy\n"
+	path := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	out, err := readLogs(ctx, ReadLogsArgs{Source: path})
+	require.NoError(t, err)
+	require.Len(t, out.Entries, 4)
+	assert.Equal(t, 3, out.Entries[2].Line)
+	assert.Equal(t, "2024-03-01T10:05:00Z", out.Entries[2].Time, "continuation lines take the previous timestamp")
+	assert.Contains(t, out.Entries[1].Message, "token="+RedactedText)
+
+	out, err = readLogs(ctx, ReadLogsArgs{Source: path, Since: "2024-03-01T10:04:00Z", Until: "2024-03-01T10:06:00Z"})
+	require.NoError(t, err)
+	require.Len(t, out.Entries, 2)
+	assert.Equal(t, 2, out.Entries[0].Line)
+
+	long := filepath.Join(dir, "long.log")
+	require.NoError(t, os.WriteFile(long, []byte(strings.Repeat("x", 3*maxLogMessageBytes)+"\nnext\n"), 0o644))
+	out, err = readLogs(ctx, ReadLogsArgs{Source: long})
+	require.NoError(t, err)
+	require.Len(t, out.Entries, 2, "an overlong line is cut, not split")
+	assert.Len(t, out.Entries[0].Message, maxLogMessageBytes+len("..."))
+	assert.Equal(t, "next", out.Entries[1].Message)
+
+	out, err = readLogs(ctx, ReadLogsArgs{Source: path, MaxLines: 1})
+	require.NoError(t, err)
+	require.Len(t, out.Entries, 1)
+	assert.Equal(t, 4, out.Entries[0].Line, "newest lines are kept")
+	assert.True(t, out.Truncated)
+
+	_, err = readLogs(ctx, ReadLogsArgs{Source: path, Unit: "web.service"})
+	assert.Error(t, err, "unit filter does not apply to files")
+
+	outside := filepath.Join(t.TempDir(), "secret.log")
+	require.NoError(t, os.WriteFile(outside, []byte("x\n"), 0o644))
+	_, err = readLogs(ctx, ReadLogsArgs{Source: outside})
+	assert.ErrorContains(t, err, "allowed_dirs")
+
+	link := filepath.Join(dir, "link.log")
+	require.NoError(t, os.Symlink(outside, link))
+	_, err = readLogs(ctx, ReadLogsArgs{Source: link})
+	assert.ErrorContains(t, err, "allowed_dirs", "symlinks out of the allowed directories are refused")
+
+	_, err = readLogs(ctx, ReadLogsArgs{Source: filepath.Join(dir, "..", filepath.Base(filepath.Dir(outside)), "secret.log")})
+	assert.Error(t, err)
+}
+
+func TestSearchLogs(t *testing.T) {
+	dir, _ := withLogsConfig(t, fakeJournal)
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "syslog"), []byte("Mar  1 10:00:00 host kernel: Out of memory: Killed process 7\n"), 0o644))
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("Feb 28 09:00:00 host kernel: Out of memory: Killed process 3\n"))
+	w.Close()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "syslog.1.gz"), gz.Bytes(), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "wtmp"), []byte("Out of memory"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "binary.dat"), []byte("Out of memory\x00\x01"), 0o644))
+
+	out, err := searchLogs(ctx, SearchLogsArgs{Pattern: "Out of memory|failed"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, out.FilesSearched, "binary files and login databases are skipped")
+	require.Len(t, out.Entries, 3)
+	assert.Equal(t, 3, out.Matched)
+	assert.Equal(t, JournalSource, out.Entries[0].Source, "oldest first: the journal entry is from 2023")
+	assert.Contains(t, out.Entries[1].Message, "process 3")
+	assert.Contains(t, out.Entries[2].Message, "process 7")
+
+	out, err = searchLogs(ctx, SearchLogsArgs{Pattern: "Out of memory", Paths: []string{filepath.Join(dir, "syslog")}})
+	require.NoError(t, err)
+	require.Len(t, out.Entries, 1)
+
+	out, err = searchLogs(ctx, SearchLogsArgs{Pattern: ".", Unit: "web.service"})
+	require.NoError(t, err)
+	assert.Zero(t, out.FilesSearched, "unit restricts the search to the journal")
+
+	_, err = searchLogs(ctx, SearchLogsArgs{})
+	assert.Error(t, err)
+	_, err = searchLogs(ctx, SearchLogsArgs{Pattern: "("})
+	assert.Error(t, err)
+	_, err = searchLogs(ctx, SearchLogsArgs{Pattern: "x", Paths: []string{"/etc"}})
+	assert.ErrorContains(t, err, "allowed_dirs")
+}
+
+func TestParseLogLineTime(t *testing.T) {
+	now := time.Date(2024, 1, 5, 12, 0, 0, 0, time.Local)
+	for line, want := range map[string]time.Time{
+		"2024-01-02T03:04:05.5Z msg":       time.Date(2024, 1, 2, 3, 4, 5, 500000000, time.UTC),
+		"[2024-01-02T03:04:05+00:00] msg":  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2024-01-02 03:04:05,123 INFO msg": time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local),
+		"Jan  2 03:04:05 host sshd[1]: x":  time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local),
+		"Dec 31 23:00:00 host cron: x":     time.Date(2023, 12, 31, 23, 0, 0, 0, time.Local),
+	} {
+		got, ok := parseLogLineTime(line, now)
+		if assert.True(t, ok, line) {
+			assert.True(t, want.Equal(got), "%s: got %v", line, got)
+		}
+	}
+	for _, line := range []string{"", "  at handler.go:10", "plain message", strings.Repeat("x", 30)} {
+		_, ok := parseLogLineTime(line, now)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	for in, want := range map[string]int{"emerg": 0, "3": 3, "error": 3, "WARN": 4, "debug": 7} {
+		got, err := parsePriority(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := parsePriority("loud")
+	assert.Error(t, err)
+	_, err = parsePriority("8")
+	assert.Error(t, err)
+}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
@@ -60,6 +67,7 @@ type CPUInfo struct {
 	Speed         float64   `json:"speed_mhz"`
 	CacheSize     int32     `json:"cache_size"`
 	Flags         []string  `json:"flags,omitempty"`
+	Container     *CPULimit `json:"container,omitempty"` // set when the server's cgroup has fewer CPUs than the host
 }
 
 type MemoryInfo struct {
@@ -73,6 +81,8 @@ type MemoryInfo struct {
 	SwapTotal   uint64  `json:"swap_total_bytes"`
 	SwapUsed    uint64  `json:"swap_used_bytes"`
 	SwapFree    uint64  `json:"swap_free_bytes"`
+
+	Container *MemoryLimit `json:"container,omitempty"` // set when the server's cgroup has a memory limit below total
 }
 
 type DiskInfo struct {
@@ -86,22 +96,39 @@ type DiskInfo struct {
 	InodesTotal uint64  `json:"inodes_total"`
 	InodesUsed  uint64  `json:"inodes_used"`
 	InodesFree  uint64  `json:"inodes_free"`
+	ReadOnly    bool    `json:"read_only,omitempty"` // mounted ro
 }
 
 type NetworkInfo struct {
-	Interface   string `json:"interface"`
-	BytesSent   uint64 `json:"bytes_sent"`
-	BytesRecv   uint64 `json:"bytes_recv"`
-	PacketsSent uint64 `json:"packets_sent"`
-	PacketsRecv uint64 `json:"packets_recv"`
-	Errin       uint64 `json:"errors_in"`
-	Errout      uint64 `json:"errors_out"`
-	Dropin      uint64 `json:"drops_in"`
-	Dropout     uint64 `json:"drops_out"`
+	Interface   string        `json:"interface"`
+	BytesSent   uint64        `json:"bytes_sent"`
+	BytesRecv   uint64        `json:"bytes_recv"`
+	PacketsSent uint64        `json:"packets_sent"`
+	PacketsRecv uint64        `json:"packets_recv"`
+	Errin       uint64        `json:"errors_in"`
+	Errout      uint64        `json:"errors_out"`
+	Dropin      uint64        `json:"drops_in"`
+	Dropout     uint64        `json:"drops_out"`
+	Rates       *NetworkRates `json:"rates,omitempty"`
+}
+
+// NetworkRates are per-second rates derived from two counter readings.
+type NetworkRates struct {
+	WindowSeconds     float64 `json:"window_seconds"`
+	Source            string  `json:"source"` // "window" (sampled during the call) or "sampler" (since the previous background sample)
+	BytesSentPerSec   float64 `json:"bytes_sent_per_sec"`
+	BytesRecvPerSec   float64 `json:"bytes_recv_per_sec"`
+	PacketsSentPerSec float64 `json:"packets_sent_per_sec"`
+	PacketsRecvPerSec float64 `json:"packets_recv_per_sec"`
+	ErrinPerSec       float64 `json:"errors_in_per_sec"`
+	ErroutPerSec      float64 `json:"errors_out_per_sec"`
+	DropinPerSec      float64 `json:"drops_in_per_sec"`
+	DropoutPerSec     float64 `json:"drops_out_per_sec"`
 }
 
 type ProcessInfo struct {
 	PID           int32    `json:"pid"`
+	PPID          int32    `json:"ppid"`
 	Name          string   `json:"name"`
 	Status        string   `json:"status"`
 	CPUPercent    float64  `json:"cpu_percent"`
@@ -112,6 +139,9 @@ type ProcessInfo struct {
 	NumThreads    int32    `json:"num_threads"`
 	Username      string   `json:"username,omitempty"`
 	Cmdline       []string `json:"cmdline,omitempty"`
+	Redacted      bool     `json:"redacted,omitempty"` // username or cmdline was altered by the redaction policy
+
+	MemoryDetail *MemoryBreakdown `json:"memory_detail,omitempty"`
 }
 
 type DiskInfoResult struct {
@@ -123,8 +153,10 @@ type NetworkInfoResult struct {
 }
 
 type ProcessInfoResult struct {
-	Processes []ProcessInfo `json:"processes"`
-	Count     int           `json:"count"`
+	Processes   []ProcessInfo `json:"processes"`
+	Count       int           `json:"count"`
+	CPUWindowMs int64         `json:"cpu_window_ms"`            // window cpu_percent was measured over
+	Redacted    int           `json:"redacted_count,omitempty"` // processes altered by the redaction policy
 }
 
 type LoadAvgResult struct {
@@ -139,7 +171,7 @@ type SystemInfoArgs struct{}
 
 type CPUInfoArgs struct {
 	PerCPU     bool `json:"per_cpu,omitempty"`     // get per-CPU usage if true
-	IntervalMs int  `json:"interval_ms,omitempty"` // sampling window in ms (100..10000), default 1000
+	IntervalMs int  `json:"interval_ms,omitempty"` // sampling window in ms (100..10000 unless configured), default 1000
 }
 
 type MemoryInfoArgs struct{}
@@ -149,14 +181,18 @@ type DiskInfoArgs struct {
 }
 
 type NetworkInfoArgs struct {
-	Interface string `json:"interface,omitempty"` // specific interface to include
+	Interface  string `json:"interface,omitempty"`   // specific interface to include
+	IntervalMs int    `json:"interval_ms,omitempty"` // rate window in ms (same bounds as get_cpu_info); if 0, rates come from the background sampler when it is running
 }
 
 type ProcessInfoArgs struct {
-	PID    int32  `json:"pid,omitempty"`     // specific PID
-	Name   string `json:"name,omitempty"`    // filter by name substring
-	Limit  int    `json:"limit,omitempty"`   // max results (1..200, default 10)
-	SortBy string `json:"sort_by,omitempty"` // cpu|memory|pid|name
+	PID        int32  `json:"pid,omitempty"`         // specific PID
+	Name       string `json:"name,omitempty"`        // filter by name substring
+	Limit      int    `json:"limit,omitempty"`       // max results (1..200, default 10 unless configured)
+	SortBy     string `json:"sort_by,omitempty"`     // cpu|memory|pid|name
+	IntervalMs int    `json:"interval_ms,omitempty"` // CPU sampling window in ms (same bounds as get_cpu_info), default 1000
+
+	MemoryDetail bool `json:"memory_detail,omitempty"` // add PSS/USS/shared/private/swap from smaps; with pid, also the largest mappings
 }
 
 type LoadAverageArgs struct{}
@@ -164,37 +200,210 @@ type LoadAverageArgs struct{}
 // --- Main ---
 
 func main() {
-	fmt.Fprintf(os.Stderr, "Starting %s server...\n", ServerName)
+	opts, err := parseFlags(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
 
 	// --version / -v
-	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-v") {
+	if opts.ShowVersion {
 		fmt.Printf("%s version %s\n", ServerName, Version)
 		os.Exit(0)
 	}
 
-	// STDIO transport
+	cfg := opts.Config
+	slog.SetDefault(newLogger(cfg.Logging, os.Stderr, nil))
+	slog.Info("Starting server", "name", ServerName, "version", Version)
+	if opts.ConfigPath != "" {
+		slog.Info("Loaded config", "path", opts.ConfigPath)
+	}
+	limits = cfg.Limits
+	logsConfig = cfg.Logs
+	diagnoseConfig = cfg.Diagnose
+	redactor, _ = NewRedactor(cfg.Redaction) // patterns already checked by Config.validate
+
+	// Stop cleanly on Ctrl-C and on SIGTERM from a service manager or container runtime.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Sampler.Enabled {
+		sampler = NewSampler(cfg.Sampler)
+		alerter = NewAlerter(cfg.Alerts)
+		sampler.OnSample(alerter.Observe)
+	}
+
+	if cfg.Control.Enabled {
+		controller, err = NewController(cfg.Control)
+		if err != nil {
+			slog.Error("Config error", "error", err)
+			os.Exit(2)
+		}
+		defer controller.Close()
+		slog.Info("Process control tools enabled", "dry_run", cfg.Control.DryRun)
+	}
+
+	watcher := newResourceWatcher(cfg.Resources)
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    ServerName,
 		Version: ServerVersion,
-	}, nil)
+	}, watcher.serverOptions())
+	// From here on, clients can receive the server's log as well.
+	slog.SetDefault(newLogger(cfg.Logging, os.Stderr, server))
 
-	registerTools(server)
+	if err := registerTools(server, &cfg); err != nil {
+		slog.Error("Config error", "error", err)
+		os.Exit(2)
+	}
+	registerResources(server)
+	go watcher.Run(ctx, server)
 
-	fmt.Fprintf(os.Stderr, "Server created, starting transport...\n")
-	transport := &mcp.StdioTransport{}
+	// Start sampling once the server exists so that alerts have somewhere to go.
+	if sampler != nil {
+		alerter.notify = alertNotifier(ctx, server)
+		alerter.sessions = server.Sessions
+		go sampler.Run(ctx)
+		slog.Info("Sampling metrics", "interval_ms", cfg.Sampler.IntervalMs, "alert_rules", len(cfg.Alerts.Rules))
+	}
 
-	fmt.Fprintf(os.Stderr, "Running server...\n")
-	if err := server.Run(context.Background(), transport); err != nil {
-		fmt.Fprintf(os.Stderr, "Server error: %v\n", err)
-		log.Fatalf("Server error: %v", err)
+	if cfg.Metrics.Enabled {
+		go func() {
+			if err := runMetricsServer(ctx, cfg.Metrics); err != nil {
+				slog.Error("Metrics exporter failed", "error", err)
+			}
+		}()
+		slog.Info("Serving Prometheus metrics", "url", "http://"+cfg.Metrics.Addr+cfg.Metrics.Path)
 	}
+
+	telemetryDone := make(chan struct{})
+	if cfg.Telemetry.Exporter != "" {
+		// With the stdio transport stdout carries MCP, so print spans to stderr.
+		out := io.Writer(os.Stdout)
+		if cfg.Transport.Type == TransportStdio {
+			out = os.Stderr
+		}
+		if telemetry, err = NewTelemetry(cfg.Telemetry, out); err != nil {
+			slog.Error("Config error", "error", err)
+			os.Exit(2)
+		}
+		go func() {
+			telemetry.Run(ctx)
+			close(telemetryDone)
+		}()
+		slog.Info("Exporting tool call telemetry", "exporter", cfg.Telemetry.Exporter)
+	} else {
+		close(telemetryDone)
+	}
+
+	tc := cfg.Transport
+	if tc.Type == TransportStdio {
+		slog.Info("Running server", "transport", tc.Type)
+	} else {
+		slog.Info("Running server", "transport", tc.Type, "addr", tc.Addr)
+		if !tc.Auth.Enabled() {
+			slog.Warn("Transport has no authentication; use --auth-token-file or --tls-client-ca", "transport", tc.Type)
+		}
+	}
+
+	if err := runServer(ctx, server, tc); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+	stop()
+	<-telemetryDone // final export
+	slog.Info("Server stopped")
+}
+
+// --- Command line ---
+
+type cliOptions struct {
+	ConfigPath  string
+	ShowVersion bool
+	Config      Config // config file (or defaults) with explicitly set flags applied on top
+}
+
+func parseFlags(args []string) (cliOptions, error) {
+	var opts cliOptions
+	var flagCfg TransportConfig
+	fs := flag.NewFlagSet(ServerName, flag.ContinueOnError)
+	fs.StringVar(&opts.ConfigPath, "config", "", "path to a YAML config file (default $"+ConfigEnvVar+")")
+	fs.StringVar(&flagCfg.Type, "transport", TransportStdio, "transport to serve: stdio, http (streamable HTTP) or sse")
+	fs.StringVar(&flagCfg.Addr, "addr", DefaultListenAddr, "listen address for the http and sse transports")
+	fs.StringVar(&flagCfg.Auth.TokenFile, "auth-token-file", "", "file of accepted bearer tokens, one per line (http/sse only)")
+	fs.StringVar(&flagCfg.Auth.TLSCertFile, "tls-cert", "", "TLS certificate file (PEM) for the http and sse transports")
+	fs.StringVar(&flagCfg.Auth.TLSKeyFile, "tls-key", "", "TLS private key file (PEM)")
+	fs.StringVar(&flagCfg.Auth.ClientCAFile, "tls-client-ca", "", "CA bundle (PEM) used to verify client certificates; enables mutual TLS")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address (enables the exporter)")
+	var flagLog LoggingConfig
+	fs.StringVar(&flagLog.Level, "log-level", "info", "log level: debug, info, warn or error")
+	fs.StringVar(&flagLog.Format, "log-format", LogFormatText, "log format: text or json")
+	fs.BoolVar(&opts.ShowVersion, "version", false, "print version and exit")
+	fs.BoolVar(&opts.ShowVersion, "v", false, "print version and exit (shorthand)")
+	if err := fs.Parse(args); err != nil {
+		return cliOptions{}, err
+	}
+	if opts.ShowVersion {
+		return opts, nil
+	}
+
+	fail := func(err error) (cliOptions, error) {
+		fmt.Fprintln(fs.Output(), err)
+		return cliOptions{}, err
+	}
+
+	if opts.ConfigPath == "" {
+		opts.ConfigPath = os.Getenv(ConfigEnvVar)
+	}
+	opts.Config = DefaultConfig()
+	if opts.ConfigPath != "" {
+		cfg, err := LoadConfig(opts.ConfigPath)
+		if err != nil {
+			return fail(err)
+		}
+		opts.Config = cfg
+	}
+
+	tc := &opts.Config.Transport
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "transport":
+			tc.Type = flagCfg.Type
+		case "addr":
+			tc.Addr = flagCfg.Addr
+		case "auth-token-file":
+			tc.Auth.TokenFile = flagCfg.Auth.TokenFile
+		case "tls-cert":
+			tc.Auth.TLSCertFile = flagCfg.Auth.TLSCertFile
+		case "tls-key":
+			tc.Auth.TLSKeyFile = flagCfg.Auth.TLSKeyFile
+		case "tls-client-ca":
+			tc.Auth.ClientCAFile = flagCfg.Auth.ClientCAFile
+		case "metrics-addr":
+			opts.Config.Metrics.Enabled = true
+			opts.Config.Metrics.Addr = *metricsAddr
+		case "log-level":
+			opts.Config.Logging.Level = flagLog.Level
+		case "log-format":
+			opts.Config.Logging.Format = flagLog.Format
+		}
+	})
+	if err := opts.Config.validate(); err != nil {
+		return fail(err)
+	}
+	return opts, nil
 }
 
 // --- Tool registration ---
 
-func registerTools(server *mcp.Server) {
+// registerTools adds every tool enabled in cfg (nil enables all defaults).
+// It fails if cfg names a tool that does not exist.
+func registerTools(server *mcp.Server, cfg *Config) error {
+	reg := &toolRegistry{server: server, cfg: cfg, known: make(map[string]bool)}
+
 	// System info
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(reg, &mcp.Tool{
 		Name:        "get_system_info",
 		Description: "Get comprehensive system information including hostname, OS, platform, uptime, etc.",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, _ SystemInfoArgs) (*mcp.CallToolResult, any, error) {
@@ -206,7 +415,7 @@ func registerTools(server *mcp.Server) {
 	})
 
 	// CPU info
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(reg, &mcp.Tool{
 		Name:        "get_cpu_info",
 		Description: "Get detailed CPU usage statistics and information",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, a CPUInfoArgs) (*mcp.CallToolResult, any, error) {
@@ -218,7 +427,7 @@ func registerTools(server *mcp.Server) {
 	})
 
 	// Memory info
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(reg, &mcp.Tool{
 		Name:        "get_memory_info",
 		Description: "Get memory usage information including RAM and swap",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, _ MemoryInfoArgs) (*mcp.CallToolResult, any, error) {
@@ -230,7 +439,7 @@ func registerTools(server *mcp.Server) {
 	})
 
 	// Disk info
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(reg, &mcp.Tool{
 		Name:        "get_disk_info",
 		Description: "Get disk usage information for all partitions or a specific path",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, a DiskInfoArgs) (*mcp.CallToolResult, any, error) {
@@ -241,12 +450,24 @@ func registerTools(server *mcp.Server) {
 		return textOK("Disk information retrieved"), out, nil
 	})
 
+	// Disk I/O
+	addTool(reg, &mcp.Tool{
+		Name:        "get_disk_io",
+		Description: "Get per-device disk I/O statistics (IOPS, throughput, await, utilization) sampled over a time window",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a DiskIOArgs) (*mcp.CallToolResult, any, error) {
+		out, err := getDiskIO(ctx, a.Device, a.IntervalMs)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK("Disk I/O statistics retrieved"), out, nil
+	})
+
 	// Network info
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(reg, &mcp.Tool{
 		Name:        "get_network_info",
-		Description: "Get network interface statistics and information",
+		Description: "Get network interface statistics with per-second throughput, packet, error and drop rates",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, a NetworkInfoArgs) (*mcp.CallToolResult, any, error) {
-		out, err := getNetworkInfo(ctx, a.Interface)
+		out, err := getNetworkInfo(ctx, a.Interface, a.IntervalMs)
 		if err != nil {
 			return textErr(err), nil, err
 		}
@@ -254,19 +475,151 @@ func registerTools(server *mcp.Server) {
 	})
 
 	// Process info
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(reg, &mcp.Tool{
 		Name:        "get_process_info",
-		Description: "Get information about running processes with filtering and sorting options",
+		Description: "Get information about running processes with filtering and sorting options; CPU usage is measured over a short sampling window, like top; memory_detail adds a PSS/USS breakdown from smaps",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, a ProcessInfoArgs) (*mcp.CallToolResult, any, error) {
-		out, err := getProcessInfo(ctx, a.PID, a.Name, a.Limit, a.SortBy)
+		out, err := getProcessInfo(ctx, a.PID, a.Name, a.Limit, a.SortBy, a.IntervalMs, a.MemoryDetail)
 		if err != nil {
 			return textErr(err), nil, err
 		}
+		if out.Redacted > 0 {
+			return textOK(fmt.Sprintf("Process information retrieved (redacted sensitive data in %d of %d processes)", out.Redacted, out.Count)), out, nil
+		}
 		return textOK("Process information retrieved"), out, nil
 	})
 
+	// Process tree
+	addTool(reg, &mcp.Tool{
+		Name:        "get_process_tree",
+		Description: "Get the parent/child process tree rooted at PID 1 or a given PID, with CPU and RSS totals per subtree; supports depth limiting and name filtering",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a ProcessTreeArgs) (*mcp.CallToolResult, any, error) {
+		out, err := getProcessTree(ctx, a.PID, a.MaxDepth, a.Name, a.IntervalMs)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK("Process tree retrieved"), out, nil
+	})
+
+	// Open files and connections of one process
+	addTool(reg, &mcp.Tool{
+		Name:        "get_process_files",
+		Description: "Get the open files, TCP/UDP/unix connections and file descriptor count versus RLIMIT_NOFILE of a process",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a ProcessFilesArgs) (*mcp.CallToolResult, any, error) {
+		out, err := getProcessFiles(ctx, a.PID, a.MaxItems)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK("Process files retrieved"), out, nil
+	})
+
+	// System-wide sockets
+	addTool(reg, &mcp.Tool{
+		Name:        "get_connections",
+		Description: "List TCP, UDP and unix sockets with state, addresses and owning process, filtered by protocol, port, state or PID, with counts per state",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a ConnectionsArgs) (*mcp.CallToolResult, any, error) {
+		out, err := getConnections(ctx, a.Protocol, a.Port, a.State, a.PID, a.Limit)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(fmt.Sprintf("Connections retrieved (%d matching sockets)", out.Total)), out, nil
+	})
+
+	// cgroup v2 accounting
+	addTool(reg, &mcp.Tool{
+		Name:        "get_cgroup_stats",
+		Description: "Walk the cgroup v2 hierarchy and report memory, CPU throttling, I/O, PID counts and pressure (PSI) per cgroup; can start from the cgroup of a given PID",
+	}, func(_ context.Context, _ *mcp.CallToolRequest, a CgroupStatsArgs) (*mcp.CallToolResult, any, error) {
+		out, err := getCgroupStats(a.Path, a.PID, a.MaxDepth, a.SortBy, a.Limit)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(fmt.Sprintf("cgroup statistics retrieved (%d cgroups)", out.Total)), out, nil
+	})
+
+	// Logs
+	addTool(reg, &mcp.Tool{
+		Name:        "read_logs",
+		Description: "Read the newest entries of the systemd journal or of a log file under the allowed directories, filtered by unit, priority, time range and regex; secrets are redacted",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a ReadLogsArgs) (*mcp.CallToolResult, any, error) {
+		out, err := readLogs(ctx, a)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(logsSummary(out)), out, nil
+	})
+	addTool(reg, &mcp.Tool{
+		Name:        "search_logs",
+		Description: "Search the systemd journal and the log files under the allowed directories (including rotated .gz files) for a regex, returning the newest matches; secrets are redacted",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a SearchLogsArgs) (*mcp.CallToolResult, any, error) {
+		out, err := searchLogs(ctx, a)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(logsSummary(out)), out, nil
+	})
+
+	// systemd units
+	addTool(reg, &mcp.Tool{
+		Name:        "list_units",
+		Description: "List systemd units (services by default) with load, active and sub state, counts per state, and the status of every failed unit including result, last exit code and restart count",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a ListUnitsArgs) (*mcp.CallToolResult, any, error) {
+		out, err := listUnits(ctx, a)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(unitsSummary(out)), out, nil
+	})
+	addTool(reg, &mcp.Tool{
+		Name:        "get_unit_status",
+		Description: "Get the status of a systemd unit: active/sub state, result, main PID, restart count, last exit code or signal, memory/CPU/task accounting and its newest journal lines",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a UnitStatusArgs) (*mcp.CallToolResult, any, error) {
+		out, err := getUnitStatus(ctx, a)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		msg := fmt.Sprintf("%s is %s (%s)", out.Name, out.Active, out.Sub)
+		if out.LastExit != "" {
+			msg += "; main process " + out.LastExit
+		}
+		return textOK(msg), out, nil
+	})
+
+	// Process control, only when enabled in the config
+	control := cfg != nil && cfg.Control.Enabled
+	addOptInTool(reg, control, &mcp.Tool{
+		Name:        "send_signal",
+		Description: "Send a signal (default TERM) to a process allowed by the server's control policy; every call is audit-logged and dry_run reports what would happen",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a SendSignalArgs) (*mcp.CallToolResult, any, error) {
+		out, err := sendSignal(ctx, controller, a.PID, a.Signal, a.DryRun)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(controlSummary(out)), out, nil
+	})
+	addOptInTool(reg, control, &mcp.Tool{
+		Name:        "renice",
+		Description: "Change the nice value of a process allowed by the server's control policy; every call is audit-logged and dry_run reports what would happen",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a ReniceArgs) (*mcp.CallToolResult, any, error) {
+		out, err := renice(ctx, controller, a.PID, a.Nice, a.DryRun)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(controlSummary(out)), out, nil
+	})
+	addOptInTool(reg, control, &mcp.Tool{
+		Name:        "kill_process_tree",
+		Description: "Signal a process and all of its descendants, parents first; refused unless every process is allowed by the control policy. Audit-logged; dry_run reports what would happen",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a KillProcessTreeArgs) (*mcp.CallToolResult, any, error) {
+		out, err := killProcessTree(ctx, controller, a.PID, a.Signal, a.DryRun)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(controlSummary(out)), out, nil
+	})
+
 	// Load average
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(reg, &mcp.Tool{
 		Name:        "get_load_average",
 		Description: "Get system load average (1, 5, and 15 minute averages)",
 	}, func(ctx context.Context, _ *mcp.CallToolRequest, _ LoadAverageArgs) (*mcp.CallToolResult, any, error) {
@@ -276,6 +629,132 @@ func registerTools(server *mcp.Server) {
 		}
 		return textOK("Load average retrieved"), out, nil
 	})
+
+	// Pressure stall information
+	addTool(reg, &mcp.Tool{
+		Name:        "get_pressure",
+		Description: "Get system-wide pressure stall information (PSI) for CPU, memory, I/O and IRQ: share of time tasks were stalled over 10s, 60s and 300s plus total stall time; wait mode blocks until a pressure threshold is crossed or a timeout elapses",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a PressureArgs) (*mcp.CallToolResult, any, error) {
+		out, err := getPressure(ctx, a)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		if w := out.Wait; w != nil {
+			if w.Triggered {
+				return textOK(fmt.Sprintf("%s pressure (%s) exceeded %dms stalled per %dms window after %.0fms", w.Resource, w.Kind, w.ThresholdMs, w.WindowMs, w.WaitedMs)), out, nil
+			}
+			return textOK(fmt.Sprintf("%s pressure (%s) stayed below threshold for %.0fms", w.Resource, w.Kind, w.WaitedMs)), out, nil
+		}
+		return textOK("Pressure information retrieved"), out, nil
+	})
+
+	// Health check
+	addTool(reg, &mcp.Tool{
+		Name:        "diagnose_system",
+		Description: "Run the system, CPU, memory, disk, load and process collectors at once and check them against the configured rules (disk and inode usage, memory, swap, CPU, load per core, zombie processes, memory hogs); returns findings ordered by severity with supporting evidence",
+	}, func(ctx context.Context, _ *mcp.CallToolRequest, a DiagnoseArgs) (*mcp.CallToolResult, any, error) {
+		out, err := diagnoseSystem(ctx, a.IntervalMs)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(diagnoseSummary(out)), out, nil
+	})
+
+	// Alerts
+	addTool(reg, &mcp.Tool{
+		Name:        "list_alerts",
+		Description: "List firing and pending threshold alerts, recently resolved ones and the alert rules; alerts are evaluated on every background sample and firing/resolving ones are also sent as log notifications (logger \"alerts\") and as updates of the " + AlertsResourceURI + " resource",
+	}, func(_ context.Context, req *mcp.CallToolRequest, _ ListAlertsArgs) (*mcp.CallToolResult, any, error) {
+		if alerter == nil {
+			return textErr(errAlertsDisabled), nil, errAlertsDisabled
+		}
+		out := alerter.List(req.Session)
+		return textOK(alertsSummary(out)), out, nil
+	})
+
+	addTool(reg, &mcp.Tool{
+		Name:        "add_alert_rule",
+		Description: "Add a threshold alert rule on a sampled metric, e.g. \"memory.used_percent > 95 for 60s\" or \"disk.*.used_percent >= 90\" (* matches any run of characters; metric names as in get_metric_history); the rule belongs to this session, which alone is notified when it fires and resolves and loses the rule when it disconnects",
+	}, func(_ context.Context, req *mcp.CallToolRequest, a AddAlertRuleArgs) (*mcp.CallToolResult, any, error) {
+		out, err := addAlertRule(alerter, sampler, req.Session, a)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		msg := fmt.Sprintf("Alert rule %q added, covering %d metrics", out.Rule.Name, len(out.Matches))
+		if len(out.Matches) == 0 {
+			msg = fmt.Sprintf("Alert rule %q added, but no sampled metric matches %s yet", out.Rule.Name, out.Rule.Metric)
+		}
+		return textOK(msg), out, nil
+	})
+
+	addTool(reg, &mcp.Tool{
+		Name:        "remove_alert_rule",
+		Description: "Remove an alert rule added with add_alert_rule; its firing alerts are resolved",
+	}, func(_ context.Context, req *mcp.CallToolRequest, a RemoveAlertRuleArgs) (*mcp.CallToolResult, any, error) {
+		if alerter == nil {
+			return textErr(errAlertsDisabled), nil, errAlertsDisabled
+		}
+		if err := alerter.RemoveRule(req.Session, a.Name); err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK(fmt.Sprintf("Alert rule %q removed", a.Name)), nil, nil
+	})
+
+	// Metric history
+	addTool(reg, &mcp.Tool{
+		Name:        "get_metric_history",
+		Description: "Get recent history of CPU, memory, load, disk and network metrics recorded by the background sampler, optionally downsampled",
+	}, func(_ context.Context, _ *mcp.CallToolRequest, a MetricHistoryArgs) (*mcp.CallToolResult, any, error) {
+		out, err := getMetricHistory(sampler, a)
+		if err != nil {
+			return textErr(err), nil, err
+		}
+		return textOK("Metric history retrieved"), out, nil
+	})
+
+	return reg.checkConfig()
+}
+
+// toolRegistry tracks which tools exist so the config can be checked for
+// names that match nothing.
+type toolRegistry struct {
+	server *mcp.Server
+	cfg    *Config
+	known  map[string]bool
+}
+
+// addTool registers t with the server unless the config disables it.
+func addTool[In any](reg *toolRegistry, t *mcp.Tool, h mcp.ToolHandlerFor[In, any]) {
+	reg.known[t.Name] = true
+	if reg.cfg.ToolEnabled(t.Name) {
+		mcp.AddTool(reg.server, t, instrumentTool(t.Name, logTool(t.Name, h)))
+	}
+}
+
+// addOptInTool is addTool for tools that stay off unless their feature is
+// enabled; the config may still name them.
+func addOptInTool[In any](reg *toolRegistry, enabled bool, t *mcp.Tool, h mcp.ToolHandlerFor[In, any]) {
+	reg.known[t.Name] = true
+	if enabled && reg.cfg.ToolEnabled(t.Name) {
+		mcp.AddTool(reg.server, t, instrumentTool(t.Name, logTool(t.Name, h)))
+	}
+}
+
+func (reg *toolRegistry) checkConfig() error {
+	if reg.cfg == nil {
+		return nil
+	}
+	var unknown []string
+	for name := range reg.cfg.Tools {
+		if !reg.known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("config enables or disables unknown tools: %s", strings.Join(unknown, ", "))
+	}
+	return nil
 }
 
 func textOK(msg string) *mcp.CallToolResult {
@@ -317,17 +796,31 @@ func getSystemInfo(ctx context.Context) (SystemInfo, error) {
 	}, nil
 }
 
+// sampleWindow returns how long to sample for when a tool is asked for an
+// interval of intervalMs, clamped to the configured limits. Zero or less
+// selects the configured default.
+func sampleWindow(intervalMs int) time.Duration {
+	if intervalMs <= 0 {
+		return time.Duration(limits.CPUIntervalDefaultMs) * time.Millisecond
+	}
+	intervalMs = max(intervalMs, limits.CPUIntervalMinMs)
+	intervalMs = min(intervalMs, limits.CPUIntervalMaxMs)
+	return time.Duration(intervalMs) * time.Millisecond
+}
+
 func getCPUInfo(ctx context.Context, perCPU bool, intervalMs int) (CPUInfo, error) {
-	interval := time.Second
-	if intervalMs > 0 {
-		if intervalMs < 100 {
-			intervalMs = 100
-		}
-		if intervalMs > 10000 {
-			intervalMs = 10000
-		}
-		interval = time.Duration(intervalMs) * time.Millisecond
+	interval := sampleWindow(intervalMs)
+
+	// Read the server's cgroup CPU time around the same window so usage
+	// can also be given against a container's allowance.
+	cgMount, cgRel, inCgroup := ownCgroup()
+	cgDir := filepath.Join(cgMount, filepath.FromSlash(cgRel))
+	var cgBefore time.Duration
+	var haveCgUsage bool
+	if inCgroup {
+		cgBefore, haveCgUsage = cgroupCPUUsage(cgDir)
 	}
+	start := time.Now()
 
 	var usage []float64
 	var err error
@@ -339,6 +832,7 @@ func getCPUInfo(ctx context.Context, perCPU bool, intervalMs int) (CPUInfo, erro
 	if err != nil {
 		return CPUInfo{}, fmt.Errorf("failed to get CPU usage: %w", err)
 	}
+	elapsed := time.Since(start)
 
 	info, err := cpu.InfoWithContext(ctx)
 	if err != nil {
@@ -366,7 +860,7 @@ func getCPUInfo(ctx context.Context, perCPU bool, intervalMs int) (CPUInfo, erro
 		flags = info[0].Flags
 	}
 
-	return CPUInfo{
+	out := CPUInfo{
 		Usage:         usage,
 		Count:         logicalCount,
 		PhysicalCount: physicalCount,
@@ -375,7 +869,15 @@ func getCPUInfo(ctx context.Context, perCPU bool, intervalMs int) (CPUInfo, erro
 		Speed:         speed,
 		CacheSize:     cacheSize,
 		Flags:         flags,
-	}, nil
+	}
+	if inCgroup {
+		out.Container = readCPULimit(cgMount, cgRel, logicalCount)
+		if after, ok := cgroupCPUUsage(cgDir); ok && haveCgUsage && out.Container != nil && elapsed > 0 {
+			used := (after - cgBefore).Seconds()
+			out.Container.UsagePercent = used / (elapsed.Seconds() * out.Container.EffectiveCores) * 100
+		}
+	}
+	return out, nil
 }
 
 func getMemoryInfo(ctx context.Context) (MemoryInfo, error) {
@@ -387,7 +889,7 @@ func getMemoryInfo(ctx context.Context) (MemoryInfo, error) {
 	if err != nil {
 		return MemoryInfo{}, fmt.Errorf("failed to get swap memory: %w", err)
 	}
-	return MemoryInfo{
+	out := MemoryInfo{
 		Total:       vm.Total,
 		Available:   vm.Available,
 		Used:        vm.Used,
@@ -398,7 +900,11 @@ func getMemoryInfo(ctx context.Context) (MemoryInfo, error) {
 		SwapTotal:   sw.Total,
 		SwapUsed:    sw.Used,
 		SwapFree:    sw.Free,
-	}, nil
+	}
+	if mount, rel, ok := ownCgroup(); ok {
+		out.Container = readMemoryLimit(mount, rel, vm.Total)
+	}
+	return out, nil
 }
 
 func getDiskInfo(ctx context.Context, path string) (DiskInfoResult, error) {
@@ -441,16 +947,63 @@ func getDiskInfo(ctx context.Context, path string) (DiskInfoResult, error) {
 				InodesTotal: u.InodesTotal,
 				InodesUsed:  u.InodesUsed,
 				InodesFree:  u.InodesFree,
+				ReadOnly:    slices.Contains(p.Opts, "ro"),
 			})
 		}
 	}
 	return DiskInfoResult{Disks: disks}, nil
 }
 
-func getNetworkInfo(ctx context.Context, iface string) (NetworkInfoResult, error) {
+func getNetworkInfo(ctx context.Context, iface string, intervalMs int) (NetworkInfoResult, error) {
+	if intervalMs > 0 {
+		before, err := readNetworkCounters(ctx, iface)
+		if err != nil {
+			return NetworkInfoResult{}, err
+		}
+		start := time.Now()
+		select {
+		case <-ctx.Done():
+			return NetworkInfoResult{}, ctx.Err()
+		case <-time.After(sampleWindow(intervalMs)):
+		}
+		out, err := readNetworkCounters(ctx, iface)
+		if err != nil {
+			return NetworkInfoResult{}, err
+		}
+		window := time.Since(start).Seconds()
+		prev := make(map[string]NetworkInfo, len(before))
+		for _, b := range before {
+			prev[b.Interface] = b
+		}
+		for i := range out {
+			if b, ok := prev[out[i].Interface]; ok {
+				out[i].Rates = networkRates(b, out[i], window, "window")
+			}
+		}
+		return NetworkInfoResult{Interfaces: out}, nil
+	}
+
+	out, err := readNetworkCounters(ctx, iface)
+	if err != nil {
+		return NetworkInfoResult{}, err
+	}
+	if sampler != nil {
+		// Compare against a sample at least a second old so a sample taken
+		// just before this call does not yield a noisy near-zero window.
+		now := time.Now()
+		for i := range out {
+			if prev, t, ok := sampledNetworkCounters(sampler, out[i].Interface, now.Add(-time.Second)); ok {
+				out[i].Rates = networkRates(prev, out[i], now.Sub(t).Seconds(), "sampler")
+			}
+		}
+	}
+	return NetworkInfoResult{Interfaces: out}, nil
+}
+
+func readNetworkCounters(ctx context.Context, iface string) ([]NetworkInfo, error) {
 	stats, err := net.IOCountersWithContext(ctx, true)
 	if err != nil {
-		return NetworkInfoResult{}, fmt.Errorf("failed to get network stats: %w", err)
+		return nil, fmt.Errorf("failed to get network stats: %w", err)
 	}
 	var out []NetworkInfo
 	for _, s := range stats {
@@ -469,16 +1022,72 @@ func getNetworkInfo(ctx context.Context, iface string) (NetworkInfoResult, error
 			Dropout:     s.Dropout,
 		})
 	}
-	return NetworkInfoResult{Interfaces: out}, nil
+	return out, nil
+}
+
+// sampledNetworkCounters rebuilds an interface's counters from the newest
+// background sample taken at or before t.
+func sampledNetworkCounters(s *Sampler, iface string, t time.Time) (NetworkInfo, time.Time, bool) {
+	prefix := "net." + iface + "."
+	get := func(field string) (MetricPoint, bool) { return s.LatestBefore(prefix+field, t) }
+	sent, ok := get("bytes_sent")
+	if !ok {
+		return NetworkInfo{}, time.Time{}, false
+	}
+	var counters [7]uint64
+	for i, field := range []string{"bytes_recv", "packets_sent", "packets_recv", "errors_in", "errors_out", "drops_in", "drops_out"} {
+		p, ok := get(field)
+		if !ok || !p.Time.Equal(sent.Time) {
+			return NetworkInfo{}, time.Time{}, false
+		}
+		counters[i] = uint64(p.Value)
+	}
+	return NetworkInfo{
+		Interface:   iface,
+		BytesSent:   uint64(sent.Value),
+		BytesRecv:   counters[0],
+		PacketsSent: counters[1],
+		PacketsRecv: counters[2],
+		Errin:       counters[3],
+		Errout:      counters[4],
+		Dropin:      counters[5],
+		Dropout:     counters[6],
+	}, sent.Time, true
 }
 
-func getProcessInfo(ctx context.Context, pid int32, name string, limit int, sortBy string) (ProcessInfoResult, error) {
+func networkRates(prev, cur NetworkInfo, window float64, source string) *NetworkRates {
+	if window <= 0 {
+		return nil
+	}
+	// Counters reset when an interface is recreated; report 0 rather than a huge rate.
+	rate := func(a, b uint64) float64 {
+		if b < a {
+			return 0
+		}
+		return float64(b-a) / window
+	}
+	return &NetworkRates{
+		WindowSeconds:     window,
+		Source:            source,
+		BytesSentPerSec:   rate(prev.BytesSent, cur.BytesSent),
+		BytesRecvPerSec:   rate(prev.BytesRecv, cur.BytesRecv),
+		PacketsSentPerSec: rate(prev.PacketsSent, cur.PacketsSent),
+		PacketsRecvPerSec: rate(prev.PacketsRecv, cur.PacketsRecv),
+		ErrinPerSec:       rate(prev.Errin, cur.Errin),
+		ErroutPerSec:      rate(prev.Errout, cur.Errout),
+		DropinPerSec:      rate(prev.Dropin, cur.Dropin),
+		DropoutPerSec:     rate(prev.Dropout, cur.Dropout),
+	}
+}
+
+func getProcessInfo(ctx context.Context, pid int32, name string, limit int, sortBy string, intervalMs int, memoryDetail bool) (ProcessInfoResult, error) {
 	if limit <= 0 {
-		limit = 10
+		limit = limits.ProcessLimitDefault
 	}
-	if limit > 200 {
-		limit = 200
+	if limit > limits.ProcessLimitMax {
+		limit = limits.ProcessLimitMax
 	}
+	window := sampleWindow(intervalMs)
 
 	var list []ProcessInfo
 	if pid > 0 {
@@ -486,42 +1095,216 @@ func getProcessInfo(ctx context.Context, pid int32, name string, limit int, sort
 		if err != nil {
 			return ProcessInfoResult{}, fmt.Errorf("failed to get process %d: %w", pid, err)
 		}
+		cpuPercent, err := sampleProcessCPU(ctx, []*process.Process{proc}, window)
+		if err != nil {
+			return ProcessInfoResult{}, err
+		}
 		info, err := getProcessDetails(ctx, proc)
 		if err != nil {
 			return ProcessInfoResult{}, fmt.Errorf("failed to get process details: %w", err)
 		}
+		info.CPUPercent = cpuPercent[pid]
+		if memoryDetail {
+			info.MemoryDetail, err = getMemoryBreakdown(pid, true)
+			if err != nil {
+				return ProcessInfoResult{}, fmt.Errorf("failed to get memory detail of process %d: %w", pid, err)
+			}
+		}
 		list = []ProcessInfo{info}
 	} else {
 		procs, err := process.ProcessesWithContext(ctx)
 		if err != nil {
 			return ProcessInfoResult{}, fmt.Errorf("failed to list processes: %w", err)
 		}
-		for _, p := range procs {
-			info, err := getProcessDetails(ctx, p)
+		switch sortBy = strings.ToLower(sortBy); sortBy {
+		case "memory", "pid", "name":
+		default:
+			sortBy = "cpu"
+		}
+		keys, err := scanProcessKeys(ctx, procs, name, sortBy, window)
+		if err != nil {
+			return ProcessInfoResult{}, err
+		}
+		top := selectTopProcesses(keys, sortBy, limit)
+
+		// Unless the ranking was by CPU, usage has not been measured yet;
+		// do it now for the selected processes only.
+		if sortBy != "cpu" {
+			selected := make([]*process.Process, len(top))
+			for i, k := range top {
+				selected[i] = k.proc
+			}
+			cpuPercent, err := sampleProcessCPU(ctx, selected, window)
 			if err != nil {
-				continue
+				return ProcessInfoResult{}, err
 			}
-			if name != "" && !strings.Contains(strings.ToLower(info.Name), strings.ToLower(name)) {
+			for i := range top {
+				top[i].cpu = cpuPercent[top[i].proc.Pid]
+			}
+		}
+
+		for _, k := range top {
+			info, err := getProcessDetails(ctx, k.proc)
+			if err != nil {
 				continue
 			}
-			list = append(list, info)
-			if len(list) >= limit*2 { // gather extra for better sorting
-				break
+			info.CPUPercent = k.cpu
+			if memoryDetail {
+				// Other users' processes are unreadable without privileges; leave them out.
+				info.MemoryDetail, _ = getMemoryBreakdown(k.proc.Pid, false)
 			}
+			list = append(list, info)
 		}
+		// Re-sort on the detailed values so the order matches what is reported.
 		sortProcessesBy(list, sortBy)
-		if len(list) > limit {
-			list = list[:limit]
+	}
+
+	redactedCount := 0
+	for _, p := range list {
+		if p.Redacted {
+			redactedCount++
+		}
+	}
+	return ProcessInfoResult{
+		Processes:   list,
+		Count:       len(list),
+		CPUWindowMs: window.Milliseconds(),
+		Redacted:    redactedCount,
+	}, nil
+}
+
+// sampleProcessCPU measures the CPU usage of procs over window the way top
+// does: CPU time is read for every process, again after window, and the
+// difference divided by the elapsed wall time. 100% means one full core.
+// Processes that exit before the second reading are absent from the result.
+func sampleProcessCPU(ctx context.Context, procs []*process.Process, window time.Duration) (map[int32]float64, error) {
+	before := make(map[int32]float64, len(procs))
+	for _, p := range procs {
+		if t, err := p.TimesWithContext(ctx); err == nil {
+			before[p.Pid] = t.User + t.System
+		}
+	}
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(window):
+	}
+
+	out := make(map[int32]float64, len(before))
+	elapsed := time.Since(start).Seconds()
+	for _, p := range procs {
+		prev, ok := before[p.Pid]
+		if !ok {
+			continue
+		}
+		t, err := p.TimesWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		used := t.User + t.System - prev
+		if used < 0 {
+			used = 0
+		}
+		out[p.Pid] = used / elapsed * 100
+	}
+	return out, nil
+}
+
+// processKey holds the little that is needed to rank a process; full
+// details are only fetched for the processes that make the cut.
+type processKey struct {
+	proc *process.Process
+	name string
+	rss  uint64
+	cpu  float64
+}
+
+// scanProcessKeys reads the sort key of every process in procs, plus its
+// name when filtering by name. CPU usage is sampled over window only when
+// sorting by it. Processes that exit or cannot be read are dropped.
+func scanProcessKeys(ctx context.Context, procs []*process.Process, nameFilter, sortBy string, window time.Duration) ([]processKey, error) {
+	nameFilter = strings.ToLower(nameFilter)
+	keys := make([]processKey, 0, len(procs))
+	for _, p := range procs {
+		k := processKey{proc: p}
+		if nameFilter != "" || sortBy == "name" {
+			name, err := p.NameWithContext(ctx)
+			if err != nil {
+				continue
+			}
+			if nameFilter != "" && !strings.Contains(strings.ToLower(name), nameFilter) {
+				continue
+			}
+			k.name = name
 		}
+		if sortBy == "memory" {
+			mem, err := p.MemoryInfoWithContext(ctx)
+			if err != nil {
+				continue
+			}
+			k.rss = mem.RSS
+		}
+		keys = append(keys, k)
 	}
 
-	return ProcessInfoResult{Processes: list, Count: len(list)}, nil
+	if sortBy != "cpu" {
+		return keys, nil
+	}
+	sampled := make([]*process.Process, len(keys))
+	for i, k := range keys {
+		sampled[i] = k.proc
+	}
+	cpuPercent, err := sampleProcessCPU(ctx, sampled, window)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, k := range keys {
+		pct, ok := cpuPercent[k.proc.Pid]
+		if !ok {
+			continue // exited during the sampling window
+		}
+		k.cpu = pct
+		keys[n] = k
+		n++
+	}
+	return keys[:n], nil
+}
+
+// selectTopProcesses orders keys by sortBy and returns the first limit.
+// Memory ranks by RSS, which orders the same as memory_percent.
+func selectTopProcesses(keys []processKey, sortBy string, limit int) []processKey {
+	var less func(a, b processKey) bool
+	switch strings.ToLower(sortBy) {
+	case "memory":
+		less = func(a, b processKey) bool { return a.rss > b.rss }
+	case "pid":
+		less = func(a, b processKey) bool { return a.proc.Pid < b.proc.Pid }
+	case "name":
+		less = func(a, b processKey) bool { return a.name < b.name }
+	default: // "cpu"
+		less = func(a, b processKey) bool { return a.cpu > b.cpu }
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if less(keys[i], keys[j]) {
+			return true
+		}
+		if less(keys[j], keys[i]) {
+			return false
+		}
+		return keys[i].proc.Pid < keys[j].proc.Pid // keep ties deterministic
+	})
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
 }
 
 func getProcessDetails(ctx context.Context, proc *process.Process) (ProcessInfo, error) {
 	name, _ := proc.NameWithContext(ctx)
+	ppid, _ := proc.PpidWithContext(ctx)
 	statusSlice, _ := proc.StatusWithContext(ctx)
-	cpuPercent, _ := proc.CPUPercentWithContext(ctx)
 	memInfo, _ := proc.MemoryInfoWithContext(ctx)
 	memPercent, _ := proc.MemoryPercentWithContext(ctx)
 	createTime, _ := proc.CreateTimeWithContext(ctx)
@@ -545,11 +1328,11 @@ func getProcessDetails(ctx context.Context, proc *process.Process) (ProcessInfo,
 		cmdlineSlice = strings.Fields(cmdlineStr)
 	}
 
-	return ProcessInfo{
+	info := ProcessInfo{
 		PID:           proc.Pid,
+		PPID:          ppid,
 		Name:          name,
 		Status:        statusStr,
-		CPUPercent:    cpuPercent,
 		MemoryRSS:     memoryRSS,
 		MemoryVMS:     memoryVMS,
 		MemoryPercent: memPercent,
@@ -557,7 +1340,9 @@ func getProcessDetails(ctx context.Context, proc *process.Process) (ProcessInfo,
 		NumThreads:    numThreads,
 		Username:      username,
 		Cmdline:       cmdlineSlice,
-	}, nil
+	}
+	redactor.Process(&info)
+	return info, nil
 }
 
 func sortProcessesBy(processes []ProcessInfo, sortBy string) {
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/shirou/gopsutil/v3/process"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -32,6 +35,14 @@ func TestTextErr(t *testing.T) {
 	assert.Equal(t, "Error: "+err.Error(), textContent.Text)
 }
 
+func TestSampleWindow(t *testing.T) {
+	assert.Equal(t, time.Duration(limits.CPUIntervalDefaultMs)*time.Millisecond, sampleWindow(0))
+	assert.Equal(t, time.Duration(limits.CPUIntervalDefaultMs)*time.Millisecond, sampleWindow(-5))
+	assert.Equal(t, time.Duration(limits.CPUIntervalMinMs)*time.Millisecond, sampleWindow(1))
+	assert.Equal(t, time.Duration(limits.CPUIntervalMaxMs)*time.Millisecond, sampleWindow(limits.CPUIntervalMaxMs+1))
+	assert.Equal(t, 500*time.Millisecond, sampleWindow(500))
+}
+
 func TestSortProcessesBy(t *testing.T) {
 	processes := []ProcessInfo{
 		{PID: 100, Name: "process_c", CPUPercent: 15.5, MemoryPercent: 10.0},
@@ -189,7 +200,7 @@ func TestGetNetworkInfo(t *testing.T) {
 	ctx := context.Background()
 	
 	t.Run("all interfaces", func(t *testing.T) {
-		result, err := getNetworkInfo(ctx, "")
+		result, err := getNetworkInfo(ctx, "", 0)
 		require.NoError(t, err)
 		
 		assert.Greater(t, len(result.Interfaces), 0)
@@ -200,12 +211,12 @@ func TestGetNetworkInfo(t *testing.T) {
 
 	t.Run("specific interface", func(t *testing.T) {
 		// First get all interfaces to find a valid one
-		allResult, err := getNetworkInfo(ctx, "")
+		allResult, err := getNetworkInfo(ctx, "", 0)
 		require.NoError(t, err)
 		
 		if len(allResult.Interfaces) > 0 {
 			targetInterface := allResult.Interfaces[0].Interface
-			result, err := getNetworkInfo(ctx, targetInterface)
+			result, err := getNetworkInfo(ctx, targetInterface, 0)
 			require.NoError(t, err)
 			
 			assert.Len(t, result.Interfaces, 1)
@@ -214,11 +225,80 @@ func TestGetNetworkInfo(t *testing.T) {
 	})
 }
 
+func TestGetNetworkRates(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("caller window", func(t *testing.T) {
+		result, err := getNetworkInfo(ctx, "", 100)
+		require.NoError(t, err)
+		require.Greater(t, len(result.Interfaces), 0)
+		for _, iface := range result.Interfaces {
+			require.NotNil(t, iface.Rates, iface.Interface)
+			assert.Equal(t, "window", iface.Rates.Source)
+			assert.GreaterOrEqual(t, iface.Rates.WindowSeconds, 0.1)
+			assert.GreaterOrEqual(t, iface.Rates.BytesRecvPerSec, float64(0))
+		}
+	})
+
+	t.Run("no window and no sampler", func(t *testing.T) {
+		saved := sampler
+		sampler = nil
+		defer func() { sampler = saved }()
+
+		result, err := getNetworkInfo(ctx, "", 0)
+		require.NoError(t, err)
+		for _, iface := range result.Interfaces {
+			assert.Nil(t, iface.Rates)
+		}
+	})
+
+	t.Run("from sampler", func(t *testing.T) {
+		saved := sampler
+		defer func() { sampler = saved }()
+		sampler = NewSampler(SamplerConfig{Enabled: true, IntervalMs: 1000, HistorySize: 10})
+
+		current, err := readNetworkCounters(ctx, "")
+		require.NoError(t, err)
+		require.Greater(t, len(current), 0)
+		iface := current[0]
+		// Pretend the previous sample saw 2000 fewer bytes received 2s ago.
+		sampler.record(time.Now().Add(-2*time.Second), map[string]float64{
+			"net." + iface.Interface + ".bytes_sent":   float64(iface.BytesSent),
+			"net." + iface.Interface + ".bytes_recv":   float64(iface.BytesRecv) - 2000,
+			"net." + iface.Interface + ".packets_sent": float64(iface.PacketsSent),
+			"net." + iface.Interface + ".packets_recv": float64(iface.PacketsRecv),
+			"net." + iface.Interface + ".errors_in":    float64(iface.Errin),
+			"net." + iface.Interface + ".errors_out":   float64(iface.Errout),
+			"net." + iface.Interface + ".drops_in":     float64(iface.Dropin),
+			"net." + iface.Interface + ".drops_out":    float64(iface.Dropout),
+		})
+
+		result, err := getNetworkInfo(ctx, iface.Interface, 0)
+		require.NoError(t, err)
+		require.Len(t, result.Interfaces, 1)
+		rates := result.Interfaces[0].Rates
+		require.NotNil(t, rates)
+		assert.Equal(t, "sampler", rates.Source)
+		assert.InDelta(t, 2.0, rates.WindowSeconds, 0.5)
+		assert.GreaterOrEqual(t, rates.BytesRecvPerSec, float64(800))
+	})
+}
+
+func TestNetworkRatesCounterReset(t *testing.T) {
+	prev := NetworkInfo{BytesSent: 5000, BytesRecv: 100}
+	cur := NetworkInfo{BytesSent: 100, BytesRecv: 300}
+	rates := networkRates(prev, cur, 2, "window")
+	require.NotNil(t, rates)
+	assert.Equal(t, float64(0), rates.BytesSentPerSec)
+	assert.Equal(t, float64(100), rates.BytesRecvPerSec)
+	assert.Nil(t, networkRates(prev, cur, 0, "window"))
+}
+
 func TestGetProcessInfo(t *testing.T) {
 	ctx := context.Background()
 	
 	t.Run("default parameters", func(t *testing.T) {
-		result, err := getProcessInfo(ctx, 0, "", 0, "")
+		result, err := getProcessInfo(ctx, 0, "", 0, "", 100, false)
 		require.NoError(t, err)
 		
 		assert.Greater(t, len(result.Processes), 0)
@@ -232,7 +312,7 @@ func TestGetProcessInfo(t *testing.T) {
 	})
 
 	t.Run("with limit", func(t *testing.T) {
-		result, err := getProcessInfo(ctx, 0, "", 5, "")
+		result, err := getProcessInfo(ctx, 0, "", 5, "", 100, false)
 		require.NoError(t, err)
 		
 		assert.LessOrEqual(t, len(result.Processes), 5)
@@ -240,7 +320,7 @@ func TestGetProcessInfo(t *testing.T) {
 
 	t.Run("with name filter", func(t *testing.T) {
 		// Try to find a common process name
-		allResult, err := getProcessInfo(ctx, 0, "", 50, "")
+		allResult, err := getProcessInfo(ctx, 0, "", 50, "", 100, false)
 		require.NoError(t, err)
 		
 		if len(allResult.Processes) > 0 {
@@ -248,7 +328,7 @@ func TestGetProcessInfo(t *testing.T) {
 			processName := allResult.Processes[0].Name
 			if len(processName) > 3 {
 				filterName := processName[:3] // Use first 3 characters
-				result, err := getProcessInfo(ctx, 0, filterName, 10, "")
+				result, err := getProcessInfo(ctx, 0, filterName, 10, "", 100, false)
 				require.NoError(t, err)
 				
 				// All returned processes should contain the filter string
@@ -260,7 +340,7 @@ func TestGetProcessInfo(t *testing.T) {
 	})
 
 	t.Run("sort by memory", func(t *testing.T) {
-		result, err := getProcessInfo(ctx, 0, "", 5, "memory")
+		result, err := getProcessInfo(ctx, 0, "", 5, "memory", 100, false)
 		require.NoError(t, err)
 		
 		if len(result.Processes) > 1 {
@@ -270,7 +350,7 @@ func TestGetProcessInfo(t *testing.T) {
 
 	t.Run("specific PID", func(t *testing.T) {
 		// Use PID 1 which should always exist on Linux systems
-		result, err := getProcessInfo(ctx, 1, "", 0, "")
+		result, err := getProcessInfo(ctx, 1, "", 0, "", 100, false)
 		require.NoError(t, err)
 		
 		assert.Len(t, result.Processes, 1)
@@ -279,16 +359,61 @@ func TestGetProcessInfo(t *testing.T) {
 
 	t.Run("limit bounds", func(t *testing.T) {
 		// Test limit clamping
-		result, err := getProcessInfo(ctx, 0, "", 300, "") // Too high, should be clamped to 200
+		result, err := getProcessInfo(ctx, 0, "", 300, "", 100, false) // Too high, should be clamped to 200
 		require.NoError(t, err)
 		assert.LessOrEqual(t, len(result.Processes), 200)
 		
-		result, err = getProcessInfo(ctx, 0, "", -5, "") // Negative, should use default of 10
+		result, err = getProcessInfo(ctx, 0, "", -5, "", 100, false) // Negative, should use default of 10
 		require.NoError(t, err)
 		assert.LessOrEqual(t, len(result.Processes), 10)
 	})
 }
 
+func TestSelectTopProcesses(t *testing.T) {
+	// The heaviest processes come last, as they would when enumerated
+	// after thousands of idle ones.
+	var keys []processKey
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, processKey{proc: &process.Process{Pid: int32(i + 1)}, rss: 1, cpu: 0})
+	}
+	keys = append(keys,
+		processKey{proc: &process.Process{Pid: 5000}, name: "b", rss: 300, cpu: 5},
+		processKey{proc: &process.Process{Pid: 5001}, name: "a", rss: 100, cpu: 50},
+	)
+	pids := func(ks []processKey) []int32 {
+		var out []int32
+		for _, k := range ks {
+			out = append(out, k.proc.Pid)
+		}
+		return out
+	}
+
+	assert.Equal(t, []int32{5000, 5001}, pids(selectTopProcesses(append([]processKey(nil), keys...), "memory", 2)))
+	assert.Equal(t, []int32{5001, 5000}, pids(selectTopProcesses(append([]processKey(nil), keys...), "cpu", 2)))
+	assert.Equal(t, []int32{5001, 5000}, pids(selectTopProcesses(append([]processKey(nil), keys...), "", 2)))
+	assert.Equal(t, []int32{1, 2}, pids(selectTopProcesses(append([]processKey(nil), keys...), "pid", 2)))
+	assert.Len(t, selectTopProcesses(append([]processKey(nil), keys...), "name", 2000), 1002)
+}
+
+func TestGetProcessInfoRanksAllProcesses(t *testing.T) {
+	ctx := context.Background()
+	procs, err := process.ProcessesWithContext(ctx)
+	require.NoError(t, err)
+
+	var maxRSS uint64
+	for _, p := range procs {
+		if m, err := p.MemoryInfoWithContext(ctx); err == nil && m.RSS > maxRSS {
+			maxRSS = m.RSS
+		}
+	}
+
+	result, err := getProcessInfo(ctx, 0, "", 1, "memory", 100, false)
+	require.NoError(t, err)
+	require.Len(t, result.Processes, 1)
+	// Allow for memory changing between the two scans.
+	assert.GreaterOrEqual(t, float64(result.Processes[0].MemoryRSS), float64(maxRSS)*0.9)
+}
+
 func TestGetLoadAverage(t *testing.T) {
 	ctx := context.Background()
 	
@@ -309,7 +434,7 @@ func TestServerRegistration(t *testing.T) {
 
 	// This should not panic
 	require.NotPanics(t, func() {
-		registerTools(server)
+		require.NoError(t, registerTools(server, nil))
 	})
 }
 
@@ -379,3 +504,35 @@ func TestDataStructures(t *testing.T) {
 		assert.Len(t, info.Cmdline, 2)
 	})
 }
+
+func TestSampleProcessCPU(t *testing.T) {
+	ctx := context.Background()
+
+	// Burn CPU in this process so the sampled value must be clearly non-zero.
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	defer close(stop)
+
+	result, err := getProcessInfo(ctx, int32(os.Getpid()), "", 0, "", 300, false)
+	require.NoError(t, err)
+	require.Len(t, result.Processes, 1)
+	assert.Equal(t, int64(300), result.CPUWindowMs)
+	assert.Greater(t, result.Processes[0].CPUPercent, float64(20))
+
+	procs, err := process.ProcessesWithContext(ctx)
+	require.NoError(t, err)
+	usage, err := sampleProcessCPU(ctx, procs, 100*time.Millisecond)
+	require.NoError(t, err)
+	assert.Greater(t, len(usage), 0)
+	for pid, pct := range usage {
+		assert.GreaterOrEqual(t, pct, float64(0), "pid %d", pid)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- Per-process memory breakdown from smaps ---
+
+// MemoryBreakdown splits a process's resident memory by how it is shared.
+// PSS charges each shared page to its users in proportion, so summing PSS
+// over processes gives real usage; USS is what freeing the process would
+// return. All values are bytes.
+type MemoryBreakdown struct {
+	RSS          uint64          `json:"rss_bytes"`
+	PSS          uint64          `json:"pss_bytes"`
+	USS          uint64          `json:"uss_bytes"` // private_clean + private_dirty
+	SharedClean  uint64          `json:"shared_clean_bytes"`
+	SharedDirty  uint64          `json:"shared_dirty_bytes"`
+	PrivateClean uint64          `json:"private_clean_bytes"`
+	PrivateDirty uint64          `json:"private_dirty_bytes"`
+	Anonymous    uint64          `json:"anonymous_bytes"`
+	Swap         uint64          `json:"swap_bytes"`
+	SwapPSS      uint64          `json:"swap_pss_bytes"`
+	TopMappings  []MemoryMapping `json:"top_mappings,omitempty"` // largest mappings by PSS, only for a single PID
+}
+
+// MemoryMapping totals every mapping of one file or anonymous region.
+type MemoryMapping struct {
+	Path    string `json:"path"` // file, or [heap], [stack], [anon] and the like
+	Count   int    `json:"count"`
+	Size    uint64 `json:"size_bytes"` // virtual size
+	RSS     uint64 `json:"rss_bytes"`
+	PSS     uint64 `json:"pss_bytes"`
+	Private uint64 `json:"private_bytes"`
+	Swap    uint64 `json:"swap_bytes"`
+}
+
+// topMappingsLimit is how many mappings getMemoryBreakdown lists.
+const topMappingsLimit = 10
+
+// getMemoryBreakdown reads /proc/<pid>/smaps_rollup, falling back to
+// summing smaps on kernels without it (before 4.14). With mappings set it
+// also reads smaps for the largest mappings, which costs noticeably more.
+func getMemoryBreakdown(pid int32, mappings bool) (*MemoryBreakdown, error) {
+	dir := fmt.Sprintf("/proc/%d", pid)
+	var m *MemoryBreakdown
+	f, err := os.Open(dir + "/smaps_rollup")
+	if err == nil {
+		m, err = parseSmapsRollup(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse smaps_rollup: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read memory maps: %w", err)
+	}
+	if m != nil && !mappings {
+		return m, nil
+	}
+
+	f, err = os.Open(dir + "/smaps")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory maps: %w", err)
+	}
+	defer f.Close()
+	total, maps, err := parseSmaps(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse smaps: %w", err)
+	}
+	if m == nil {
+		m = total
+	}
+	if mappings {
+		m.TopMappings = maps
+		if len(m.TopMappings) > topMappingsLimit {
+			m.TopMappings = m.TopMappings[:topMappingsLimit]
+		}
+	}
+	return m, nil
+}
+
+// parseSmapsRollup parses the single summary block of smaps_rollup.
+func parseSmapsRollup(r io.Reader) (*MemoryBreakdown, error) {
+	m := &MemoryBreakdown{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if key, v, ok := smapsField(sc.Text()); ok {
+			m.add(key, v)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	m.USS = m.PrivateClean + m.PrivateDirty
+	return m, nil
+}
+
+// parseSmaps parses every mapping in smaps and returns their total along
+// with the mappings grouped by path, largest PSS first.
+func parseSmaps(r io.Reader) (*MemoryBreakdown, []MemoryMapping, error) {
+	total := &MemoryBreakdown{}
+	byPath := make(map[string]*MemoryMapping)
+	var cur *MemoryMapping
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		key, v, ok := smapsField(line)
+		if !ok {
+			if path, isHeader := smapsHeader(line); isHeader {
+				cur = byPath[path]
+				if cur == nil {
+					cur = &MemoryMapping{Path: path}
+					byPath[path] = cur
+				}
+				cur.Count++
+			}
+			continue
+		}
+		total.add(key, v)
+		if cur == nil {
+			continue
+		}
+		switch key {
+		case "Size":
+			cur.Size += v
+		case "Rss":
+			cur.RSS += v
+		case "Pss":
+			cur.PSS += v
+		case "Private_Clean", "Private_Dirty":
+			cur.Private += v
+		case "Swap":
+			cur.Swap += v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	total.USS = total.PrivateClean + total.PrivateDirty
+
+	maps := make([]MemoryMapping, 0, len(byPath))
+	for _, mm := range byPath {
+		maps = append(maps, *mm)
+	}
+	sort.Slice(maps, func(i, j int) bool {
+		if maps[i].PSS != maps[j].PSS {
+			return maps[i].PSS > maps[j].PSS
+		}
+		return maps[i].Path < maps[j].Path
+	})
+	return total, maps, nil
+}
+
+func (m *MemoryBreakdown) add(key string, v uint64) {
+	switch key {
+	case "Rss":
+		m.RSS += v
+	case "Pss":
+		m.PSS += v
+	case "Shared_Clean":
+		m.SharedClean += v
+	case "Shared_Dirty":
+		m.SharedDirty += v
+	case "Private_Clean":
+		m.PrivateClean += v
+	case "Private_Dirty":
+		m.PrivateDirty += v
+	case "Anonymous":
+		m.Anonymous += v
+	case "Swap":
+		m.Swap += v
+	case "SwapPss":
+		m.SwapPSS += v
+	}
+}
+
+// smapsField parses a "Key:   1234 kB" line into the key and a byte count.
+func smapsField(line string) (string, uint64, bool) {
+	key, rest, ok := strings.Cut(line, ":")
+	if !ok || strings.ContainsAny(key, " -") {
+		return "", 0, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) != 2 || fields[1] != "kB" {
+		return "", 0, false
+	}
+	v, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return key, v * 1024, true
+}
+
+// smapsHeader recognises a mapping line such as
+// "7f2c...-7f2c... r-xp 00000000 fe:00 1234   /usr/lib/libc.so.6" and
+// returns its path, or [anon] for unnamed anonymous memory.
+func smapsHeader(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || !strings.Contains(fields[0], "-") {
+		return "", false
+	}
+	if len(fields) == 5 {
+		return "[anon]", true
+	}
+	return strings.Join(fields[5:], " "), true
+}
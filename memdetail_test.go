@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSmapsRollup = `55fedc07b000-7ffd9b8f8000 ---p 00000000 00:00 0                          [rollup]
+Rss:                1352 kB
+Pss:                 326 kB
+Pss_Anon:            104 kB
+Shared_Clean:       1208 kB
+Shared_Dirty:          0 kB
+Private_Clean:        40 kB
+Private_Dirty:       104 kB
+Anonymous:           104 kB
+Swap:                 12 kB
+SwapPss:               6 kB
+`
+
+const testSmaps = `557565543000-557565545000 r--p 00000000 fe:00 301775                     /usr/bin/app
+Size:                  8 kB
+Rss:                   8 kB
+Pss:                   8 kB
+Shared_Clean:          0 kB
+Private_Clean:         8 kB
+Private_Dirty:         0 kB
+Swap:                  0 kB
+VmFlags: rd mr mw me dw sd
+557565545000-557565549000 r-xp 00002000 fe:00 301775                     /usr/bin/app
+Size:                 16 kB
+Rss:                  16 kB
+Pss:                  16 kB
+Private_Clean:        16 kB
+THPeligible:           0
+7f0000000000-7f0000100000 r-xp 00000000 fe:00 1234                       /usr/lib/libc.so.6
+Size:               1024 kB
+Rss:                 800 kB
+Pss:                 100 kB
+Shared_Clean:        800 kB
+7f0000200000-7f0000300000 rw-p 00000000 00:00 0
+Size:               1024 kB
+Rss:                 512 kB
+Pss:                 512 kB
+Private_Dirty:       512 kB
+Anonymous:           512 kB
+Swap:                 64 kB
+5575000000-5575100000 rw-p 00000000 00:00 0                              [heap]
+Size:               1024 kB
+Rss:                 256 kB
+Pss:                 256 kB
+Private_Dirty:       256 kB
+Anonymous:           256 kB
+`
+
+func TestParseSmapsRollup(t *testing.T) {
+	m, err := parseSmapsRollup(strings.NewReader(testSmapsRollup))
+	require.NoError(t, err)
+	assert.Equal(t, &MemoryBreakdown{
+		RSS:          1352 * 1024,
+		PSS:          326 * 1024,
+		USS:          144 * 1024,
+		SharedClean:  1208 * 1024,
+		PrivateClean: 40 * 1024,
+		PrivateDirty: 104 * 1024,
+		Anonymous:    104 * 1024,
+		Swap:         12 * 1024,
+		SwapPSS:      6 * 1024,
+	}, m)
+}
+
+func TestParseSmaps(t *testing.T) {
+	total, maps, err := parseSmaps(strings.NewReader(testSmaps))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(8+16+800+512+256)*1024, total.RSS)
+	assert.Equal(t, uint64(8+16+100+512+256)*1024, total.PSS)
+	assert.Equal(t, uint64(8+16+512+256)*1024, total.USS)
+	assert.Equal(t, uint64(64*1024), total.Swap)
+
+	require.Len(t, maps, 4)
+	assert.Equal(t, []string{"[anon]", "[heap]", "/usr/lib/libc.so.6", "/usr/bin/app"},
+		[]string{maps[0].Path, maps[1].Path, maps[2].Path, maps[3].Path})
+	assert.Equal(t, MemoryMapping{Path: "/usr/bin/app", Count: 2, Size: 24 * 1024, RSS: 24 * 1024, PSS: 24 * 1024, Private: 24 * 1024}, maps[3])
+	assert.Equal(t, uint64(64*1024), maps[0].Swap)
+}
+
+func TestGetMemoryBreakdown(t *testing.T) {
+	m, err := getMemoryBreakdown(int32(os.Getpid()), true)
+	require.NoError(t, err)
+	assert.Greater(t, m.RSS, uint64(0))
+	assert.Greater(t, m.PSS, uint64(0))
+	assert.LessOrEqual(t, m.USS, m.RSS)
+	assert.Equal(t, m.RSS, m.SharedClean+m.SharedDirty+m.PrivateClean+m.PrivateDirty)
+	assert.NotEmpty(t, m.TopMappings)
+	assert.LessOrEqual(t, len(m.TopMappings), topMappingsLimit)
+
+	_, err = getMemoryBreakdown(1<<30, false)
+	assert.Error(t, err)
+}
+
+func TestGetProcessInfoMemoryDetail(t *testing.T) {
+	ctx := context.Background()
+	result, err := getProcessInfo(ctx, int32(os.Getpid()), "", 0, "", 100, true)
+	require.NoError(t, err)
+	require.Len(t, result.Processes, 1)
+	require.NotNil(t, result.Processes[0].MemoryDetail)
+	assert.NotEmpty(t, result.Processes[0].MemoryDetail.TopMappings)
+
+	result, err = getProcessInfo(ctx, 0, "", 3, "memory", 100, true)
+	require.NoError(t, err)
+	for _, p := range result.Processes {
+		if p.MemoryDetail != nil {
+			assert.Empty(t, p.MemoryDetail.TopMappings, "mappings are only listed for a single PID")
+		}
+	}
+
+	result, err = getProcessInfo(ctx, int32(os.Getpid()), "", 0, "", 100, false)
+	require.NoError(t, err)
+	assert.Nil(t, result.Processes[0].MemoryDetail)
+}
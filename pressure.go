@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// --- System-wide pressure stall information (PSI) ---
+
+// pressureRoot holds the system-wide PSI files.
+var pressureRoot = "/proc/pressure"
+
+// pressureResources are the PSI files in the order they are reported. irq
+// only exists on kernels built with IRQ time accounting.
+var pressureResources = []string{"cpu", "memory", "io", "irq"}
+
+type PressureResult struct {
+	CPU    *ResourcePressure `json:"cpu,omitempty"`
+	Memory *ResourcePressure `json:"memory,omitempty"`
+	IO     *ResourcePressure `json:"io,omitempty"`
+	IRQ    *ResourcePressure `json:"irq,omitempty"`
+	Wait   *PressureWait     `json:"wait,omitempty"` // outcome of wait mode
+}
+
+// PressureWait reports a wait on a kernel PSI trigger.
+type PressureWait struct {
+	Resource    string  `json:"resource"`
+	Kind        string  `json:"kind"` // some|full
+	ThresholdMs int     `json:"threshold_ms"`
+	WindowMs    int     `json:"window_ms"`
+	Triggered   bool    `json:"triggered"` // false when the timeout elapsed first
+	WaitedMs    float64 `json:"waited_ms"`
+}
+
+type PressureArgs struct {
+	Resources []string `json:"resources,omitempty"` // cpu|memory|io|irq (default all available)
+
+	// Wait mode: block until resource stalls for threshold_ms within any
+	// window_ms, or until timeout_ms passes, then report.
+	Wait        bool   `json:"wait,omitempty"`
+	Resource    string `json:"resource,omitempty"`     // resource to watch (default memory)
+	Kind        string `json:"kind,omitempty"`         // some|full (default some)
+	ThresholdMs int    `json:"threshold_ms,omitempty"` // stall time that fires the trigger (default 100)
+	WindowMs    int    `json:"window_ms,omitempty"`    // tracking window, 500..10000 (default 2000; unprivileged callers need a multiple of 2000)
+	TimeoutMs   int    `json:"timeout_ms,omitempty"`   // give up after this long (default 10000, max 300000)
+}
+
+func getPressure(ctx context.Context, a PressureArgs) (PressureResult, error) {
+	if _, err := os.Stat(pressureRoot); err != nil {
+		return PressureResult{}, fmt.Errorf("pressure stall information not available (kernel needs CONFIG_PSI and must not be booted with psi=0): %w", err)
+	}
+	resources := a.Resources
+	if len(resources) == 0 {
+		resources = pressureResources
+	}
+	for _, r := range resources {
+		if !isPressureResource(r) {
+			return PressureResult{}, fmt.Errorf("unknown pressure resource %q (want cpu, memory, io or irq)", r)
+		}
+	}
+
+	var out PressureResult
+	if a.Wait {
+		w, err := waitPressure(ctx, a)
+		if err != nil {
+			return PressureResult{}, err
+		}
+		out.Wait = &w
+	}
+	for _, r := range resources {
+		p := readPressureFile(filepath.Join(pressureRoot, r))
+		switch r {
+		case "cpu":
+			out.CPU = p
+		case "memory":
+			out.Memory = p
+		case "io":
+			out.IO = p
+		case "irq":
+			out.IRQ = p
+		}
+	}
+	if out.CPU == nil && out.Memory == nil && out.IO == nil && out.IRQ == nil {
+		return PressureResult{}, fmt.Errorf("no pressure data for %s", strings.Join(resources, ", "))
+	}
+	return out, nil
+}
+
+func isPressureResource(r string) bool {
+	for _, known := range pressureResources {
+		if r == known {
+			return true
+		}
+	}
+	return false
+}
+
+// waitPressure registers a PSI trigger (see Documentation/accounting/psi.rst)
+// and polls it until it fires, the timeout elapses or ctx is done. The
+// trigger is removed when the file is closed.
+func waitPressure(ctx context.Context, a PressureArgs) (PressureWait, error) {
+	w := PressureWait{Resource: a.Resource, Kind: a.Kind, ThresholdMs: a.ThresholdMs, WindowMs: a.WindowMs}
+	if w.Resource == "" {
+		w.Resource = "memory"
+	}
+	if w.Kind == "" {
+		w.Kind = "some"
+	}
+	if w.ThresholdMs <= 0 {
+		w.ThresholdMs = 100
+	}
+	if w.WindowMs <= 0 {
+		w.WindowMs = 2000
+	}
+	timeoutMs := a.TimeoutMs
+	if timeoutMs <= 0 {
+		timeoutMs = 10000
+	}
+	if timeoutMs > 300000 {
+		timeoutMs = 300000
+	}
+
+	if !isPressureResource(w.Resource) {
+		return PressureWait{}, fmt.Errorf("unknown pressure resource %q (want cpu, memory, io or irq)", w.Resource)
+	}
+	if w.Kind != "some" && w.Kind != "full" {
+		return PressureWait{}, fmt.Errorf("pressure kind must be some or full, got %q", w.Kind)
+	}
+	if w.WindowMs < 500 || w.WindowMs > 10000 {
+		return PressureWait{}, fmt.Errorf("window_ms must be within 500..10000, got %d", w.WindowMs)
+	}
+	if w.ThresholdMs >= w.WindowMs {
+		return PressureWait{}, fmt.Errorf("threshold_ms must be less than window_ms (%d), got %d", w.WindowMs, w.ThresholdMs)
+	}
+
+	f, err := os.OpenFile(filepath.Join(pressureRoot, w.Resource), os.O_RDWR, 0)
+	if err != nil {
+		return PressureWait{}, fmt.Errorf("failed to open %s pressure for a trigger: %w", w.Resource, err)
+	}
+	defer f.Close()
+	trigger := fmt.Sprintf("%s %d %d", w.Kind, w.ThresholdMs*1000, w.WindowMs*1000)
+	if _, err := f.Write(append([]byte(trigger), 0)); err != nil {
+		return PressureWait{}, fmt.Errorf("failed to register %s pressure trigger %q: %w", w.Resource, trigger, err)
+	}
+
+	start := time.Now()
+	deadline := start.Add(time.Duration(timeoutMs) * time.Millisecond)
+	fds := []unix.PollFd{{Fd: int32(f.Fd()), Events: unix.POLLPRI}}
+	for {
+		// Poll in short slices so a cancelled request does not hold the
+		// handler for the whole timeout.
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return PressureWait{}, err
+		}
+		n, err := unix.Poll(fds, int(min(remaining, 200*time.Millisecond).Milliseconds())+1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return PressureWait{}, fmt.Errorf("failed to wait for %s pressure: %w", w.Resource, err)
+		}
+		if n == 0 {
+			continue
+		}
+		if fds[0].Revents&unix.POLLERR != 0 {
+			return PressureWait{}, fmt.Errorf("%s pressure trigger was removed by the kernel", w.Resource)
+		}
+		if fds[0].Revents&unix.POLLPRI != 0 {
+			w.Triggered = true
+			break
+		}
+	}
+	w.WaitedMs = float64(time.Since(start).Microseconds()) / 1000
+	return w, nil
+}
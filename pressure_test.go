@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePressureRoot writes PSI files for cpu and memory and points
+// pressureRoot at them.
+func fakePressureRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	saved := pressureRoot
+	pressureRoot = root
+	t.Cleanup(func() { pressureRoot = saved })
+
+	files := map[string]string{
+		"cpu":    "some avg10=1.50 avg60=0.75 avg300=0.10 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"memory": "some avg10=12.00 avg60=5.00 avg300=1.00 total=999\nfull avg10=2.00 avg60=1.00 avg300=0.50 total=111\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0o644))
+	}
+	return root
+}
+
+func TestGetPressure(t *testing.T) {
+	fakePressureRoot(t)
+	ctx := context.Background()
+
+	out, err := getPressure(ctx, PressureArgs{})
+	require.NoError(t, err)
+	require.NotNil(t, out.CPU)
+	require.NotNil(t, out.Memory)
+	assert.Nil(t, out.IO, "missing files are left out")
+	assert.Nil(t, out.IRQ)
+	assert.Equal(t, 12.0, out.Memory.Some.Avg10)
+	assert.Equal(t, uint64(111), out.Memory.Full.TotalUsec)
+	assert.Nil(t, out.Wait)
+
+	out, err = getPressure(ctx, PressureArgs{Resources: []string{"memory"}})
+	require.NoError(t, err)
+	assert.Nil(t, out.CPU)
+	assert.NotNil(t, out.Memory)
+
+	_, err = getPressure(ctx, PressureArgs{Resources: []string{"io"}})
+	assert.Error(t, err, "no data for any requested resource")
+	_, err = getPressure(ctx, PressureArgs{Resources: []string{"disk"}})
+	assert.Error(t, err)
+
+	pressureRoot = filepath.Join(t.TempDir(), "missing")
+	_, err = getPressure(ctx, PressureArgs{})
+	assert.ErrorContains(t, err, "not available")
+}
+
+func TestWaitPressureArgs(t *testing.T) {
+	fakePressureRoot(t)
+	ctx := context.Background()
+
+	for name, a := range map[string]PressureArgs{
+		"resource":  {Resource: "disk"},
+		"kind":      {Kind: "most"},
+		"window":    {WindowMs: 100},
+		"threshold": {ThresholdMs: 2000, WindowMs: 2000},
+	} {
+		_, err := waitPressure(ctx, a)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestWaitPressureTimeout(t *testing.T) {
+	// A plain file never signals POLLPRI, so the wait runs to its timeout.
+	fakePressureRoot(t)
+
+	w, err := waitPressure(context.Background(), PressureArgs{TimeoutMs: 300})
+	require.NoError(t, err)
+	assert.False(t, w.Triggered)
+	assert.Equal(t, "memory", w.Resource)
+	assert.Equal(t, "some", w.Kind)
+	assert.Equal(t, 100, w.ThresholdMs)
+	assert.Equal(t, 2000, w.WindowMs)
+	assert.GreaterOrEqual(t, w.WaitedMs, 300.0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = waitPressure(ctx, PressureArgs{TimeoutMs: 10000})
+	assert.ErrorIs(t, err, context.Canceled)
+}
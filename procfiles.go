@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// --- Per-process open files and connections ---
+
+type OpenFile struct {
+	FD      uint64 `json:"fd"`
+	Path    string `json:"path"`
+	Deleted bool   `json:"deleted,omitempty"` // unlinked but still held open, so its space is not freed
+}
+
+type ConnectionInfo struct {
+	FD         uint32 `json:"fd"`
+	Type       string `json:"type"`   // tcp|udp|unix
+	Family     string `json:"family"` // inet|inet6|unix
+	LocalAddr  string `json:"local_addr,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	Status     string `json:"status,omitempty"` // TCP state such as LISTEN or ESTABLISHED
+	PID        int32  `json:"pid,omitempty"`    // owning process, in get_connections
+	Process    string `json:"process,omitempty"`
+}
+
+type ProcessFilesResult struct {
+	PID            int32            `json:"pid"`
+	Name           string           `json:"name"`
+	NumFDs         int32            `json:"num_fds"`
+	FDSoftLimit    uint64           `json:"fd_soft_limit"` // RLIMIT_NOFILE
+	FDHardLimit    uint64           `json:"fd_hard_limit"`
+	FDUsagePercent float64          `json:"fd_usage_percent"` // num_fds against the soft limit
+	NumFiles       int              `json:"num_files"`
+	NumSockets     int              `json:"num_sockets"`
+	NumOther       int              `json:"num_other"` // pipes, eventfds, epoll and other anonymous descriptors
+	Files          []OpenFile       `json:"files"`
+	Connections    []ConnectionInfo `json:"connections"`
+	Truncated      bool             `json:"truncated,omitempty"` // files or connections were cut to max_items
+}
+
+type ProcessFilesArgs struct {
+	PID      int32 `json:"pid"`                 // process to inspect
+	MaxItems int   `json:"max_items,omitempty"` // max files and max connections listed (default 200, max 5000)
+}
+
+func getProcessFiles(ctx context.Context, pid int32, maxItems int) (ProcessFilesResult, error) {
+	if maxItems <= 0 {
+		maxItems = 200
+	}
+	if maxItems > 5000 {
+		maxItems = 5000
+	}
+
+	proc, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return ProcessFilesResult{}, fmt.Errorf("failed to get process %d: %w", pid, err)
+	}
+	numFDs, err := proc.NumFDsWithContext(ctx)
+	if err != nil {
+		return ProcessFilesResult{}, fmt.Errorf("failed to count file descriptors of process %d: %w", pid, err)
+	}
+	files, err := proc.OpenFilesWithContext(ctx)
+	if err != nil {
+		return ProcessFilesResult{}, fmt.Errorf("failed to list open files of process %d: %w", pid, err)
+	}
+	conns, err := proc.ConnectionsWithContext(ctx)
+	if err != nil {
+		return ProcessFilesResult{}, fmt.Errorf("failed to list connections of process %d: %w", pid, err)
+	}
+
+	out := ProcessFilesResult{
+		PID:        pid,
+		NumFDs:     numFDs,
+		NumFiles:   len(files),
+		NumSockets: len(conns),
+	}
+	out.Name, _ = proc.NameWithContext(ctx)
+	if other := int(numFDs) - len(files) - len(conns); other > 0 {
+		out.NumOther = other
+	}
+	if rlimits, err := proc.RlimitWithContext(ctx); err == nil {
+		for _, r := range rlimits {
+			if r.Resource == process.RLIMIT_NOFILE {
+				out.FDSoftLimit = r.Soft
+				out.FDHardLimit = r.Hard
+			}
+		}
+	}
+	if out.FDSoftLimit > 0 && out.FDSoftLimit != math.MaxUint64 {
+		out.FDUsagePercent = float64(numFDs) / float64(out.FDSoftLimit) * 100
+	}
+
+	out.Files = make([]OpenFile, 0, len(files))
+	for _, f := range files {
+		if len(out.Files) >= maxItems {
+			out.Truncated = true
+			break
+		}
+		path, deleted := strings.CutSuffix(f.Path, " (deleted)")
+		out.Files = append(out.Files, OpenFile{FD: f.Fd, Path: path, Deleted: deleted})
+	}
+	out.Connections = make([]ConnectionInfo, 0, len(conns))
+	for _, c := range conns {
+		if len(out.Connections) >= maxItems {
+			out.Truncated = true
+			break
+		}
+		out.Connections = append(out.Connections, connectionInfo(c))
+	}
+	return out, nil
+}
+
+func connectionInfo(c psnet.ConnectionStat) ConnectionInfo {
+	info := ConnectionInfo{FD: c.Fd, Status: c.Status}
+	if info.Status == "NONE" { // connectionless sockets have no state
+		info.Status = ""
+	}
+	switch c.Family {
+	case syscall.AF_INET:
+		info.Family = "inet"
+	case syscall.AF_INET6:
+		info.Family = "inet6"
+	case syscall.AF_UNIX:
+		info.Family = "unix"
+		info.Type = "unix"
+		info.LocalAddr = c.Laddr.IP // the socket path, if bound
+		info.RemoteAddr = c.Raddr.IP
+		return info
+	default:
+		info.Family = strconv.FormatUint(uint64(c.Family), 10)
+	}
+	switch c.Type {
+	case syscall.SOCK_STREAM:
+		info.Type = "tcp"
+	case syscall.SOCK_DGRAM:
+		info.Type = "udp"
+	default:
+		info.Type = strconv.FormatUint(uint64(c.Type), 10)
+	}
+	info.LocalAddr = formatAddr(c.Laddr)
+	info.RemoteAddr = formatAddr(c.Raddr)
+	return info
+}
+
+func formatAddr(a psnet.Addr) string {
+	if a.IP == "" && a.Port == 0 {
+		return ""
+	}
+	return net.JoinHostPort(a.IP, strconv.FormatUint(uint64(a.Port), 10))
+}
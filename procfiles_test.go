@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProcessFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "held-open")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	deleted, err := os.Create(path + ".deleted")
+	require.NoError(t, err)
+	defer deleted.Close()
+	require.NoError(t, os.Remove(deleted.Name()))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	out, err := getProcessFiles(context.Background(), int32(os.Getpid()), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int32(os.Getpid()), out.PID)
+	assert.GreaterOrEqual(t, int(out.NumFDs), out.NumFiles+out.NumSockets)
+	assert.Greater(t, out.FDSoftLimit, uint64(0))
+	assert.Greater(t, out.FDUsagePercent, float64(0))
+
+	var sawFile, sawDeleted bool
+	for _, file := range out.Files {
+		switch file.Path {
+		case f.Name():
+			sawFile = true
+			assert.False(t, file.Deleted)
+		case deleted.Name():
+			sawDeleted = true
+			assert.True(t, file.Deleted)
+		}
+	}
+	assert.True(t, sawFile, "open file not listed")
+	assert.True(t, sawDeleted, "deleted file not listed")
+
+	var sawListener bool
+	for _, c := range out.Connections {
+		if c.LocalAddr == ln.Addr().String() {
+			sawListener = true
+			assert.Equal(t, "tcp", c.Type)
+			assert.Equal(t, "inet", c.Family)
+			assert.Equal(t, "LISTEN", c.Status)
+		}
+	}
+	assert.True(t, sawListener, "listener not listed")
+
+	t.Run("max items", func(t *testing.T) {
+		out, err := getProcessFiles(context.Background(), int32(os.Getpid()), 1)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(out.Files), 1)
+		assert.LessOrEqual(t, len(out.Connections), 1)
+		assert.True(t, out.Truncated)
+	})
+
+	t.Run("missing process", func(t *testing.T) {
+		_, err := getProcessFiles(context.Background(), 1<<30, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestConnectionInfo(t *testing.T) {
+	tcp6 := connectionInfo(psnet.ConnectionStat{
+		Fd: 7, Family: syscall.AF_INET6, Type: syscall.SOCK_STREAM,
+		Laddr:  psnet.Addr{IP: "::1", Port: 443},
+		Raddr:  psnet.Addr{IP: "::1", Port: 50000},
+		Status: "ESTABLISHED",
+	})
+	assert.Equal(t, ConnectionInfo{FD: 7, Type: "tcp", Family: "inet6", LocalAddr: "[::1]:443", RemoteAddr: "[::1]:50000", Status: "ESTABLISHED"}, tcp6)
+
+	udp := connectionInfo(psnet.ConnectionStat{Family: syscall.AF_INET, Type: syscall.SOCK_DGRAM, Laddr: psnet.Addr{IP: "0.0.0.0", Port: 53}, Status: "NONE"})
+	assert.Equal(t, ConnectionInfo{Type: "udp", Family: "inet", LocalAddr: "0.0.0.0:53"}, udp)
+
+	unix := connectionInfo(psnet.ConnectionStat{Family: syscall.AF_UNIX, Type: syscall.SOCK_STREAM, Laddr: psnet.Addr{IP: "/run/app.sock"}, Status: "NONE"})
+	assert.Equal(t, ConnectionInfo{Type: "unix", Family: "unix", LocalAddr: "/run/app.sock"}, unix)
+}
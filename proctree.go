@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// --- Process tree ---
+
+// ProcessTreeNode is one process with its children. The subtree totals
+// cover every descendant, including those hidden by the depth limit or the
+// name filter.
+type ProcessTreeNode struct {
+	PID                 int32              `json:"pid"`
+	PPID                int32              `json:"ppid"`
+	Name                string             `json:"name"`
+	CPUPercent          float64            `json:"cpu_percent"`
+	MemoryRSS           uint64             `json:"memory_rss_bytes"`
+	SubtreeCPUPercent   float64            `json:"subtree_cpu_percent"`
+	SubtreeMemoryRSS    uint64             `json:"subtree_memory_rss_bytes"`
+	SubtreeProcessCount int                `json:"subtree_process_count"`
+	Matched             bool               `json:"matched,omitempty"`          // name matches the filter
+	ChildrenOmitted     int                `json:"children_omitted,omitempty"` // children cut off by max_depth
+	Children            []*ProcessTreeNode `json:"children,omitempty"`
+}
+
+type ProcessTreeResult struct {
+	Root         *ProcessTreeNode `json:"root"`
+	ProcessCount int              `json:"process_count"`           // processes under root, root included
+	MatchedCount int              `json:"matched_count,omitempty"` // processes matching the name filter
+	CPUWindowMs  int64            `json:"cpu_window_ms"`
+}
+
+type ProcessTreeArgs struct {
+	PID        int32  `json:"pid,omitempty"`         // root of the tree, default 1
+	MaxDepth   int    `json:"max_depth,omitempty"`   // levels below the root to include, 0 for all
+	Name       string `json:"name,omitempty"`        // keep only processes whose name contains this, plus their ancestors
+	IntervalMs int    `json:"interval_ms,omitempty"` // CPU sampling window in ms (same bounds as get_cpu_info), default 1000
+}
+
+// processTreeEntry is the per-process data the tree is built from.
+type processTreeEntry struct {
+	pid, ppid int32
+	name      string
+	rss       uint64
+	cpu       float64
+}
+
+func getProcessTree(ctx context.Context, root int32, maxDepth int, name string, intervalMs int) (ProcessTreeResult, error) {
+	if root <= 0 {
+		root = 1
+	}
+	window := sampleWindow(intervalMs)
+
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return ProcessTreeResult{}, fmt.Errorf("failed to list processes: %w", err)
+	}
+	cpuPercent, err := sampleProcessCPU(ctx, procs, window)
+	if err != nil {
+		return ProcessTreeResult{}, err
+	}
+	entries := make([]processTreeEntry, 0, len(procs))
+	for _, p := range procs {
+		pct, ok := cpuPercent[p.Pid]
+		if !ok {
+			continue // exited during the sampling window
+		}
+		ppid, err := p.PpidWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		e := processTreeEntry{pid: p.Pid, ppid: ppid, cpu: pct}
+		e.name, _ = p.NameWithContext(ctx)
+		if mem, err := p.MemoryInfoWithContext(ctx); err == nil {
+			e.rss = mem.RSS
+		}
+		entries = append(entries, e)
+	}
+
+	out, err := buildProcessTree(entries, root, maxDepth, name)
+	if err != nil {
+		return ProcessTreeResult{}, err
+	}
+	out.CPUWindowMs = window.Milliseconds()
+	return out, nil
+}
+
+// buildProcessTree links entries into a tree under root. Nodes deeper than
+// maxDepth (when positive) are dropped and counted on their parent. With a
+// name filter, only matching processes and the ancestors leading to them
+// are kept.
+func buildProcessTree(entries []processTreeEntry, root int32, maxDepth int, name string) (ProcessTreeResult, error) {
+	byPID := make(map[int32]processTreeEntry, len(entries))
+	children := make(map[int32][]int32)
+	for _, e := range entries {
+		byPID[e.pid] = e
+		if e.ppid != e.pid {
+			children[e.ppid] = append(children[e.ppid], e.pid)
+		}
+	}
+	if _, ok := byPID[root]; !ok {
+		return ProcessTreeResult{}, fmt.Errorf("process %d not found", root)
+	}
+	for _, c := range children {
+		sort.Slice(c, func(i, j int) bool { return c[i] < c[j] })
+	}
+
+	name = strings.ToLower(name)
+	var out ProcessTreeResult
+	visited := make(map[int32]bool)
+
+	// build returns the node for pid and whether it should be kept under
+	// the filter, i.e. it or a descendant matches.
+	var build func(pid int32, depth int) (*ProcessTreeNode, bool)
+	build = func(pid int32, depth int) (*ProcessTreeNode, bool) {
+		visited[pid] = true
+		e := byPID[pid]
+		n := &ProcessTreeNode{
+			PID:                 e.pid,
+			PPID:                e.ppid,
+			Name:                e.name,
+			CPUPercent:          e.cpu,
+			MemoryRSS:           e.rss,
+			SubtreeCPUPercent:   e.cpu,
+			SubtreeMemoryRSS:    e.rss,
+			SubtreeProcessCount: 1,
+		}
+		if name != "" && strings.Contains(strings.ToLower(e.name), name) {
+			n.Matched = true
+			out.MatchedCount++
+		}
+		keep := name == "" || n.Matched
+		for _, c := range children[pid] {
+			if visited[c] {
+				continue // guards against a PID reused mid-scan forming a loop
+			}
+			child, childKeep := build(c, depth+1)
+			n.SubtreeCPUPercent += child.SubtreeCPUPercent
+			n.SubtreeMemoryRSS += child.SubtreeMemoryRSS
+			n.SubtreeProcessCount += child.SubtreeProcessCount
+			if !childKeep {
+				continue
+			}
+			keep = true
+			if maxDepth > 0 && depth >= maxDepth {
+				n.ChildrenOmitted++
+				continue
+			}
+			n.Children = append(n.Children, child)
+		}
+		return n, keep
+	}
+
+	out.Root, _ = build(root, 0)
+	out.ProcessCount = out.Root.SubtreeProcessCount
+	return out, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTree is init -> supervisor -> three node workers, plus sshd.
+var testTree = []processTreeEntry{
+	{pid: 1, ppid: 0, name: "systemd", rss: 10, cpu: 1},
+	{pid: 100, ppid: 1, name: "supervisor", rss: 20, cpu: 2},
+	{pid: 101, ppid: 100, name: "node", rss: 100, cpu: 10},
+	{pid: 102, ppid: 100, name: "node", rss: 200, cpu: 20},
+	{pid: 103, ppid: 100, name: "node", rss: 300, cpu: 30},
+	{pid: 200, ppid: 1, name: "sshd", rss: 5, cpu: 0},
+	{pid: 201, ppid: 200, name: "bash", rss: 3, cpu: 0},
+}
+
+func TestBuildProcessTree(t *testing.T) {
+	t.Run("full tree", func(t *testing.T) {
+		out, err := buildProcessTree(testTree, 1, 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, 7, out.ProcessCount)
+		assert.Equal(t, uint64(638), out.Root.SubtreeMemoryRSS)
+		assert.InDelta(t, 63, out.Root.SubtreeCPUPercent, 0.001)
+
+		require.Len(t, out.Root.Children, 2)
+		sup := out.Root.Children[0]
+		assert.Equal(t, int32(100), sup.PID)
+		assert.Equal(t, int32(1), sup.PPID)
+		assert.Equal(t, 4, sup.SubtreeProcessCount)
+		assert.Equal(t, uint64(620), sup.SubtreeMemoryRSS)
+		require.Len(t, sup.Children, 3)
+		assert.Equal(t, []int32{101, 102, 103}, []int32{sup.Children[0].PID, sup.Children[1].PID, sup.Children[2].PID})
+	})
+
+	t.Run("depth limit keeps totals", func(t *testing.T) {
+		out, err := buildProcessTree(testTree, 1, 1, "")
+		require.NoError(t, err)
+		require.Len(t, out.Root.Children, 2)
+		sup := out.Root.Children[0]
+		assert.Empty(t, sup.Children)
+		assert.Equal(t, 3, sup.ChildrenOmitted)
+		assert.Equal(t, uint64(620), sup.SubtreeMemoryRSS)
+	})
+
+	t.Run("name filter keeps ancestors", func(t *testing.T) {
+		out, err := buildProcessTree(testTree, 1, 0, "NODE")
+		require.NoError(t, err)
+		assert.Equal(t, 3, out.MatchedCount)
+		require.Len(t, out.Root.Children, 1) // sshd pruned
+		sup := out.Root.Children[0]
+		assert.False(t, sup.Matched)
+		require.Len(t, sup.Children, 3)
+		assert.True(t, sup.Children[0].Matched)
+		assert.Equal(t, 7, out.ProcessCount)
+	})
+
+	t.Run("subtree root", func(t *testing.T) {
+		out, err := buildProcessTree(testTree, 200, 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, "sshd", out.Root.Name)
+		assert.Equal(t, 2, out.ProcessCount)
+	})
+
+	t.Run("unknown root", func(t *testing.T) {
+		_, err := buildProcessTree(testTree, 999, 0, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("parent loop", func(t *testing.T) {
+		loop := append([]processTreeEntry{
+			{pid: 300, ppid: 301, name: "a"},
+			{pid: 301, ppid: 300, name: "b"},
+		}, testTree...)
+		out, err := buildProcessTree(loop, 300, 0, "")
+		require.NoError(t, err)
+		assert.Equal(t, 2, out.ProcessCount)
+	})
+}
+
+func TestGetProcessTree(t *testing.T) {
+	ctx := context.Background()
+
+	out, err := getProcessTree(ctx, int32(os.Getppid()), 1, "", 100)
+	require.NoError(t, err)
+	assert.Equal(t, int32(os.Getppid()), out.Root.PID)
+	assert.Equal(t, int64(100), out.CPUWindowMs)
+	assert.GreaterOrEqual(t, out.ProcessCount, 2) // the test binary is a child
+
+	found := false
+	for _, c := range out.Root.Children {
+		if c.PID == int32(os.Getpid()) {
+			found = true
+			assert.Empty(t, c.Children)
+		}
+	}
+	assert.True(t, found, "test process not under its parent")
+
+	info, err := getProcessInfo(ctx, int32(os.Getpid()), "", 0, "", 100, false)
+	require.NoError(t, err)
+	assert.Equal(t, int32(os.Getppid()), info.Processes[0].PPID)
+}
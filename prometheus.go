@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// --- Prometheus exporter ---
+
+// MetricsConfig controls the optional HTTP listener serving the collectors'
+// numbers in the Prometheus text exposition format. It has no
+// authentication, so it listens on loopback by default.
+type MetricsConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Addr         string `yaml:"addr"`          // listen address
+	Path         string `yaml:"path"`          // URL path of the metrics
+	TopProcesses int    `yaml:"top_processes"` // processes reported, busiest CPU first
+}
+
+const DefaultMetricsAddr = "127.0.0.1:9464"
+
+func DefaultMetricsConfig() MetricsConfig {
+	return MetricsConfig{Addr: DefaultMetricsAddr, Path: "/metrics", TopProcesses: 10}
+}
+
+func (c MetricsConfig) validate(processLimitMax int) error {
+	if !c.Enabled {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		return fmt.Errorf("metrics.addr %q is invalid: %w", c.Addr, err)
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("metrics.path must start with /, got %q", c.Path)
+	}
+	if c.TopProcesses < 0 || c.TopProcesses > processLimitMax {
+		return fmt.Errorf("metrics.top_processes must be within 0..%d (limits.process_limit_max), got %d", processLimitMax, c.TopProcesses)
+	}
+	return nil
+}
+
+// metricPrefix starts the name of every exported metric.
+const metricPrefix = "posix_system_"
+
+// promFamily is one metric with its samples, written as a unit.
+type promFamily struct {
+	name, typ, help string
+	samples         []string        // formatted sample lines
+	seen            map[string]bool // label sets already sampled
+}
+
+// promRegistry collects the samples of one scrape. Families are written in
+// the order they were first added.
+type promRegistry struct {
+	families []*promFamily
+	byName   map[string]*promFamily
+}
+
+func newPromRegistry() *promRegistry {
+	return &promRegistry{byName: make(map[string]*promFamily)}
+}
+
+// add records a sample of the metric metricPrefix+name. labels are
+// name/value pairs.
+func (r *promRegistry) add(name, typ, help string, value float64, labels ...string) {
+	name = metricPrefix + name
+	f, ok := r.byName[name]
+	if !ok {
+		f = &promFamily{name: name, typ: typ, help: help, seen: make(map[string]bool)}
+		r.byName[name] = f
+		r.families = append(r.families, f)
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(promLabelEscaper.Replace(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	// The same mount can be listed twice (bind mounts); Prometheus rejects
+	// a scrape with duplicate series, so keep the first.
+	if f.seen[b.String()] {
+		return
+	}
+	f.seen[b.String()] = true
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64)) // +Inf, -Inf and NaN are spelt as Prometheus expects
+	f.samples = append(f.samples, b.String())
+}
+
+func (r *promRegistry) gauge(name, help string, value float64, labels ...string) {
+	r.add(name, "gauge", help, value, labels...)
+}
+
+func (r *promRegistry) counter(name, help string, value float64, labels ...string) {
+	r.add(name, "counter", help, value, labels...)
+}
+
+var (
+	promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	promHelpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func (r *promRegistry) write(buf *bytes.Buffer) {
+	for _, f := range r.families {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", f.name, promHelpEscaper.Replace(f.help), f.name, f.typ)
+		for _, s := range f.samples {
+			buf.WriteString(s)
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+// gatherMetrics runs every collector concurrently and returns the samples.
+// A collector that fails is reported through collector_success instead of
+// failing the scrape.
+func gatherMetrics(ctx context.Context, cfg MetricsConfig) *promRegistry {
+	collectors := []struct {
+		name string
+		fn   func(context.Context, *promRegistry) error
+	}{
+		{"cpu", gatherCPU},
+		{"memory", gatherMemory},
+		{"load", gatherLoad},
+		{"disk", gatherDisks},
+		{"network", gatherNetwork},
+		{"process", func(ctx context.Context, r *promRegistry) error { return gatherProcesses(ctx, r, cfg.TopProcesses) }},
+	}
+
+	start := time.Now()
+	parts := make([]*promRegistry, len(collectors))
+	errs := make([]error, len(collectors))
+	var wg sync.WaitGroup
+	for i, c := range collectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parts[i] = newPromRegistry()
+			errs[i] = c.fn(ctx, parts[i])
+		}()
+	}
+	wg.Wait()
+
+	out := newPromRegistry()
+	for i, c := range collectors {
+		for _, f := range parts[i].families {
+			out.byName[f.name] = f
+			out.families = append(out.families, f)
+		}
+		ok := 1.0
+		if errs[i] != nil {
+			ok = 0
+		}
+		out.gauge("collector_success", "Whether the collector succeeded in this scrape.", ok, "collector", c.name)
+	}
+	gatherAuth(out, activeAuth.Load())
+	out.gauge("scrape_duration_seconds", "Time taken to gather all metrics.", time.Since(start).Seconds())
+	return out
+}
+
+// gatherAuth reports the MCP transport's authentication rejections by
+// reason; nothing is reported when authentication is off.
+func gatherAuth(r *promRegistry, auth *authenticator) {
+	if auth == nil {
+		return
+	}
+	rejected := auth.Rejected()
+	for _, reason := range rejectReasons {
+		r.counter("auth_rejections_total", "Requests to the MCP endpoint rejected by authentication.", float64(rejected[reason]), "reason", reason)
+	}
+}
+
+func gatherCPU(ctx context.Context, r *promRegistry) error {
+	times, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return err
+	}
+	const help = "Seconds the CPUs spent in each mode."
+	for _, t := range times {
+		for _, m := range []struct {
+			mode string
+			v    float64
+		}{
+			{"user", t.User}, {"nice", t.Nice}, {"system", t.System}, {"idle", t.Idle}, {"iowait", t.Iowait},
+			{"irq", t.Irq}, {"softirq", t.Softirq}, {"steal", t.Steal},
+		} {
+			r.counter("cpu_seconds_total", help, m.v, "cpu", t.CPU, "mode", m.mode)
+		}
+	}
+	if n, err := cpu.CountsWithContext(ctx, true); err == nil {
+		r.gauge("cpu_logical_count", "Number of logical CPUs.", float64(n))
+	}
+	return nil
+}
+
+func gatherMemory(ctx context.Context, r *promRegistry) error {
+	m, err := getMemoryInfo(ctx)
+	if err != nil {
+		return err
+	}
+	r.gauge("memory_total_bytes", "Total physical memory.", float64(m.Total))
+	r.gauge("memory_available_bytes", "Memory available for new work without swapping.", float64(m.Available))
+	r.gauge("memory_used_bytes", "Memory in use.", float64(m.Used))
+	r.gauge("memory_free_bytes", "Unused memory.", float64(m.Free))
+	r.gauge("memory_buffers_bytes", "Memory used by kernel buffers.", float64(m.Buffers))
+	r.gauge("memory_cached_bytes", "Memory used by the page cache.", float64(m.Cached))
+	r.gauge("swap_total_bytes", "Total swap space.", float64(m.SwapTotal))
+	r.gauge("swap_used_bytes", "Swap space in use.", float64(m.SwapUsed))
+	if c := m.Container; c != nil {
+		r.gauge("cgroup_memory_limit_bytes", "Memory limit of the exporter's own cgroup.", float64(c.LimitBytes), "cgroup", c.Cgroup)
+		r.gauge("cgroup_memory_usage_bytes", "Memory usage of the exporter's own cgroup.", float64(c.UsageBytes), "cgroup", c.Cgroup)
+	}
+	return nil
+}
+
+func gatherLoad(ctx context.Context, r *promRegistry) error {
+	l, err := getLoadAverage(ctx)
+	if err != nil {
+		return err
+	}
+	r.gauge("load1", "1-minute load average.", l.Load1)
+	r.gauge("load5", "5-minute load average.", l.Load5)
+	r.gauge("load15", "15-minute load average.", l.Load15)
+	return nil
+}
+
+func gatherDisks(ctx context.Context, r *promRegistry) error {
+	d, err := getDiskInfo(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, disk := range d.Disks {
+		labels := []string{"device", disk.Device, "mountpoint", disk.Mountpoint, "fstype", disk.Fstype}
+		r.gauge("filesystem_size_bytes", "Filesystem size.", float64(disk.Total), labels...)
+		r.gauge("filesystem_used_bytes", "Filesystem space in use.", float64(disk.Used), labels...)
+		r.gauge("filesystem_free_bytes", "Filesystem space free.", float64(disk.Free), labels...)
+		r.gauge("filesystem_inodes_total", "Filesystem inodes.", float64(disk.InodesTotal), labels...)
+		r.gauge("filesystem_inodes_free", "Filesystem inodes free.", float64(disk.InodesFree), labels...)
+	}
+	return nil
+}
+
+func gatherNetwork(ctx context.Context, r *promRegistry) error {
+	ifaces, err := readNetworkCounters(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, n := range ifaces {
+		l := []string{"interface", n.Interface}
+		r.counter("network_receive_bytes_total", "Bytes received.", float64(n.BytesRecv), l...)
+		r.counter("network_transmit_bytes_total", "Bytes sent.", float64(n.BytesSent), l...)
+		r.counter("network_receive_packets_total", "Packets received.", float64(n.PacketsRecv), l...)
+		r.counter("network_transmit_packets_total", "Packets sent.", float64(n.PacketsSent), l...)
+		r.counter("network_receive_errors_total", "Receive errors.", float64(n.Errin), l...)
+		r.counter("network_transmit_errors_total", "Transmit errors.", float64(n.Errout), l...)
+		r.counter("network_receive_drops_total", "Received packets dropped.", float64(n.Dropin), l...)
+		r.counter("network_transmit_drops_total", "Outgoing packets dropped.", float64(n.Dropout), l...)
+	}
+	return nil
+}
+
+// gatherProcesses reports the top processes by CPU over the default
+// get_process_info window.
+func gatherProcesses(ctx context.Context, r *promRegistry, top int) error {
+	if top == 0 {
+		return nil
+	}
+	p, err := getProcessInfo(ctx, 0, "", top, "cpu", 0, false)
+	if err != nil {
+		return err
+	}
+	for _, proc := range p.Processes {
+		l := []string{"pid", strconv.Itoa(int(proc.PID)), "name", proc.Name}
+		r.gauge("process_cpu_percent", "CPU usage of a top process over the sampling window, in percent of one CPU.", proc.CPUPercent, l...)
+		r.gauge("process_resident_memory_bytes", "Resident memory of a top process.", float64(proc.MemoryRSS), l...)
+		r.gauge("process_threads", "Threads of a top process.", float64(proc.NumThreads), l...)
+	}
+	return nil
+}
+
+// newMetricsHandler serves a fresh scrape on cfg.Path.
+func newMetricsHandler(cfg MetricsConfig) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(cfg.Path, func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var buf bytes.Buffer
+		gatherMetrics(req.Context(), cfg).write(&buf)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+	return mux
+}
+
+// runMetricsServer serves the exporter until ctx is cancelled.
+func runMetricsServer(ctx context.Context, cfg MetricsConfig) error {
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.Addr, err)
+	}
+	return serveHTTP(ctx, ln, newMetricsHandler(cfg))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parsePromText parses a text exposition with the Prometheus text parser.
+func parsePromText(r io.Reader) (map[string]*dto.MetricFamily, error) {
+	var p expfmt.TextParser
+	return p.TextToMetricFamilies(r)
+}
+
+func promLabels(m *dto.Metric) map[string]string {
+	labels := make(map[string]string, len(m.GetLabel()))
+	for _, l := range m.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	return labels
+}
+
+func promValue(m *dto.Metric) float64 {
+	switch {
+	case m.Gauge != nil:
+		return m.GetGauge().GetValue()
+	case m.Counter != nil:
+		return m.GetCounter().GetValue()
+	}
+	return m.GetUntyped().GetValue()
+}
+
+func TestPromRegistry(t *testing.T) {
+	r := newPromRegistry()
+	r.gauge("test_value", "A help line with \\ and\nnewline.", 1.5, "path", `C:\dir "x"`+"\n")
+	r.gauge("test_value", "", 2, "path", "/")
+	r.gauge("test_value", "", 3, "path", "/") // duplicate, dropped
+	r.counter("test_total", "Counts.", 42)
+	var buf bytes.Buffer
+	r.write(&buf)
+
+	assert.Equal(t, `# HELP posix_system_test_value A help line with \\ and\nnewline.
+# TYPE posix_system_test_value gauge
+posix_system_test_value{path="C:\\dir \"x\"\n"} 1.5
+posix_system_test_value{path="/"} 2
+# HELP posix_system_test_total Counts.
+# TYPE posix_system_test_total counter
+posix_system_test_total 42
+`, buf.String())
+
+	families, err := parsePromText(&buf)
+	require.NoError(t, err)
+	value := families["posix_system_test_value"]
+	require.NotNil(t, value)
+	assert.Equal(t, dto.MetricType_GAUGE, value.GetType())
+	assert.Equal(t, "A help line with \\ and\nnewline.", value.GetHelp())
+	require.Len(t, value.GetMetric(), 2)
+	assert.Equal(t, `C:\dir "x"`+"\n", promLabels(value.GetMetric()[0])["path"])
+	assert.Equal(t, 1.5, promValue(value.GetMetric()[0]))
+	assert.Equal(t, dto.MetricType_COUNTER, families["posix_system_test_total"].GetType())
+	assert.Equal(t, float64(42), promValue(families["posix_system_test_total"].GetMetric()[0]))
+}
+
+func TestAuthRejectionMetrics(t *testing.T) {
+	r := newPromRegistry()
+	gatherAuth(r, nil)
+	assert.Empty(t, r.families, "nothing without authentication")
+
+	auth, err := newAuthenticator(AuthOptions{TokenFile: writeTempFile(t, "tokens", "s3cret\n")})
+	require.NoError(t, err)
+	auth.log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := auth.Middleware(http.NotFoundHandler())
+	for _, header := range []string{"", "Bearer guess", "Bearer guess"} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	gatherAuth(r, auth)
+	var buf bytes.Buffer
+	r.write(&buf)
+	families, err := parsePromText(&buf)
+	require.NoError(t, err)
+	f := families["posix_system_auth_rejections_total"]
+	require.NotNil(t, f)
+	assert.Equal(t, dto.MetricType_COUNTER, f.GetType())
+	got := make(map[string]float64)
+	for _, m := range f.GetMetric() {
+		got[promLabels(m)["reason"]] = promValue(m)
+	}
+	assert.Equal(t, map[string]float64{rejectMissingToken: 1, rejectInvalidToken: 2, rejectMissingCert: 0, rejectInvalidCert: 0}, got)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := DefaultMetricsConfig()
+	cfg.TopProcesses = 3
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- serveHTTP(ctx, ln, newMetricsHandler(cfg)) }()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	families, err := parsePromText(resp.Body)
+	require.NoError(t, err)
+
+	for name, typ := range map[string]dto.MetricType{
+		"posix_system_cpu_seconds_total":             dto.MetricType_COUNTER,
+		"posix_system_memory_total_bytes":            dto.MetricType_GAUGE,
+		"posix_system_load1":                         dto.MetricType_GAUGE,
+		"posix_system_filesystem_size_bytes":         dto.MetricType_GAUGE,
+		"posix_system_network_receive_bytes_total":   dto.MetricType_COUNTER,
+		"posix_system_process_resident_memory_bytes": dto.MetricType_GAUGE,
+		"posix_system_collector_success":             dto.MetricType_GAUGE,
+		"posix_system_scrape_duration_seconds":       dto.MetricType_GAUGE,
+	} {
+		if assert.Contains(t, families, name) {
+			assert.Equal(t, typ, families[name].GetType(), name)
+			assert.NotEmpty(t, families[name].GetHelp(), name)
+		}
+	}
+	for _, m := range families["posix_system_collector_success"].GetMetric() {
+		assert.Equal(t, float64(1), promValue(m), promLabels(m)["collector"])
+	}
+	assert.Greater(t, promValue(families["posix_system_memory_total_bytes"].GetMetric()[0]), float64(0))
+	cpu := promLabels(families["posix_system_cpu_seconds_total"].GetMetric()[0])
+	assert.Contains(t, cpu, "cpu")
+	assert.Contains(t, cpu, "mode")
+	procs := families["posix_system_process_resident_memory_bytes"].GetMetric()
+	assert.LessOrEqual(t, len(procs), 3)
+	assert.Contains(t, promLabels(procs[0]), "pid")
+	assert.Contains(t, promLabels(procs[0]), "name")
+	for _, m := range families["posix_system_filesystem_size_bytes"].GetMetric() {
+		assert.ElementsMatch(t, []string{"device", "mountpoint", "fstype"}, labelNames(promLabels(m)))
+	}
+
+	post, err := http.Post("http://"+ln.Addr().String()+"/metrics", "text/plain", nil)
+	require.NoError(t, err)
+	post.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, post.StatusCode)
+}
+
+func labelNames(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+func TestMetricsConfig(t *testing.T) {
+	opts, err := parseFlags([]string{"--metrics-addr", "0.0.0.0:9500"})
+	require.NoError(t, err)
+	assert.True(t, opts.Config.Metrics.Enabled)
+	assert.Equal(t, "0.0.0.0:9500", opts.Config.Metrics.Addr)
+
+	_, err = parseConfig([]byte("metrics:\n  enabled: true\n  path: metrics\n"))
+	assert.Error(t, err)
+	_, err = parseConfig([]byte("metrics:\n  enabled: true\n  top_processes: 1000\n"))
+	assert.Error(t, err)
+	_, err = parseConfig([]byte("transport:\n  type: http\n  addr: 127.0.0.1:9464\nmetrics:\n  enabled: true\n"))
+	assert.ErrorContains(t, err, "transport")
+	_, err = parseConfig([]byte("metrics:\n  enabled: true\n  addr: 127.0.0.1:9999\n"))
+	assert.NoError(t, err)
+}
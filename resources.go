@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// --- MCP resources ---
+
+// ResourcesConfig controls how subscribed resources are watched for changes.
+type ResourcesConfig struct {
+	PollIntervalMs int     `yaml:"poll_interval_ms"` // time between re-reads of subscribed resources
+	MinChange      float64 `yaml:"min_change"`       // smallest change of a watched value that is reported
+}
+
+func DefaultResourcesConfig() ResourcesConfig {
+	return ResourcesConfig{PollIntervalMs: 5000, MinChange: 1}
+}
+
+func (c ResourcesConfig) validate() error {
+	if c.PollIntervalMs < 100 {
+		return fmt.Errorf("resources.poll_interval_ms must be at least 100, got %d", c.PollIntervalMs)
+	}
+	if c.MinChange < 0 {
+		return fmt.Errorf("resources.min_change must not be negative, got %g", c.MinChange)
+	}
+	return nil
+}
+
+const (
+	resourceCPU     = "system://cpu"
+	resourceMemory  = "system://memory"
+	resourceLoad    = "system://load"
+	resourceDisks   = "system://disks"
+	diskResourceURI = "system://disks/{mount}" // mount is percent-encoded, e.g. system://disks/%2Fvar
+	procResourceURI = "system://process/{pid}"
+)
+
+// resourceReader reads one resource. Besides the document it returns the
+// numeric values a subscription watches for changes, keyed by field name.
+type resourceReader func(ctx context.Context) (any, map[string]float64, error)
+
+// lookupResource returns the reader for a system:// URI.
+func lookupResource(uri string) (resourceReader, bool) {
+	switch uri {
+	case resourceCPU:
+		return readCPUResource, true
+	case resourceMemory:
+		return readMemoryResource, true
+	case resourceLoad:
+		return readLoadResource, true
+	case resourceDisks:
+		return readDisksResource, true
+	}
+	if rest, ok := strings.CutPrefix(uri, resourceDisks+"/"); ok {
+		mount, err := url.PathUnescape(rest)
+		if err != nil || mount == "" {
+			return nil, false
+		}
+		return func(ctx context.Context) (any, map[string]float64, error) {
+			return readDiskResource(ctx, uri, mount)
+		}, true
+	}
+	if rest, ok := strings.CutPrefix(uri, "system://process/"); ok {
+		pid, err := strconv.ParseInt(rest, 10, 32)
+		if err != nil || pid <= 0 {
+			return nil, false
+		}
+		return func(ctx context.Context) (any, map[string]float64, error) {
+			return readProcessResource(ctx, uri, int32(pid))
+		}, true
+	}
+	return nil, false
+}
+
+func readCPUResource(ctx context.Context) (any, map[string]float64, error) {
+	out, err := getCPUInfo(ctx, false, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	watch := make(map[string]float64)
+	if len(out.Usage) > 0 {
+		watch["usage_percent"] = out.Usage[0]
+	}
+	if out.Container != nil {
+		watch["container.usage_percent"] = out.Container.UsagePercent
+	}
+	return out, watch, nil
+}
+
+func readMemoryResource(ctx context.Context) (any, map[string]float64, error) {
+	out, err := getMemoryInfo(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	watch := map[string]float64{"used_percent": out.UsedPercent}
+	if out.SwapTotal > 0 {
+		watch["swap_used_percent"] = float64(out.SwapUsed) / float64(out.SwapTotal) * 100
+	}
+	if out.Container != nil && out.Container.LimitBytes > 0 {
+		watch["container.usage_percent"] = out.Container.UsagePercent
+	}
+	return out, watch, nil
+}
+
+func readLoadResource(ctx context.Context) (any, map[string]float64, error) {
+	out, err := getLoadAverage(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, map[string]float64{"load1": out.Load1, "load5": out.Load5, "load15": out.Load15}, nil
+}
+
+func readDisksResource(ctx context.Context) (any, map[string]float64, error) {
+	out, err := getDiskInfo(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	watch := make(map[string]float64, len(out.Disks))
+	for _, d := range out.Disks {
+		watch[d.Mountpoint+".used_percent"] = d.UsedPercent
+	}
+	return out, watch, nil
+}
+
+// readDiskResource reports one mounted filesystem; paths that are not a
+// mount point are not found.
+func readDiskResource(ctx context.Context, uri, mount string) (any, map[string]float64, error) {
+	all, err := getDiskInfo(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, d := range all.Disks {
+		if d.Mountpoint != mount {
+			continue
+		}
+		watch := map[string]float64{"used_percent": d.UsedPercent}
+		if d.InodesTotal > 0 {
+			watch["inodes_used_percent"] = float64(d.InodesUsed) / float64(d.InodesTotal) * 100
+		}
+		return d, watch, nil
+	}
+	return nil, nil, mcp.ResourceNotFoundError(uri)
+}
+
+func readProcessResource(ctx context.Context, uri string, pid int32) (any, map[string]float64, error) {
+	if ok, err := process.PidExistsWithContext(ctx, pid); err != nil || !ok {
+		return nil, nil, mcp.ResourceNotFoundError(uri)
+	}
+	out, err := getProcessInfo(ctx, pid, "", 1, "", 0, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(out.Processes) == 0 {
+		return nil, nil, mcp.ResourceNotFoundError(uri)
+	}
+	p := out.Processes[0]
+	return p, map[string]float64{
+		"cpu_percent":    p.CPUPercent,
+		"memory_percent": float64(p.MemoryPercent),
+		"num_threads":    float64(p.NumThreads),
+	}, nil
+}
+
+// readSystemResource is the resources/read handler for every system:// resource.
+func readSystemResource(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	uri := req.Params.URI
+	read, ok := lookupResource(uri)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	doc, _, err := read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{
+		{URI: uri, MIMEType: "application/json", Text: string(data)},
+	}}, nil
+}
+
+// registerResources publishes system state as resources. They are read
+// with the same collectors as the get_* tools.
+func registerResources(server *mcp.Server) {
+	for _, r := range []*mcp.Resource{
+		{URI: resourceCPU, Name: "cpu", Description: "Total CPU usage over the default sampling window and CPU details, as get_cpu_info"},
+		{URI: resourceMemory, Name: "memory", Description: "RAM and swap usage, as get_memory_info"},
+		{URI: resourceLoad, Name: "load", Description: "1, 5 and 15 minute load averages, as get_load_average"},
+		{URI: resourceDisks, Name: "disks", Description: "Usage of every mounted filesystem, as get_disk_info"},
+	} {
+		r.MIMEType = "application/json"
+		server.AddResource(r, readSystemResource)
+	}
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: diskResourceURI,
+		Name:        "disk",
+		Description: "Usage of one mounted filesystem; the mount point is percent-encoded, e.g. system://disks/%2Fvar for /var",
+		MIMEType:    "application/json",
+	}, readSystemResource)
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		URITemplate: procResourceURI,
+		Name:        "process",
+		Description: "One process: CPU over the default sampling window, memory, threads and command line, as get_process_info",
+		MIMEType:    "application/json",
+	}, readSystemResource)
+	registerAlertsResource(server)
+}
+
+// --- Subscriptions ---
+
+// resourceWatcher re-reads subscribed resources every poll interval and
+// sends notifications/resources/updated when one of their watched values
+// moved by at least minChange since the last notification. Values are
+// percentages (percentage points of change) except load and thread counts.
+type resourceWatcher struct {
+	interval  time.Duration
+	minChange float64
+
+	mu      sync.Mutex
+	watches map[string]*resourceWatch // by URI
+}
+
+type resourceWatch struct {
+	read     resourceReader
+	sessions map[*mcp.ServerSession]bool
+	last     map[string]float64 // values at the last notification
+	gone     bool               // the last read failed
+}
+
+func newResourceWatcher(cfg ResourcesConfig) *resourceWatcher {
+	return &resourceWatcher{
+		interval:  time.Duration(cfg.PollIntervalMs) * time.Millisecond,
+		minChange: cfg.MinChange,
+		watches:   make(map[string]*resourceWatch),
+	}
+}
+
+// serverOptions returns server options that route resources/subscribe and
+// resources/unsubscribe to w.
+func (w *resourceWatcher) serverOptions() *mcp.ServerOptions {
+	return &mcp.ServerOptions{SubscribeHandler: w.subscribe, UnsubscribeHandler: w.unsubscribe}
+}
+
+// subscribe reads the resource once, both to check that it exists and to
+// take the values later reads are compared with. The alerts resource is
+// accepted as well; the Alerter notifies its subscribers.
+func (w *resourceWatcher) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	uri := req.Params.URI
+	if uri == AlertsResourceURI {
+		return nil
+	}
+	read, ok := lookupResource(uri)
+	if !ok {
+		return mcp.ResourceNotFoundError(uri)
+	}
+
+	w.mu.Lock()
+	if wt, ok := w.watches[uri]; ok {
+		wt.sessions[req.Session] = true
+		w.mu.Unlock()
+		return nil
+	}
+	w.mu.Unlock()
+
+	_, values, err := read(ctx)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wt, ok := w.watches[uri]
+	if !ok {
+		wt = &resourceWatch{read: read, sessions: make(map[*mcp.ServerSession]bool), last: values}
+		w.watches[uri] = wt
+	}
+	wt.sessions[req.Session] = true
+	return nil
+}
+
+func (w *resourceWatcher) unsubscribe(_ context.Context, req *mcp.UnsubscribeRequest) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if wt, ok := w.watches[req.Params.URI]; ok {
+		delete(wt.sessions, req.Session)
+		if len(wt.sessions) == 0 {
+			delete(w.watches, req.Params.URI)
+		}
+	}
+	return nil
+}
+
+// Run polls the subscribed resources until ctx is done.
+func (w *resourceWatcher) Run(ctx context.Context, server *mcp.Server) {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			w.poll(ctx, server)
+		}
+	}
+}
+
+// poll re-reads every watched resource once. Watches of sessions that have
+// gone away without unsubscribing are dropped first.
+func (w *resourceWatcher) poll(ctx context.Context, server *mcp.Server) {
+	live := make(map[*mcp.ServerSession]bool)
+	for ss := range server.Sessions() {
+		live[ss] = true
+	}
+	w.mu.Lock()
+	watches := make(map[string]*resourceWatch, len(w.watches))
+	for uri, wt := range w.watches {
+		for ss := range wt.sessions {
+			if !live[ss] {
+				delete(wt.sessions, ss)
+			}
+		}
+		if len(wt.sessions) == 0 {
+			delete(w.watches, uri)
+			continue
+		}
+		watches[uri] = wt
+	}
+	w.mu.Unlock()
+
+	for uri, wt := range watches {
+		_, values, err := wt.read(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		w.mu.Lock()
+		changed := false
+		switch {
+		case err != nil:
+			// Report a resource disappearing (a process exiting, a
+			// filesystem being unmounted) once.
+			changed = !wt.gone
+			wt.gone = true
+		case wt.gone || valuesChanged(wt.last, values, w.minChange):
+			changed = true
+			wt.gone = false
+			wt.last = values
+		}
+		w.mu.Unlock()
+		if changed {
+			server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: uri})
+		}
+	}
+}
+
+// valuesChanged reports whether a value appeared, disappeared or moved by
+// at least minChange.
+func valuesChanged(old, cur map[string]float64, minChange float64) bool {
+	if len(old) != len(cur) {
+		return true
+	}
+	for k, v := range cur {
+		prev, ok := old[k]
+		if !ok {
+			return true
+		}
+		if d := math.Abs(v - prev); d > 0 && d >= minChange {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupResource(t *testing.T) {
+	for _, uri := range []string{resourceCPU, resourceMemory, resourceLoad, resourceDisks, "system://disks/%2F", "system://disks/%2Fvar%2Flib", "system://process/1"} {
+		_, ok := lookupResource(uri)
+		assert.True(t, ok, uri)
+	}
+	for _, uri := range []string{"system://disks/", "system://disks/%zz", "system://process/abc", "system://process/0", "system://process/99999999999", "system://swap", "file:///etc/passwd"} {
+		_, ok := lookupResource(uri)
+		assert.False(t, ok, uri)
+	}
+}
+
+func TestValuesChanged(t *testing.T) {
+	old := map[string]float64{"a": 10, "b": 1}
+	assert.False(t, valuesChanged(old, map[string]float64{"a": 10.5, "b": 1}, 1))
+	assert.True(t, valuesChanged(old, map[string]float64{"a": 11, "b": 1}, 1))
+	assert.True(t, valuesChanged(old, map[string]float64{"a": 9, "b": 1}, 1), "drops count as well")
+	assert.True(t, valuesChanged(old, map[string]float64{"a": 10}, 1), "a value went away")
+	assert.True(t, valuesChanged(old, map[string]float64{"a": 10, "c": 1}, 1))
+	assert.False(t, valuesChanged(old, map[string]float64{"a": 10, "b": 1}, 0))
+	assert.True(t, valuesChanged(old, map[string]float64{"a": 10.01, "b": 1}, 0))
+}
+
+// connectResources serves the resources over an in-memory transport and
+// returns a client session whose update notifications arrive on updates.
+func connectResources(t *testing.T, w *resourceWatcher) (*mcp.Server, *mcp.ClientSession, chan string) {
+	t.Helper()
+	ctx := context.Background()
+	server := mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, w.serverOptions())
+	registerResources(server)
+
+	updates := make(chan string, 10)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.0.1"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) { updates <- req.Params.URI },
+	})
+	st, ct := mcp.NewInMemoryTransports()
+	_, err := server.Connect(ctx, st, nil)
+	require.NoError(t, err)
+	session, err := client.Connect(ctx, ct, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { session.Close() })
+	return server, session, updates
+}
+
+func TestReadResources(t *testing.T) {
+	_, session, _ := connectResources(t, newResourceWatcher(DefaultResourcesConfig()))
+	ctx := context.Background()
+
+	res, err := session.ListResources(ctx, nil)
+	require.NoError(t, err)
+	var uris []string
+	for _, r := range res.Resources {
+		uris = append(uris, r.URI)
+	}
+	assert.ElementsMatch(t, []string{resourceCPU, resourceMemory, resourceLoad, resourceDisks, AlertsResourceURI}, uris)
+	tmpls, err := session.ListResourceTemplates(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, tmpls.ResourceTemplates, 2)
+
+	read := func(uri string, v any) error {
+		res, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+		if err != nil {
+			return err
+		}
+		require.Len(t, res.Contents, 1)
+		assert.Equal(t, "application/json", res.Contents[0].MIMEType)
+		return json.Unmarshal([]byte(res.Contents[0].Text), v)
+	}
+
+	var mem MemoryInfo
+	require.NoError(t, read(resourceMemory, &mem))
+	assert.Greater(t, mem.Total, uint64(0))
+
+	disks, err := getDiskInfo(ctx, "")
+	require.NoError(t, err)
+	if len(disks.Disks) > 0 {
+		mount := disks.Disks[0].Mountpoint
+		var d DiskInfo
+		require.NoError(t, read("system://disks/"+strings.ReplaceAll(url.PathEscape(mount), "/", "%2F"), &d))
+		assert.Equal(t, mount, d.Mountpoint)
+	}
+	assert.Error(t, read("system://disks/%2Fno%2Fsuch%2Fmount", &DiskInfo{}))
+
+	var p ProcessInfo
+	require.NoError(t, read("system://process/"+strconv.Itoa(os.Getpid()), &p))
+	assert.Equal(t, int32(os.Getpid()), p.PID)
+	assert.Error(t, read("system://process/2147483646", &ProcessInfo{}))
+}
+
+func TestResourceSubscriptions(t *testing.T) {
+	w := newResourceWatcher(ResourcesConfig{PollIntervalMs: 100, MinChange: 1e9})
+	server, session, updates := connectResources(t, w)
+	ctx := context.Background()
+
+	require.NoError(t, session.Subscribe(ctx, &mcp.SubscribeParams{URI: resourceLoad}))
+	assert.Error(t, session.Subscribe(ctx, &mcp.SubscribeParams{URI: "system://process/2147483646"}), "missing processes cannot be watched")
+	assert.Error(t, session.Subscribe(ctx, &mcp.SubscribeParams{URI: "system://nope"}))
+	require.Contains(t, w.watches, resourceLoad)
+
+	w.poll(ctx, server)
+	assert.Empty(t, updates, "load did not move by min_change")
+
+	// Pretend the load was very different when the client subscribed.
+	w.watches[resourceLoad].last = map[string]float64{"load1": -1e10, "load5": 0, "load15": 0}
+	w.poll(ctx, server)
+	select {
+	case uri := <-updates:
+		assert.Equal(t, resourceLoad, uri)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no resource update")
+	}
+	w.poll(ctx, server)
+	assert.Empty(t, updates, "the new values are the baseline")
+
+	require.NoError(t, session.Unsubscribe(ctx, &mcp.UnsubscribeParams{URI: resourceLoad}))
+	assert.Empty(t, w.watches)
+
+	// Watches of sessions that close without unsubscribing are dropped.
+	require.NoError(t, session.Subscribe(ctx, &mcp.SubscribeParams{URI: resourceMemory}))
+	session.Close()
+	require.Eventually(t, func() bool {
+		w.poll(ctx, server)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.watches) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestResourcesConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultResourcesConfig().validate())
+	_, err := parseConfig([]byte("resources:\n  poll_interval_ms: 10\n"))
+	assert.Error(t, err)
+	_, err = parseConfig([]byte("resources:\n  min_change: -1\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// --- Background metric sampler ---
+
+// SamplerConfig controls the background collector behind get_metric_history.
+type SamplerConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	IntervalMs  int  `yaml:"interval_ms"`  // time between samples
+	HistorySize int  `yaml:"history_size"` // samples kept per metric
+}
+
+func DefaultSamplerConfig() SamplerConfig {
+	return SamplerConfig{Enabled: true, IntervalMs: 10000, HistorySize: 360} // one hour
+}
+
+func (c SamplerConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.IntervalMs < 100 {
+		return fmt.Errorf("sampler.interval_ms must be at least 100, got %d", c.IntervalMs)
+	}
+	if c.HistorySize < 1 || c.HistorySize > 1000000 {
+		return fmt.Errorf("sampler.history_size must be within 1..1000000, got %d", c.HistorySize)
+	}
+	return nil
+}
+
+// MetricPoint is one value of a metric. When history is downsampled, Value
+// is the mean of the bucket and Min/Max its extremes.
+type MetricPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+}
+
+// ring is a fixed-size circular buffer of points in time order.
+type ring struct {
+	points []MetricPoint
+	start  int // index of the oldest point
+	n      int
+	missed int // samples in a row that had no value for this metric
+}
+
+func newRing(size int) *ring {
+	return &ring{points: make([]MetricPoint, size)}
+}
+
+func (r *ring) push(p MetricPoint) {
+	if r.n < len(r.points) {
+		r.points[(r.start+r.n)%len(r.points)] = p
+		r.n++
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+func (r *ring) at(i int) MetricPoint {
+	return r.points[(r.start+i)%len(r.points)]
+}
+
+func (r *ring) last() (MetricPoint, bool) {
+	if r.n == 0 {
+		return MetricPoint{}, false
+	}
+	return r.at(r.n - 1), true
+}
+
+// between returns the points with from <= Time <= to, oldest first.
+func (r *ring) between(from, to time.Time) []MetricPoint {
+	var out []MetricPoint
+	for i := 0; i < r.n; i++ {
+		p := r.at(i)
+		if p.Time.Before(from) || p.Time.After(to) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// Sampler periodically records CPU, memory, load, disk and network metrics
+// into one ring buffer per metric. Metric names are dotted paths such as
+// "cpu.usage_percent", "disk./var.used_percent" or "net.eth0.bytes_recv".
+// A metric that goes a full history's worth of samples without a value,
+// such as one for a removed interface or unmounted filesystem, is dropped.
+type Sampler struct {
+	interval time.Duration
+	size     int
+
+	mu     sync.RWMutex
+	series map[string]*ring
+
+	listeners []func(time.Time, map[string]float64)
+}
+
+func NewSampler(cfg SamplerConfig) *Sampler {
+	return &Sampler{
+		interval: time.Duration(cfg.IntervalMs) * time.Millisecond,
+		size:     cfg.HistorySize,
+		series:   make(map[string]*ring),
+	}
+}
+
+// OnSample registers fn to be called with every sample after it has been
+// recorded. It must be called before Run.
+func (s *Sampler) OnSample(fn func(t time.Time, values map[string]float64)) {
+	s.listeners = append(s.listeners, fn)
+}
+
+// sampler is the running Sampler, or nil when sampling is disabled.
+var sampler *Sampler
+
+// Run samples immediately and then every interval until ctx is done.
+func (s *Sampler) Run(ctx context.Context) {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		s.collect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// collect takes one sample of every metric. Collectors that fail are
+// skipped so one broken source does not stop the others.
+func (s *Sampler) collect(ctx context.Context) {
+	now := time.Now()
+	values := make(map[string]float64)
+
+	// With a zero interval gopsutil reports usage since the previous call,
+	// i.e. over the last sampling period, without blocking.
+	if usage, err := cpu.PercentWithContext(ctx, 0, false); err == nil && len(usage) > 0 {
+		values["cpu.usage_percent"] = usage[0]
+	}
+	if m, err := getMemoryInfo(ctx); err == nil {
+		values["memory.used_percent"] = m.UsedPercent
+		values["memory.used_bytes"] = float64(m.Used)
+		values["memory.available_bytes"] = float64(m.Available)
+		values["memory.swap_used_bytes"] = float64(m.SwapUsed)
+	}
+	if l, err := getLoadAverage(ctx); err == nil {
+		values["load.load1"] = l.Load1
+		values["load.load5"] = l.Load5
+		values["load.load15"] = l.Load15
+	}
+	if d, err := getDiskInfo(ctx, ""); err == nil {
+		for _, disk := range d.Disks {
+			prefix := "disk." + disk.Mountpoint + "."
+			values[prefix+"used_percent"] = disk.UsedPercent
+			values[prefix+"used_bytes"] = float64(disk.Used)
+			if disk.InodesTotal > 0 {
+				values[prefix+"inodes_used_percent"] = float64(disk.InodesUsed) / float64(disk.InodesTotal) * 100
+			}
+		}
+	}
+	if n, err := readNetworkCounters(ctx, ""); err == nil {
+		for _, iface := range n {
+			prefix := "net." + iface.Interface + "."
+			values[prefix+"bytes_sent"] = float64(iface.BytesSent)
+			values[prefix+"bytes_recv"] = float64(iface.BytesRecv)
+			values[prefix+"packets_sent"] = float64(iface.PacketsSent)
+			values[prefix+"packets_recv"] = float64(iface.PacketsRecv)
+			values[prefix+"errors_in"] = float64(iface.Errin)
+			values[prefix+"errors_out"] = float64(iface.Errout)
+			values[prefix+"drops_in"] = float64(iface.Dropin)
+			values[prefix+"drops_out"] = float64(iface.Dropout)
+		}
+	}
+
+	s.record(now, values)
+	for _, fn := range s.listeners {
+		fn(now, values)
+	}
+}
+
+func (s *Sampler) record(t time.Time, values map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, v := range values {
+		r, ok := s.series[name]
+		if !ok {
+			r = newRing(s.size)
+			s.series[name] = r
+		}
+		r.push(MetricPoint{Time: t, Value: v, Min: v, Max: v})
+		r.missed = 0
+	}
+	for name, r := range s.series {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		r.missed++
+		if r.missed >= s.size {
+			delete(s.series, name)
+		}
+	}
+}
+
+// Latest returns the most recent point of a metric.
+func (s *Sampler) Latest(name string) (MetricPoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.series[name]
+	if !ok {
+		return MetricPoint{}, false
+	}
+	return r.last()
+}
+
+// LatestBefore returns the newest point of a metric taken at or before t.
+func (s *Sampler) LatestBefore(name string, t time.Time) (MetricPoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.series[name]
+	if !ok {
+		return MetricPoint{}, false
+	}
+	for i := r.n - 1; i >= 0; i-- {
+		if p := r.at(i); !p.Time.After(t) {
+			return p, true
+		}
+	}
+	return MetricPoint{}, false
+}
+
+// Metrics returns the sorted names of all recorded metrics.
+func (s *Sampler) Metrics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.series))
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// History returns the points of every metric matching one of selectors
+// (exact names or dotted prefixes such as "disk" or "net.eth0"; all metrics
+// if empty) between from and to, averaged into buckets of step when step > 0.
+func (s *Sampler) History(selectors []string, from, to time.Time, step time.Duration) []MetricSeries {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []MetricSeries
+	for name, r := range s.series {
+		if !matchesMetric(name, selectors) {
+			continue
+		}
+		points := r.between(from, to)
+		if step > 0 {
+			points = downsample(points, from, step)
+		}
+		out = append(out, MetricSeries{Name: name, Points: points})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func matchesMetric(name string, selectors []string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, sel := range selectors {
+		if name == sel || strings.HasPrefix(name, strings.TrimSuffix(sel, ".")+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// downsample merges points into consecutive buckets of width step starting
+// at origin. Each bucket is stamped with its start time.
+func downsample(points []MetricPoint, origin time.Time, step time.Duration) []MetricPoint {
+	var out []MetricPoint
+	var sum float64
+	var count int
+	var cur MetricPoint
+	flush := func() {
+		if count > 0 {
+			cur.Value = sum / float64(count)
+			out = append(out, cur)
+		}
+	}
+	bucket := int64(-1)
+	for _, p := range points {
+		b := int64(p.Time.Sub(origin) / step)
+		if b != bucket {
+			flush()
+			bucket = b
+			cur = MetricPoint{Time: origin.Add(time.Duration(b) * step), Min: math.Inf(1), Max: math.Inf(-1)}
+			sum, count = 0, 0
+		}
+		sum += p.Value
+		count++
+		cur.Min = math.Min(cur.Min, p.Min)
+		cur.Max = math.Max(cur.Max, p.Max)
+	}
+	flush()
+	return out
+}
+
+// --- get_metric_history ---
+
+type MetricSeries struct {
+	Name   string        `json:"name"`
+	Points []MetricPoint `json:"points"`
+}
+
+type MetricHistoryResult struct {
+	Start            time.Time      `json:"start"`
+	End              time.Time      `json:"end"`
+	SampleIntervalMs int64          `json:"sample_interval_ms"`
+	StepSeconds      float64        `json:"step_seconds,omitempty"` // bucket width when downsampled
+	Series           []MetricSeries `json:"series"`
+	Available        []string       `json:"available_metrics,omitempty"` // listed when nothing matched
+}
+
+type MetricHistoryArgs struct {
+	Metrics     []string `json:"metrics,omitempty"`      // metric names or prefixes (cpu, memory, load, disk, net); all if empty
+	LastSeconds int      `json:"last_seconds,omitempty"` // look back this far from now, default 600
+	Start       string   `json:"start,omitempty"`        // RFC 3339 start time; overrides last_seconds
+	End         string   `json:"end,omitempty"`          // RFC 3339 end time, default now
+	StepSeconds int      `json:"step_seconds,omitempty"` // average into buckets of this width
+	MaxPoints   int      `json:"max_points,omitempty"`   // downsample to at most this many points per metric (default 120)
+}
+
+func getMetricHistory(s *Sampler, a MetricHistoryArgs) (MetricHistoryResult, error) {
+	if s == nil {
+		return MetricHistoryResult{}, fmt.Errorf("metric history is unavailable: the background sampler is disabled")
+	}
+
+	end := time.Now()
+	if a.End != "" {
+		t, err := time.Parse(time.RFC3339, a.End)
+		if err != nil {
+			return MetricHistoryResult{}, fmt.Errorf("invalid end time: %w", err)
+		}
+		end = t
+	}
+	lookback := 600 * time.Second
+	if a.LastSeconds > 0 {
+		lookback = time.Duration(a.LastSeconds) * time.Second
+	}
+	start := end.Add(-lookback)
+	if a.Start != "" {
+		t, err := time.Parse(time.RFC3339, a.Start)
+		if err != nil {
+			return MetricHistoryResult{}, fmt.Errorf("invalid start time: %w", err)
+		}
+		start = t
+	}
+	if !start.Before(end) {
+		return MetricHistoryResult{}, fmt.Errorf("start %s is not before end %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+
+	maxPoints := a.MaxPoints
+	if maxPoints <= 0 {
+		maxPoints = 120
+	}
+	step := time.Duration(a.StepSeconds) * time.Second
+	if step == 0 && end.Sub(start)/s.interval > time.Duration(maxPoints) {
+		step = (end.Sub(start) + time.Duration(maxPoints) - 1) / time.Duration(maxPoints)
+		step = step.Round(time.Second)
+		if step < time.Second {
+			step = time.Second
+		}
+	}
+
+	out := MetricHistoryResult{
+		Start:            start,
+		End:              end,
+		SampleIntervalMs: s.interval.Milliseconds(),
+		StepSeconds:      step.Seconds(),
+		Series:           s.History(a.Metrics, start, end, step),
+	}
+	if len(out.Series) == 0 {
+		out.Available = s.Metrics()
+	}
+	return out, nil
+}
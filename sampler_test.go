@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	r := newRing(3)
+	_, ok := r.last()
+	assert.False(t, ok)
+
+	base := time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		r.push(MetricPoint{Time: base.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	last, ok := r.last()
+	require.True(t, ok)
+	assert.Equal(t, float64(4), last.Value)
+
+	all := r.between(base, base.Add(time.Hour))
+	require.Len(t, all, 3)
+	assert.Equal(t, []float64{2, 3, 4}, []float64{all[0].Value, all[1].Value, all[2].Value})
+
+	some := r.between(base.Add(3*time.Second), base.Add(3*time.Second))
+	require.Len(t, some, 1)
+	assert.Equal(t, float64(3), some[0].Value)
+}
+
+func TestDownsample(t *testing.T) {
+	base := time.Unix(1000, 0)
+	var points []MetricPoint
+	for i, v := range []float64{1, 3, 10, 20, 7} {
+		points = append(points, MetricPoint{Time: base.Add(time.Duration(i) * time.Second), Value: v, Min: v, Max: v})
+	}
+
+	out := downsample(points, base, 2*time.Second)
+	require.Len(t, out, 3)
+	assert.Equal(t, MetricPoint{Time: base, Value: 2, Min: 1, Max: 3}, out[0])
+	assert.Equal(t, MetricPoint{Time: base.Add(2 * time.Second), Value: 15, Min: 10, Max: 20}, out[1])
+	assert.Equal(t, MetricPoint{Time: base.Add(4 * time.Second), Value: 7, Min: 7, Max: 7}, out[2])
+}
+
+func TestMatchesMetric(t *testing.T) {
+	assert.True(t, matchesMetric("cpu.usage_percent", nil))
+	assert.True(t, matchesMetric("cpu.usage_percent", []string{"cpu"}))
+	assert.True(t, matchesMetric("disk./var.used_percent", []string{"disk./var"}))
+	assert.True(t, matchesMetric("memory.used_percent", []string{"memory.used_percent"}))
+	assert.False(t, matchesMetric("memory.used_percent", []string{"mem"}))
+	assert.False(t, matchesMetric("net.eth0.bytes_recv", []string{"net.eth"}))
+}
+
+func TestSamplerCollect(t *testing.T) {
+	s := NewSampler(SamplerConfig{Enabled: true, IntervalMs: 100, HistorySize: 10})
+	s.collect(context.Background())
+
+	names := s.Metrics()
+	assert.Contains(t, names, "cpu.usage_percent")
+	assert.Contains(t, names, "memory.used_percent")
+	assert.Contains(t, names, "load.load1")
+
+	p, ok := s.Latest("memory.used_percent")
+	require.True(t, ok)
+	assert.Greater(t, p.Value, float64(0))
+	assert.LessOrEqual(t, p.Value, float64(100))
+}
+
+func TestSamplerRun(t *testing.T) {
+	s := NewSampler(SamplerConfig{Enabled: true, IntervalMs: 100, HistorySize: 10})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		h := s.History([]string{"load.load1"}, time.Now().Add(-time.Minute), time.Now(), 0)
+		return len(h) == 1 && len(h[0].Points) >= 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sampler did not stop")
+	}
+}
+
+func TestSamplerEvictsVanishedSeries(t *testing.T) {
+	s := NewSampler(SamplerConfig{Enabled: true, IntervalMs: 1000, HistorySize: 3})
+	base := time.Unix(1000, 0)
+	sample := func(i int, values map[string]float64) {
+		s.record(base.Add(time.Duration(i)*time.Second), values)
+	}
+
+	sample(0, map[string]float64{"net.eth0.bytes_recv": 10, "net.veth1.bytes_recv": 20})
+	sample(1, map[string]float64{"net.eth0.bytes_recv": 11, "net.veth1.bytes_recv": 21})
+
+	// veth1 goes away; its history stays queryable for a while.
+	sample(2, map[string]float64{"net.eth0.bytes_recv": 12})
+	sample(3, map[string]float64{"net.eth0.bytes_recv": 13})
+	assert.Equal(t, []string{"net.eth0.bytes_recv", "net.veth1.bytes_recv"}, s.Metrics())
+	p, ok := s.Latest("net.veth1.bytes_recv")
+	require.True(t, ok)
+	assert.Equal(t, float64(21), p.Value)
+
+	sample(4, map[string]float64{"net.eth0.bytes_recv": 14})
+	assert.Equal(t, []string{"net.eth0.bytes_recv"}, s.Metrics())
+	_, ok = s.Latest("net.veth1.bytes_recv")
+	assert.False(t, ok)
+
+	// An interface that comes back after a gap keeps its series.
+	sample(5, map[string]float64{"net.eth0.bytes_recv": 15, "net.veth1.bytes_recv": 30})
+	sample(6, map[string]float64{"net.veth1.bytes_recv": 31})
+	sample(7, map[string]float64{"net.veth1.bytes_recv": 32})
+	sample(8, map[string]float64{"net.eth0.bytes_recv": 16, "net.veth1.bytes_recv": 33})
+	assert.Equal(t, []string{"net.eth0.bytes_recv", "net.veth1.bytes_recv"}, s.Metrics())
+}
+
+func TestGetMetricHistory(t *testing.T) {
+	s := NewSampler(SamplerConfig{Enabled: true, IntervalMs: 1000, HistorySize: 1000})
+	now := time.Now()
+	for i := 0; i < 600; i++ {
+		s.record(now.Add(time.Duration(i-600)*time.Second), map[string]float64{
+			"memory.used_percent": float64(i % 100),
+			"cpu.usage_percent":   50,
+		})
+	}
+
+	t.Run("disabled sampler", func(t *testing.T) {
+		_, err := getMetricHistory(nil, MetricHistoryArgs{})
+		assert.Error(t, err)
+	})
+
+	t.Run("auto downsampling", func(t *testing.T) {
+		out, err := getMetricHistory(s, MetricHistoryArgs{Metrics: []string{"memory"}})
+		require.NoError(t, err)
+		require.Len(t, out.Series, 1)
+		assert.Equal(t, "memory.used_percent", out.Series[0].Name)
+		assert.LessOrEqual(t, len(out.Series[0].Points), 121)
+		assert.Equal(t, float64(5), out.StepSeconds)
+	})
+
+	t.Run("explicit step and range", func(t *testing.T) {
+		out, err := getMetricHistory(s, MetricHistoryArgs{
+			Metrics:     []string{"cpu.usage_percent"},
+			LastSeconds: 60,
+			StepSeconds: 30,
+		})
+		require.NoError(t, err)
+		require.Len(t, out.Series, 1)
+		assert.LessOrEqual(t, len(out.Series[0].Points), 3)
+		for _, p := range out.Series[0].Points {
+			assert.Equal(t, float64(50), p.Value)
+		}
+	})
+
+	t.Run("raw points", func(t *testing.T) {
+		out, err := getMetricHistory(s, MetricHistoryArgs{Metrics: []string{"cpu"}, LastSeconds: 10})
+		require.NoError(t, err)
+		require.Len(t, out.Series, 1)
+		assert.Zero(t, out.StepSeconds)
+		assert.InDelta(t, 10, len(out.Series[0].Points), 1) // edges depend on when "now" is taken
+	})
+
+	t.Run("unknown metric lists available", func(t *testing.T) {
+		out, err := getMetricHistory(s, MetricHistoryArgs{Metrics: []string{"gpu"}})
+		require.NoError(t, err)
+		assert.Empty(t, out.Series)
+		assert.Equal(t, []string{"cpu.usage_percent", "memory.used_percent"}, out.Available)
+	})
+
+	t.Run("bad times", func(t *testing.T) {
+		_, err := getMetricHistory(s, MetricHistoryArgs{Start: "yesterday"})
+		assert.Error(t, err)
+		_, err = getMetricHistory(s, MetricHistoryArgs{
+			Start: now.Format(time.RFC3339),
+			End:   now.Add(-time.Hour).Format(time.RFC3339),
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestSamplerConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultSamplerConfig().validate())
+	assert.NoError(t, SamplerConfig{Enabled: false}.validate())
+	assert.Error(t, SamplerConfig{Enabled: true, IntervalMs: 10, HistorySize: 10}.validate())
+	assert.Error(t, SamplerConfig{Enabled: true, IntervalMs: 1000, HistorySize: 0}.validate())
+}
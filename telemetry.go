@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// --- OpenTelemetry instrumentation of tool calls ---
+
+// TelemetryConfig enables a trace span and metrics for every tool call,
+// exported in the OpenTelemetry protocol (OTLP over HTTP) or printed as
+// JSON for local debugging.
+type TelemetryConfig struct {
+	Exporter         string            `yaml:"exporter"`           // otlp|stdout; empty disables telemetry
+	Endpoint         string            `yaml:"endpoint"`           // OTLP/HTTP base URL; /v1/traces and /v1/metrics are appended
+	Headers          map[string]string `yaml:"headers"`            // sent with every OTLP request, e.g. an API key
+	ServiceName      string            `yaml:"service_name"`       // service.name resource attribute
+	ExportIntervalMs int               `yaml:"export_interval_ms"` // how often spans and metrics are sent
+}
+
+const (
+	TelemetryOTLP   = "otlp"
+	TelemetryStdout = "stdout"
+
+	DefaultOTLPEndpoint = "http://localhost:4318"
+
+	// maxPendingSpans bounds the spans buffered between exports; more are dropped.
+	maxPendingSpans = 2048
+	// maxArgSummary bounds the argument summary attached to a span.
+	maxArgSummary = 256
+)
+
+func DefaultTelemetryConfig() TelemetryConfig {
+	return TelemetryConfig{Endpoint: DefaultOTLPEndpoint, ServiceName: ServerName, ExportIntervalMs: 10000}
+}
+
+func (c TelemetryConfig) validate() error {
+	switch c.Exporter {
+	case "":
+		return nil
+	case TelemetryOTLP:
+		u, err := url.Parse(c.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("telemetry.endpoint must be an http(s) URL, got %q", c.Endpoint)
+		}
+	case TelemetryStdout:
+	default:
+		return fmt.Errorf("telemetry.exporter %q is invalid (want otlp or stdout)", c.Exporter)
+	}
+	if c.ExportIntervalMs < 100 {
+		return fmt.Errorf("telemetry.export_interval_ms must be at least 100, got %d", c.ExportIntervalMs)
+	}
+	if c.ServiceName == "" {
+		return fmt.Errorf("telemetry.service_name must not be empty")
+	}
+	return nil
+}
+
+// durationBounds are the upper bounds, in seconds, of the tool duration
+// histogram buckets.
+var durationBounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Telemetry holds the tracer and meter providers that tool calls are
+// recorded with.
+type Telemetry struct {
+	tracerProvider *sdktrace.TracerProvider
+	meterProvider  *sdkmetric.MeterProvider
+
+	tracer   trace.Tracer
+	calls    metric.Int64Counter
+	errors   metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// telemetry is the active Telemetry, or nil when it is disabled.
+var telemetry *Telemetry
+
+// NewTelemetry returns a Telemetry exporting as cfg says. stdout is where
+// the stdout exporter writes; main passes stderr when MCP itself is spoken
+// over stdout.
+func NewTelemetry(cfg TelemetryConfig, stdout io.Writer) (*Telemetry, error) {
+	var spans sdktrace.SpanExporter
+	var metrics sdkmetric.Exporter
+	var err error
+	switch cfg.Exporter {
+	case TelemetryOTLP:
+		base := strings.TrimSuffix(cfg.Endpoint, "/")
+		ctx := context.Background() // the HTTP exporters do not connect until the first export
+		spans, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(base+"/v1/traces"), otlptracehttp.WithHeaders(cfg.Headers))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		metrics, err = otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(base+"/v1/metrics"), otlpmetrichttp.WithHeaders(cfg.Headers))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+		}
+	default:
+		if spans, err = stdouttrace.New(stdouttrace.WithWriter(stdout)); err != nil {
+			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+		if metrics, err = stdoutmetric.New(stdoutmetric.WithWriter(stdout)); err != nil {
+			return nil, fmt.Errorf("failed to create stdout metric exporter: %w", err)
+		}
+	}
+	interval := time.Duration(cfg.ExportIntervalMs) * time.Millisecond
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("Telemetry export failed", "error", err)
+	}))
+	return newTelemetry(cfg,
+		sdktrace.NewBatchSpanProcessor(spans, sdktrace.WithBatchTimeout(interval), sdktrace.WithMaxQueueSize(maxPendingSpans)),
+		sdkmetric.NewPeriodicReader(metrics, sdkmetric.WithInterval(interval)))
+}
+
+// newTelemetry builds the providers around a span processor and a metric
+// reader; tests pass in-memory ones.
+func newTelemetry(cfg TelemetryConfig, spans sdktrace.SpanProcessor, metrics sdkmetric.Reader) (*Telemetry, error) {
+	res := resource.NewSchemaless(
+		attribute.String("service.name", cfg.ServiceName),
+		attribute.String("service.version", Version),
+	)
+	t := &Telemetry{
+		tracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans), sdktrace.WithResource(res)),
+		meterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics), sdkmetric.WithResource(res)),
+	}
+	t.tracer = t.tracerProvider.Tracer(ServerName, trace.WithInstrumentationVersion(Version))
+	meter := t.meterProvider.Meter(ServerName, metric.WithInstrumentationVersion(Version))
+	var err error
+	if t.calls, err = meter.Int64Counter("mcp.tool.calls", metric.WithDescription("Tool calls handled."), metric.WithUnit("{call}")); err != nil {
+		return nil, err
+	}
+	if t.errors, err = meter.Int64Counter("mcp.tool.errors", metric.WithDescription("Tool calls that returned an error."), metric.WithUnit("{call}")); err != nil {
+		return nil, err
+	}
+	if t.duration, err = meter.Float64Histogram("mcp.tool.duration", metric.WithDescription("Time taken by tool calls."), metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBounds...)); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Run waits until ctx is done, then flushes and stops the exporters. The
+// providers export on their own every export_interval_ms until then.
+func (t *Telemetry) Run(ctx context.Context) {
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t.tracerProvider.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Telemetry span export failed", "error", err)
+	}
+	if err := t.meterProvider.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Telemetry metrics export failed", "error", err)
+	}
+}
+
+// instrumentTool wraps a tool handler so each call is recorded as a span
+// with the tool name, session, a redacted argument summary, latency and
+// error, and counted in the tool metrics.
+func instrumentTool[In any](name string, h mcp.ToolHandlerFor[In, any]) mcp.ToolHandlerFor[In, any] {
+	return func(ctx context.Context, req *mcp.CallToolRequest, in In) (*mcp.CallToolResult, any, error) {
+		t := telemetry
+		if t == nil {
+			return h(ctx, req, in)
+		}
+		attrs := []attribute.KeyValue{
+			attribute.String("mcp.method.name", "tools/call"),
+			attribute.String("gen_ai.tool.name", name),
+			attribute.String("mcp.tool.arguments", argSummary(in)),
+		}
+		if req != nil && req.Session != nil {
+			attrs = append(attrs, attribute.String("mcp.session.id", req.Session.ID()))
+		}
+		start := time.Now()
+		ctx, span := t.tracer.Start(ctx, "tools/call "+name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+		res, out, err := h(ctx, req, in)
+		tool := metric.WithAttributes(attribute.String("gen_ai.tool.name", name))
+		if err != nil {
+			span.SetAttributes(attribute.String("error.type", "tool_error"))
+			span.SetStatus(codes.Error, err.Error())
+			t.errors.Add(ctx, 1, tool)
+		} else {
+			span.SetStatus(codes.Ok, "")
+		}
+		span.End()
+		t.calls.Add(ctx, 1, tool)
+		t.duration.Record(ctx, time.Since(start).Seconds(), tool)
+		return res, out, err
+	}
+}
+
+// argSummary renders tool arguments as compact JSON, passed through the
+// redaction rules and cut to maxArgSummary bytes.
+func argSummary(in any) string {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return ""
+	}
+	s, _ := redactor.String(string(data))
+	if len(s) > maxArgSummary {
+		n := maxArgSummary
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n] + "..."
+	}
+	return s
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func attrMap(attrs []attribute.KeyValue) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		m[string(a.Key)] = a.Value.Emit()
+	}
+	return m
+}
+
+// withTelemetry installs t as the active Telemetry for the test.
+func withTelemetry(t *testing.T, tel *Telemetry) {
+	saved := telemetry
+	telemetry = tel
+	t.Cleanup(func() { telemetry = saved })
+}
+
+type echoArgs struct {
+	Message string `json:"message"`
+	Fail    bool   `json:"fail,omitempty"`
+}
+
+func echoTool(_ context.Context, _ *mcp.CallToolRequest, a echoArgs) (*mcp.CallToolResult, any, error) {
+	if a.Fail {
+		err := errors.New("echo failed")
+		return textErr(err), nil, err
+	}
+	return textOK(a.Message), nil, nil
+}
+
+func TestInstrumentedToolCalls(t *testing.T) {
+	spans := tracetest.NewInMemoryExporter()
+	reader := metric.NewManualReader()
+	tel, err := newTelemetry(DefaultTelemetryConfig(), sdktrace.NewSimpleSpanProcessor(spans), reader)
+	require.NoError(t, err)
+	withTelemetry(t, tel)
+
+	server := mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, nil)
+	reg := &toolRegistry{server: server, known: make(map[string]bool)}
+	addTool(reg, &mcp.Tool{Name: "echo"}, echoTool)
+
+	ctx := context.Background()
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.0.1"}, nil)
+	st, ct := mcp.NewInMemoryTransports()
+	ss, err := server.Connect(ctx, st, nil)
+	require.NoError(t, err)
+	session, err := client.Connect(ctx, ct, nil)
+	require.NoError(t, err)
+	defer session.Close()
+
+	_, err = session.CallTool(ctx, &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"message": "password=hunter2"}})
+	require.NoError(t, err)
+	session.CallTool(ctx, &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"message": "x", "fail": true}})
+
+	got := spans.GetSpans()
+	require.Len(t, got, 2)
+	ok := got[0]
+	assert.Equal(t, "tools/call echo", ok.Name)
+	assert.Equal(t, trace.SpanKindServer, ok.SpanKind)
+	assert.True(t, ok.SpanContext.IsValid())
+	assert.False(t, ok.EndTime.Before(ok.StartTime))
+	assert.Equal(t, codes.Ok, ok.Status.Code)
+	assert.Equal(t, ServerName, attrMap(ok.Resource.Attributes())["service.name"])
+	attrs := attrMap(ok.Attributes)
+	assert.Equal(t, "echo", attrs["gen_ai.tool.name"])
+	assert.Equal(t, ss.ID(), attrs["mcp.session.id"])
+	assert.Contains(t, attrs["mcp.tool.arguments"], RedactedText)
+	assert.NotContains(t, attrs["mcp.tool.arguments"], "hunter2")
+
+	assert.Equal(t, codes.Error, got[1].Status.Code)
+	assert.Equal(t, "echo failed", got[1].Status.Description)
+	assert.Equal(t, "tool_error", attrMap(got[1].Attributes)["error.type"])
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	values := make(map[string]int64)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			assert.True(t, data.IsMonotonic)
+			assert.Equal(t, metricdata.CumulativeTemporality, data.Temporality)
+			require.Len(t, data.DataPoints, 1)
+			v, _ := data.DataPoints[0].Attributes.Value("gen_ai.tool.name")
+			assert.Equal(t, "echo", v.AsString())
+			values[m.Name] = data.DataPoints[0].Value
+		case metricdata.Histogram[float64]:
+			require.Len(t, data.DataPoints, 1)
+			assert.Equal(t, durationBounds, data.DataPoints[0].Bounds)
+			values[m.Name] = int64(data.DataPoints[0].Count)
+		}
+	}
+	assert.Equal(t, map[string]int64{"mcp.tool.calls": 2, "mcp.tool.errors": 1, "mcp.tool.duration": 2}, values)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var traces coltracepb.ExportTraceServiceRequest
+	var metrics colmetricpb.ExportMetricsServiceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/traces":
+			assert.NoError(t, proto.Unmarshal(body, &traces))
+		case "/v1/metrics":
+			assert.NoError(t, proto.Unmarshal(body, &metrics))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := DefaultTelemetryConfig()
+	cfg.Exporter = TelemetryOTLP
+	cfg.Endpoint = srv.URL + "/"
+	cfg.Headers = map[string]string{"X-Api-Key": "secret"}
+	cfg.ExportIntervalMs = 60000
+	tel, err := NewTelemetry(cfg, nil)
+	require.NoError(t, err)
+	withTelemetry(t, tel)
+	instrumentTool("get_cpu_info", echoTool)(context.Background(), nil, echoArgs{Message: "hi"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tel.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	<-done // shutting down flushes what the interval has not sent yet
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, traces.ResourceSpans, 1)
+	span := traces.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, "tools/call get_cpu_info", span.Name)
+	assert.Len(t, span.TraceId, 16)
+	require.Len(t, metrics.ResourceMetrics, 1)
+	var names []string
+	for _, m := range metrics.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		names = append(names, m.Name)
+	}
+	assert.ElementsMatch(t, []string{"mcp.tool.calls", "mcp.tool.duration"}, names, "no errors were counted yet")
+}
+
+func TestStdoutExporter(t *testing.T) {
+	cfg := DefaultTelemetryConfig()
+	cfg.Exporter = TelemetryStdout
+	var buf bytes.Buffer
+	tel, err := NewTelemetry(cfg, &buf)
+	require.NoError(t, err)
+	withTelemetry(t, tel)
+	instrumentTool("get_load_average", echoTool)(context.Background(), nil, echoArgs{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	tel.Run(ctx)
+
+	out := buf.String()
+	assert.Contains(t, out, `"Name":"tools/call get_load_average"`)
+	assert.Contains(t, out, `"mcp.tool.duration"`)
+	assert.False(t, strings.Contains(out, "\n\n"))
+}
+
+func TestArgSummary(t *testing.T) {
+	assert.Equal(t, `{"message":"hi"}`, argSummary(echoArgs{Message: "hi"}))
+	long := argSummary(echoArgs{Message: strings.Repeat("é", 300)})
+	assert.True(t, strings.HasSuffix(long, "..."))
+	assert.LessOrEqual(t, len(long), maxArgSummary+3)
+	assert.True(t, strings.ToValidUTF8(long, "?") == long, "not cut inside a character")
+}
+
+func TestTelemetryConfigValidate(t *testing.T) {
+	cfg, err := parseConfig([]byte("telemetry:\n  exporter: otlp\n  endpoint: https://collector:4318\n"))
+	require.NoError(t, err)
+	assert.Equal(t, ServerName, cfg.Telemetry.ServiceName)
+	for _, yaml := range []string{
+		"telemetry:\n  exporter: zipkin\n",
+		"telemetry:\n  exporter: otlp\n  endpoint: collector:4318\n",
+		"telemetry:\n  exporter: stdout\n  export_interval_ms: 1\n",
+		"telemetry:\n  exporter: stdout\n  service_name: ''\n",
+	} {
+		_, err := parseConfig([]byte(yaml))
+		assert.Error(t, err, yaml)
+	}
+}
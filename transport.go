@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// --- Transports ---
+
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http" // MCP streamable HTTP
+	TransportSSE   = "sse"  // legacy HTTP+SSE (2024-11-05 spec)
+
+	DefaultListenAddr = "127.0.0.1:8080"
+
+	// shutdownTimeout bounds how long in-flight HTTP requests may take to
+	// finish once a shutdown signal has been received.
+	shutdownTimeout = 10 * time.Second
+)
+
+// runServer serves server over the configured transport until ctx is
+// cancelled or the transport fails.
+func runServer(ctx context.Context, server *mcp.Server, opts TransportConfig) error {
+	switch opts.Type {
+	case "", TransportStdio:
+		err := server.Run(ctx, &mcp.StdioTransport{})
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+	case TransportHTTP, TransportSSE:
+		handler, err := newHTTPHandler(server, opts.Type)
+		if err != nil {
+			return err
+		}
+		if err := opts.Auth.validate(); err != nil {
+			return err
+		}
+		if opts.Auth.Enabled() {
+			auth, err := newAuthenticator(opts.Auth)
+			if err != nil {
+				return err
+			}
+			handler = auth.Middleware(handler)
+			activeAuth.Store(auth)
+		}
+
+		addr := opts.Addr
+		if addr == "" {
+			addr = DefaultListenAddr
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		if opts.Auth.TLSEnabled() {
+			tlsConfig, err := newTLSConfig(opts.Auth)
+			if err != nil {
+				ln.Close()
+				return err
+			}
+			ln = tls.NewListener(ln, tlsConfig)
+		}
+		return serveHTTP(ctx, ln, handler)
+	default:
+		return fmt.Errorf("unknown transport %q (want stdio, http or sse)", opts.Type)
+	}
+}
+
+// newHTTPHandler returns an http.Handler serving every session from the
+// same server, so all network clients see one shared tool set.
+func newHTTPHandler(server *mcp.Server, transport string) (http.Handler, error) {
+	getServer := func(*http.Request) *mcp.Server { return server }
+	switch transport {
+	case TransportHTTP:
+		return mcp.NewStreamableHTTPHandler(getServer, nil), nil
+	case TransportSSE:
+		return mcp.NewSSEHandler(getServer), nil
+	default:
+		return nil, fmt.Errorf("transport %q is not served over HTTP", transport)
+	}
+}
+
+// serveHTTP serves handler on ln until ctx is cancelled, then shuts the
+// server down gracefully: the listener is closed and request contexts are
+// cancelled so that long-lived streams (SSE, streamable GET) end instead of
+// holding Shutdown open. Anything still running after shutdownTimeout is
+// closed forcibly.
+func serveHTTP(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	streams, cancelStreams := context.WithCancel(context.Background())
+	defer cancelStreams()
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return streams },
+	}
+	srv.RegisterOnShutdown(cancelStreams)
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(ln) }()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("http server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("http server failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFlags(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		opts, err := parseFlags(nil)
+		require.NoError(t, err)
+		assert.Equal(t, TransportStdio, opts.Config.Transport.Type)
+		assert.Equal(t, DefaultListenAddr, opts.Config.Transport.Addr)
+		assert.False(t, opts.ShowVersion)
+	})
+
+	t.Run("http transport", func(t *testing.T) {
+		opts, err := parseFlags([]string{"--transport=http", "--addr", "0.0.0.0:9000"})
+		require.NoError(t, err)
+		assert.Equal(t, TransportHTTP, opts.Config.Transport.Type)
+		assert.Equal(t, "0.0.0.0:9000", opts.Config.Transport.Addr)
+	})
+
+	t.Run("version shorthand", func(t *testing.T) {
+		opts, err := parseFlags([]string{"-v"})
+		require.NoError(t, err)
+		assert.True(t, opts.ShowVersion)
+	})
+
+	t.Run("unknown transport", func(t *testing.T) {
+		_, err := parseFlags([]string{"--transport=websocket"})
+		assert.Error(t, err)
+	})
+}
+
+func TestRunServerUnknownTransport(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, nil)
+	err := runServer(context.Background(), server, TransportConfig{Type: "websocket"})
+	assert.Error(t, err)
+}
+
+// Integration test: serve the registered tools over a loopback socket and
+// drive them with a real MCP client for each network transport.
+func TestNetworkTransports(t *testing.T) {
+	for _, tc := range []struct {
+		transport string
+		client    func(url string) mcp.Transport
+	}{
+		{TransportHTTP, func(url string) mcp.Transport { return &mcp.StreamableClientTransport{Endpoint: url} }},
+		{TransportSSE, func(url string) mcp.Transport { return &mcp.SSEClientTransport{Endpoint: url} }},
+	} {
+		t.Run(tc.transport, func(t *testing.T) {
+			server := mcp.NewServer(&mcp.Implementation{Name: ServerName, Version: ServerVersion}, nil)
+			require.NoError(t, registerTools(server, nil))
+			handler, err := newHTTPHandler(server, tc.transport)
+			require.NoError(t, err)
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			served := make(chan error, 1)
+			go func() { served <- serveHTTP(ctx, ln, handler) }()
+
+			client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "0.0.1"}, nil)
+			session, err := client.Connect(ctx, tc.client("http://"+ln.Addr().String()), nil)
+			require.NoError(t, err)
+
+			tools, err := session.ListTools(ctx, nil)
+			require.NoError(t, err)
+			names := make([]string, 0, len(tools.Tools))
+			for _, tool := range tools.Tools {
+				names = append(names, tool.Name)
+			}
+			assert.Contains(t, names, "get_load_average")
+			assert.Contains(t, names, "get_process_info")
+
+			res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "get_load_average"})
+			require.NoError(t, err)
+			require.False(t, res.IsError)
+			raw, err := json.Marshal(res.StructuredContent)
+			require.NoError(t, err)
+			var load LoadAvgResult
+			require.NoError(t, json.Unmarshal(raw, &load))
+			assert.GreaterOrEqual(t, load.Load1, float64(0))
+
+			// Shutdown must complete even with the session's stream still open.
+			cancel()
+			select {
+			case err := <-served:
+				assert.NoError(t, err)
+			case <-time.After(shutdownTimeout + 5*time.Second):
+				t.Fatal("server did not shut down")
+			}
+			session.Close()
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// --- systemd units (list_units, get_unit_status) ---
+
+// systemctl is the command used to query systemd.
+var systemctl = "systemctl"
+
+// maxFailedUnitDetails caps how many failed units list_units describes in full.
+const maxFailedUnitDetails = 20
+
+type UnitSummary struct {
+	Name        string `json:"name"`
+	Load        string `json:"load"`   // loaded|not-found|masked|...
+	Active      string `json:"active"` // active|inactive|failed|activating|deactivating
+	Sub         string `json:"sub"`    // running|exited|dead|failed|...
+	Description string `json:"description,omitempty"`
+}
+
+type UnitStatus struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Load          string `json:"load"`
+	Active        string `json:"active"`
+	Sub           string `json:"sub"`
+	Result        string `json:"result,omitempty"`          // success|exit-code|signal|core-dump|timeout|oom-kill|...
+	UnitFileState string `json:"unit_file_state,omitempty"` // enabled|disabled|static|...
+	FragmentPath  string `json:"fragment_path,omitempty"`
+	MainPID       int32  `json:"main_pid,omitempty"`
+	Restarts      uint64 `json:"restarts"` // NRestarts: automatic restarts since the unit was last started by hand
+
+	LastExitCode   *int   `json:"last_exit_code,omitempty"`   // status of the last main process exit
+	LastExitSignal string `json:"last_exit_signal,omitempty"` // set instead when it was killed by a signal
+	LastExit       string `json:"last_exit,omitempty"`        // e.g. "exited with status 1" or "killed by SIGKILL (core dumped)"
+	LastExitTime   string `json:"last_exit_time,omitempty"`
+	ActiveSince    string `json:"active_since,omitempty"`
+	InactiveSince  string `json:"inactive_since,omitempty"`
+
+	MemoryBytes  uint64 `json:"memory_bytes,omitempty"`      // MemoryCurrent; omitted without memory accounting
+	MemoryPeak   uint64 `json:"memory_peak_bytes,omitempty"` // MemoryPeak, systemd 255 and later
+	CPUUsageNsec uint64 `json:"cpu_usage_nsec,omitempty"`    // CPUUsageNSec; omitted without CPU accounting
+	Tasks        uint64 `json:"tasks,omitempty"`
+
+	Journal      []LogEntry `json:"journal,omitempty"` // newest journal lines of the unit
+	JournalError string     `json:"journal_error,omitempty"`
+}
+
+type ListUnitsResult struct {
+	Units       []UnitSummary  `json:"units"`
+	Total       int            `json:"total"`        // units matching, before limit
+	Counts      map[string]int `json:"counts"`       // matching units per active state
+	Failed      []UnitStatus   `json:"failed"`       // details of failed units of any type, whatever the filters
+	FailedTotal int            `json:"failed_total"` // failed units, of which at most 20 are detailed
+	Truncated   bool           `json:"truncated,omitempty"`
+}
+
+type ListUnitsArgs struct {
+	Type    string `json:"type,omitempty"`    // unit type such as service, timer or socket (default service); "all" for every type
+	State   string `json:"state,omitempty"`   // active|inactive|failed|running|...; default every loaded unit
+	Pattern string `json:"pattern,omitempty"` // glob on the unit name, e.g. "nginx*"
+	Limit   int    `json:"limit,omitempty"`   // max units listed (default 200, max 2000)
+}
+
+type UnitStatusArgs struct {
+	Unit         string `json:"unit"`                    // unit name; ".service" is assumed without a suffix
+	JournalLines int    `json:"journal_lines,omitempty"` // newest journal lines included (default 20, 0 for the default, -1 for none)
+}
+
+// unitProperties are the properties get_unit_status reads with systemctl show.
+var unitProperties = []string{
+	"Id", "Description", "LoadState", "ActiveState", "SubState", "Result", "UnitFileState", "FragmentPath",
+	"MainPID", "NRestarts", "ExecMainCode", "ExecMainStatus", "ExecMainExitTimestamp",
+	"ActiveEnterTimestamp", "InactiveEnterTimestamp",
+	"MemoryCurrent", "MemoryPeak", "CPUUsageNSec", "TasksCurrent",
+}
+
+func runSystemctl(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, systemctl, append([]string{"--no-pager"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// list-units and show exit 0 even for unknown units, so any failure
+		// means systemd could not be reached.
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("systemctl failed: %s", msg)
+	}
+	return out, nil
+}
+
+func listUnits(ctx context.Context, a ListUnitsArgs) (ListUnitsResult, error) {
+	limit := a.Limit
+	if limit <= 0 {
+		limit = 200
+	}
+	if limit > 2000 {
+		limit = 2000
+	}
+	args := []string{"list-units", "--all", "--no-legend", "--plain"}
+	switch a.Type {
+	case "":
+		args = append(args, "--type=service")
+	case "all":
+	default:
+		args = append(args, "--type="+a.Type)
+	}
+	if a.State != "" {
+		args = append(args, "--state="+a.State)
+	}
+	if a.Pattern != "" {
+		args = append(args, "--", a.Pattern)
+	}
+	data, err := runSystemctl(ctx, args...)
+	if err != nil {
+		return ListUnitsResult{}, err
+	}
+	units := parseUnitList(data)
+
+	out := ListUnitsResult{Units: units, Total: len(units), Counts: make(map[string]int), Failed: []UnitStatus{}}
+	for _, u := range units {
+		out.Counts[u.Active]++
+	}
+	sort.Slice(out.Units, func(i, j int) bool { return out.Units[i].Name < out.Units[j].Name })
+	if len(out.Units) > limit {
+		out.Units = out.Units[:limit]
+		out.Truncated = true
+	}
+
+	// Failed units of every type are summarised so one call answers
+	// "what is broken".
+	data, err = runSystemctl(ctx, "list-units", "--state=failed", "--no-legend", "--plain")
+	if err != nil {
+		return ListUnitsResult{}, err
+	}
+	var failed []string
+	for _, u := range parseUnitList(data) {
+		failed = append(failed, u.Name)
+	}
+	sort.Strings(failed)
+	out.FailedTotal = len(failed)
+	if len(failed) > maxFailedUnitDetails {
+		failed = failed[:maxFailedUnitDetails]
+	}
+	if len(failed) > 0 {
+		statuses, err := showUnits(ctx, failed...)
+		if err != nil {
+			return ListUnitsResult{}, err
+		}
+		out.Failed = statuses
+	}
+	return out, nil
+}
+
+// parseUnitList parses "systemctl list-units --no-legend --plain" output:
+//
+//	nginx.service loaded active running A high performance web server
+func parseUnitList(data []byte) []UnitSummary {
+	var out []UnitSummary
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(sc.Text()), "●"))
+		if len(fields) < 4 {
+			continue
+		}
+		out = append(out, UnitSummary{
+			Name:        fields[0],
+			Load:        fields[1],
+			Active:      fields[2],
+			Sub:         fields[3],
+			Description: strings.Join(fields[4:], " "),
+		})
+	}
+	return out
+}
+
+func getUnitStatus(ctx context.Context, a UnitStatusArgs) (UnitStatus, error) {
+	unit := strings.TrimSpace(a.Unit)
+	if unit == "" {
+		return UnitStatus{}, errors.New("unit is required")
+	}
+	if !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+	statuses, err := showUnits(ctx, unit)
+	if err != nil {
+		return UnitStatus{}, err
+	}
+	if len(statuses) == 0 {
+		return UnitStatus{}, fmt.Errorf("no status for unit %s", unit)
+	}
+	st := statuses[0]
+	if st.Load == "not-found" {
+		return UnitStatus{}, fmt.Errorf("unit %s not found", unit)
+	}
+
+	lines := a.JournalLines
+	if lines == 0 {
+		lines = 20
+	}
+	if lines > 0 {
+		c := &logCollector{max: logMaxLines(lines)}
+		if err := readJournal(ctx, logFilter{unit: st.Name, priority: -1}, c); err != nil {
+			st.JournalError = err.Error()
+		} else {
+			st.Journal = finishLogs(c, nil).Entries
+		}
+	}
+	return st, nil
+}
+
+// showUnits reads unitProperties of each unit with one systemctl show call.
+func showUnits(ctx context.Context, units ...string) ([]UnitStatus, error) {
+	args := []string{"show", "--property=" + strings.Join(unitProperties, ","), "--"}
+	data, err := runSystemctl(ctx, append(args, units...)...)
+	if err != nil {
+		return nil, err
+	}
+	var out []UnitStatus
+	for _, props := range parseShowOutput(data) {
+		out = append(out, unitStatusFromProps(props))
+	}
+	return out, nil
+}
+
+// parseShowOutput splits "systemctl show" output into one Key=Value map
+// per unit; units are separated by blank lines.
+func parseShowOutput(data []byte) []map[string]string {
+	var out []map[string]string
+	cur := map[string]string{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(cur) > 0 {
+				out = append(out, cur)
+				cur = map[string]string{}
+			}
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			cur[k] = v
+		}
+	}
+	if len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+func unitStatusFromProps(p map[string]string) UnitStatus {
+	st := UnitStatus{
+		Name:          p["Id"],
+		Description:   p["Description"],
+		Load:          p["LoadState"],
+		Active:        p["ActiveState"],
+		Sub:           p["SubState"],
+		Result:        p["Result"],
+		UnitFileState: p["UnitFileState"],
+		FragmentPath:  p["FragmentPath"],
+		ActiveSince:   showTimestamp(p["ActiveEnterTimestamp"]),
+		InactiveSince: showTimestamp(p["InactiveEnterTimestamp"]),
+		LastExitTime:  showTimestamp(p["ExecMainExitTimestamp"]),
+	}
+	if pid, err := strconv.ParseInt(p["MainPID"], 10, 32); err == nil {
+		st.MainPID = int32(pid)
+	}
+	st.Restarts, _ = showUint(p["NRestarts"])
+	st.MemoryBytes, _ = showUint(p["MemoryCurrent"])
+	st.MemoryPeak, _ = showUint(p["MemoryPeak"])
+	st.CPUUsageNsec, _ = showUint(p["CPUUsageNSec"])
+	st.Tasks, _ = showUint(p["TasksCurrent"])
+
+	// ExecMainCode is the si_code of the last exit: CLD_EXITED (1),
+	// CLD_KILLED (2) or CLD_DUMPED (3); 0 when the process never exited.
+	code, _ := strconv.Atoi(p["ExecMainCode"])
+	status, err := strconv.Atoi(p["ExecMainStatus"])
+	if err == nil && st.LastExitTime != "" {
+		switch code {
+		case 1:
+			st.LastExitCode = &status
+			st.LastExit = fmt.Sprintf("exited with status %d", status)
+		case 2, 3:
+			st.LastExitSignal = signalName(syscall.Signal(status))
+			st.LastExit = "killed by " + st.LastExitSignal
+			if code == 3 {
+				st.LastExit += " (core dumped)"
+			}
+		}
+	}
+	return st
+}
+
+// showUint parses a numeric property. systemd reports unset values as
+// "[not set]" or as the maximum uint64.
+func showUint(s string) (uint64, bool) {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || v == ^uint64(0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// showTimestamp drops the empty and "n/a" values systemd uses for
+// timestamps that were never set.
+func showTimestamp(s string) string {
+	if s == "n/a" || s == "0" {
+		return ""
+	}
+	return s
+}
+
+// signalName names sig as in SIGKILL, falling back to its number and
+// description for signals the control tools do not know.
+func signalName(sig syscall.Signal) string {
+	for name, s := range signalNames {
+		if s == sig {
+			return "SIG" + name
+		}
+	}
+	return fmt.Sprintf("signal %d (%s)", int(sig), sig)
+}
+
+// unitsSummary describes a ListUnitsResult for the text content.
+func unitsSummary(r ListUnitsResult) string {
+	msg := fmt.Sprintf("%d units listed", r.Total)
+	if r.FailedTotal > 0 {
+		names := make([]string, len(r.Failed))
+		for i, f := range r.Failed {
+			names[i] = f.Name
+		}
+		msg += fmt.Sprintf("; %d failed: %s", r.FailedTotal, strings.Join(names, ", "))
+		if r.FailedTotal > len(r.Failed) {
+			msg += ", ..."
+		}
+	}
+	return msg
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeUnitList = `nginx.service loaded active running A high performance web server
+web.service   loaded failed failed  Web app
+cron.service  loaded inactive dead  Regular background program processing daemon
+`
+
+const fakeFailedList = `● web.service loaded failed failed Web app
+● backup.timer loaded failed failed Nightly backup
+`
+
+const fakeShowTimer = `Id=backup.timer
+Description=Nightly backup
+LoadState=loaded
+ActiveState=failed
+SubState=failed
+Result=resources
+MainPID=0
+NRestarts=0
+ExecMainExitTimestamp=
+MemoryCurrent=[not set]
+`
+
+const fakeShowWeb = `Id=web.service
+Description=Web app
+LoadState=loaded
+ActiveState=failed
+SubState=failed
+Result=core-dump
+UnitFileState=enabled
+MainPID=0
+NRestarts=5
+ExecMainCode=3
+ExecMainStatus=11
+ExecMainExitTimestamp=Fri 2024-03-01 10:00:00 UTC
+InactiveEnterTimestamp=Fri 2024-03-01 10:00:01 UTC
+ActiveEnterTimestamp=n/a
+MemoryCurrent=18446744073709551615
+CPUUsageNSec=123000000
+TasksCurrent=0
+`
+
+const fakeShow = fakeShowTimer + "\n" + fakeShowWeb
+
+// fakeSystemctl points systemctl at a script that answers list-units and
+// show from canned output and records its last arguments.
+func fakeSystemctl(t *testing.T, show string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{"list": fakeUnitList, "failed": fakeFailedList, "show": show} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	argsFile := filepath.Join(dir, "args")
+	script := `#!/bin/sh
+echo "$@" > ` + argsFile + `
+case "$*" in
+*--state=failed*) cat ` + filepath.Join(dir, "failed") + ` ;;
+*list-units*) cat ` + filepath.Join(dir, "list") + ` ;;
+*show*) cat ` + filepath.Join(dir, "show") + ` ;;
+*) echo "unexpected $*" >&2; exit 1 ;;
+esac
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0o755))
+	saved := systemctl
+	systemctl = filepath.Join(dir, "systemctl")
+	t.Cleanup(func() { systemctl = saved })
+	return argsFile
+}
+
+func TestListUnits(t *testing.T) {
+	fakeSystemctl(t, fakeShow)
+
+	out, err := listUnits(context.Background(), ListUnitsArgs{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 3, out.Total)
+	assert.True(t, out.Truncated)
+	require.Len(t, out.Units, 2)
+	assert.Equal(t, UnitSummary{Name: "cron.service", Load: "loaded", Active: "inactive", Sub: "dead", Description: "Regular background program processing daemon"}, out.Units[0])
+	assert.Equal(t, map[string]int{"active": 1, "failed": 1, "inactive": 1}, out.Counts)
+
+	assert.Equal(t, 2, out.FailedTotal)
+	require.Len(t, out.Failed, 2)
+	assert.Equal(t, "backup.timer", out.Failed[0].Name)
+	assert.Empty(t, out.Failed[0].LastExit, "never exited")
+	assert.Equal(t, "3 units listed; 2 failed: backup.timer, web.service", unitsSummary(out))
+}
+
+func TestGetUnitStatus(t *testing.T) {
+	argsFile := fakeSystemctl(t, fakeShowWeb)
+	withLogsConfig(t, `{"__REALTIME_TIMESTAMP":"1700000000000000","_SYSTEMD_UNIT":"web.service","PRIORITY":"2","MESSAGE":"web.service: Main process exited, code=dumped, status=11/SEGV"}`+"\n")
+
+	st, err := getUnitStatus(context.Background(), UnitStatusArgs{Unit: "web"})
+	require.NoError(t, err)
+	args, _ := os.ReadFile(argsFile)
+	assert.Contains(t, string(args), "-- web.service", "a bare name is taken as a service")
+
+	assert.Equal(t, "web.service", st.Name)
+	assert.Equal(t, "failed", st.Active)
+	assert.Equal(t, "core-dump", st.Result)
+	assert.Equal(t, uint64(5), st.Restarts)
+	assert.Nil(t, st.LastExitCode)
+	assert.Equal(t, "signal 11 (segmentation fault)", st.LastExitSignal)
+	assert.Equal(t, "killed by signal 11 (segmentation fault) (core dumped)", st.LastExit)
+	assert.Equal(t, "Fri 2024-03-01 10:00:00 UTC", st.LastExitTime)
+	assert.Empty(t, st.ActiveSince)
+	assert.Zero(t, st.MemoryBytes, "unset accounting is left out")
+	assert.Equal(t, uint64(123000000), st.CPUUsageNsec)
+	require.Len(t, st.Journal, 1)
+	assert.Equal(t, "crit", st.Journal[0].Priority)
+
+	st, err = getUnitStatus(context.Background(), UnitStatusArgs{Unit: "web.service", JournalLines: -1})
+	require.NoError(t, err)
+	assert.Nil(t, st.Journal)
+
+	_, err = getUnitStatus(context.Background(), UnitStatusArgs{})
+	assert.Error(t, err)
+}
+
+func TestUnitStatusExitCode(t *testing.T) {
+	st := unitStatusFromProps(map[string]string{
+		"Id": "job.service", "ExecMainCode": "1", "ExecMainStatus": "2",
+		"ExecMainExitTimestamp": "Fri 2024-03-01 10:00:00 UTC", "MainPID": "0",
+	})
+	require.NotNil(t, st.LastExitCode)
+	assert.Equal(t, 2, *st.LastExitCode)
+	assert.Equal(t, "exited with status 2", st.LastExit)
+
+	st = unitStatusFromProps(map[string]string{"ExecMainCode": "2", "ExecMainStatus": "9", "ExecMainExitTimestamp": "x"})
+	assert.Equal(t, "killed by SIGKILL", st.LastExit)
+}
+
+func TestGetUnitStatusNotFound(t *testing.T) {
+	fakeSystemctl(t, "Id=nope.service\nLoadState=not-found\nActiveState=inactive\nSubState=dead\n")
+	_, err := getUnitStatus(context.Background(), UnitStatusArgs{Unit: "nope"})
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestSystemctlFailure(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Failed to connect to bus: Host is down' >&2\nexit 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0o755))
+	saved := systemctl
+	systemctl = filepath.Join(dir, "systemctl")
+	defer func() { systemctl = saved }()
+
+	_, err := listUnits(context.Background(), ListUnitsArgs{})
+	assert.ErrorContains(t, err, "Failed to connect to bus")
+}